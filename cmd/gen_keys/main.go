@@ -10,23 +10,31 @@ import (
 	"time"
 
 	"github.com/binance-chain/tss-lib/crypto/paillier"
+
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/arith"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/sync"
 )
 
 type proc struct {
 	publicKey  *paillier.PublicKey
 	privateKey *paillier.PrivateKey
+	identity   *sync.Identity
 	localAddr  string
 }
 
 func makeProcess(localAddr string) (*proc, error) {
-	bitLen := 264
-	timeout := 100 * time.Millisecond
+	bitLen := arith.PaillierMinBits
+	timeout := 5 * time.Minute
 	privKey, pubKey, err := paillier.GenerateKeyPair(bitLen, timeout)
 	if err != nil {
 		return nil, err
 	}
+	identity, err := sync.NewIdentity()
+	if err != nil {
+		return nil, err
+	}
 
-	return &proc{pubKey, privKey, localAddr}, nil
+	return &proc{pubKey, privKey, identity, localAddr}, nil
 }
 
 func encodePaillierPrivateKey(pk *paillier.PrivateKey) string {
@@ -39,10 +47,10 @@ func encodePaillierPrivateKey(pk *paillier.PrivateKey) string {
 	copy(buf[2:2+lenN], pk.PublicKey.N.Bytes())
 
 	binary.LittleEndian.PutUint16(buf[2+lenN:4+lenN], uint16(lenLambdaN))
-	copy(buf[4+lenN:4+lenN+lenLambdaN], pk.PublicKey.N.Bytes())
+	copy(buf[4+lenN:4+lenN+lenLambdaN], pk.LambdaN.Bytes())
 
-	binary.LittleEndian.PutUint16(buf[4+lenN+lenLambdaN:6+lenN+lenLambdaN], uint16(lenN))
-	copy(buf[6+lenN+lenLambdaN:], pk.PublicKey.N.Bytes())
+	binary.LittleEndian.PutUint16(buf[4+lenN+lenLambdaN:6+lenN+lenLambdaN], uint16(lenPhiN))
+	copy(buf[6+lenN+lenLambdaN:], pk.PhiN.Bytes())
 
 	return base64.StdEncoding.EncodeToString(buf)
 }
@@ -116,6 +124,14 @@ func main() {
 			fmt.Fprintln(os.Stderr, err)
 			return
 		}
+		if _, err = f.WriteString(" "); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		if _, err = f.WriteString(base64.StdEncoding.EncodeToString(p.identity.Private())); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
 		if _, err = f.WriteString("\n"); err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			return
@@ -138,6 +154,14 @@ func main() {
 			fmt.Fprintln(os.Stderr, err)
 			return
 		}
+		if _, err = f.WriteString(base64.StdEncoding.EncodeToString(p.identity.Public())); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		if _, err = f.WriteString("|"); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
 		if _, err = f.WriteString(p.localAddr); err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			return
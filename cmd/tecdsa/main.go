@@ -29,10 +29,12 @@ import (
 type member struct {
 	pid        int
 	privateKey *paillier.PrivateKey
+	identity   *sync.Identity
 }
 
 type committee struct {
 	publicKeys []*paillier.PublicKey
+	identities [][]byte
 	addresses  []string
 }
 
@@ -68,32 +70,40 @@ func decodePaillierPrivateKey(enc string) (*paillier.PrivateKey, error) {
 	return pk, nil
 }
 
-func parseCommitteeLine(line string) (*paillier.PublicKey, string, error) {
+func parseCommitteeLine(line string) (*paillier.PublicKey, []byte, string, error) {
 	s := strings.Split(line, "|")
 
-	if len(s) < 2 {
-		return nil, "", errors.New("commitee line should be of the form:\npaillierKey|address")
+	if len(s) < 3 {
+		return nil, nil, "", errors.New("commitee line should be of the form:\npaillierKey|identityKey|address")
 	}
-	pkEnc, addr := s[0], s[1]
+	pkEnc, idEnc, addr := s[0], s[1], s[2]
 
 	if len(pkEnc) == 0 {
-		return nil, "", errors.New("empty paillier key")
+		return nil, nil, "", errors.New("empty paillier key")
+	}
+	if len(idEnc) == 0 {
+		return nil, nil, "", errors.New("empty identity key")
 	}
 	if len(addr) == 0 {
-		return nil, "", errors.New("empty address")
+		return nil, nil, "", errors.New("empty address")
 	}
 	if len(strings.Split(addr, ":")) < 2 {
-		return nil, "", errors.New("malformed address")
+		return nil, nil, "", errors.New("malformed address")
 	}
 
 	pk := &paillier.PublicKey{}
 	pkBytes, err := base64.StdEncoding.DecodeString(pkEnc)
 	if err != nil {
-		return nil, "", errors.New("malformed address")
+		return nil, nil, "", errors.New("malformed paillier key")
 	}
 	pk.N = new(big.Int).SetBytes(pkBytes)
 
-	return pk, addr, nil
+	identity, err := base64.StdEncoding.DecodeString(idEnc)
+	if err != nil || len(identity) != sync.KeySize {
+		return nil, nil, "", errors.New("malformed identity key")
+	}
+
+	return pk, identity, addr, nil
 }
 
 func getCommittee(filename string) (*committee, error) {
@@ -111,12 +121,13 @@ func getCommittee(filename string) (*committee, error) {
 	scanner := bufio.NewScanner(file)
 	scanner.Split(bufio.ScanWords)
 	for scanner.Scan() {
-		pk, addr, err := parseCommitteeLine(scanner.Text())
+		pk, identity, addr, err := parseCommitteeLine(scanner.Text())
 		if err != nil {
 			return nil, err
 		}
 
 		c.publicKeys = append(c.publicKeys, pk)
+		c.identities = append(c.identities, identity)
 		c.addresses = append(c.addresses, addr)
 	}
 
@@ -144,7 +155,7 @@ func getMember(filename string) (*member, error) {
 	defer file.Close()
 	scanner := bufio.NewScanner(file)
 	scanner.Split(bufio.ScanWords)
-	// read private paillier key and pid. Assumes one line of the form "key pid"
+	// read private paillier key, pid and private identity key. Assumes one line of the form "key pid identity"
 	if !scanner.Scan() {
 		return nil, errors.New("empty member file")
 	}
@@ -160,6 +171,18 @@ func getMember(filename string) (*member, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	if !scanner.Scan() {
+		return nil, errors.New("identity key missing")
+	}
+	idPriv, err := base64.StdEncoding.DecodeString(scanner.Text())
+	if err != nil {
+		return nil, err
+	}
+	m.identity, err = sync.IdentityFromPrivate(idPriv)
+	if err != nil {
+		return nil, err
+	}
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
@@ -170,20 +193,20 @@ func getMember(filename string) (*member, error) {
 type cliOptions struct {
 	pkPidFilename     string
 	keysAddrsFilename string
-	startTime         string
-	roundDuration     string
+	roundTimeout      string
 	sigNumber         int
 	threshold         int
+	mta               string
 }
 
 func getOptions() *cliOptions {
 	var options cliOptions
 	flag.StringVar(&options.pkPidFilename, "pk", "", "a file with a private key and process id")
 	flag.StringVar(&options.keysAddrsFilename, "keys_addrs", "", "a file with keys and associated addresses")
-	flag.StringVar(&options.startTime, "startTime", "", "time at which start the protocol")
-	flag.StringVar(&options.roundDuration, "roundDuration", "", "duration of a round")
+	flag.StringVar(&options.roundTimeout, "roundTimeout", "10s", "time after which a round fails if some party has not sent its data")
 	flag.IntVar(&options.sigNumber, "sigNumber", 1, "number of signatures to generate")
 	flag.IntVar(&options.threshold, "threshold", 1, "number of parties that must cooperate to sign a message")
+	flag.StringVar(&options.mta, "mta", "paillier", "backend of multiplications: paillier or ot")
 
 	flag.Parse()
 
@@ -245,39 +268,53 @@ func main() {
 		return
 	}
 
-	start := strings.ReplaceAll(options.startTime, "-", " ")
-	startTime, err := time.Parse(time.UnixDate, start)
+	roundTimeout, err := time.ParseDuration(options.roundTimeout)
 	if err != nil {
-		fmt.Fprintf(logFile, "Error in parsing startTime with layout %v: %v\n", time.UnixDate, err)
+		fmt.Fprintf(logFile, "Error in parsing roundTimeout: %v\n.", err)
 		return
 	}
-	roundDuration, err := time.ParseDuration(options.roundDuration)
-	if err != nil {
-		fmt.Fprintf(logFile, "Error in parsing roundDuration: %v\n.", err)
+
+	var backend tecdsa.Backend
+	switch options.mta {
+	case "paillier":
+		backend = tecdsa.PaillierBackend(member.privateKey, committee.publicKeys)
+	case "ot":
+		backend = tecdsa.OTBackend
+	default:
+		fmt.Fprintf(logFile, "Unknown mta backend %v, expected paillier or ot.\n", options.mta)
 		return
 	}
 
 	nProc := uint16(len(committee.addresses))
-	fmt.Fprintf(logFile, "nProc:%v\nsigNumber:%v\nthreshold:%v\ncurrentTime:%v\nstartTime:%v\nroundDuration:%v\n", nProc, options.sigNumber, options.threshold, time.Now().UTC().Format(time.UnixDate), start, roundDuration)
+	fmt.Fprintf(logFile, "nProc:%v\nsigNumber:%v\nthreshold:%v\nmta:%v\ncurrentTime:%v\nroundTimeout:%v\n", nProc, options.sigNumber, options.threshold, options.mta, time.Now().UTC().Format(time.UnixDate), roundTimeout)
 
-	server := sync.NewServer(uint16(member.pid), nProc, startTime, roundDuration, net)
+	server, err := sync.NewSecureServer(uint16(member.pid), nProc, roundTimeout, net, member.identity, committee.identities)
+	if err != nil {
+		fmt.Fprintf(logFile, "Could not init sync server due to %v.\n", err)
+		return
+	}
 	server.Start()
 	fmt.Fprintf(logFile, "Starting!\n")
 
 	var proto *tecdsa.Protocol
 	bench(logFile, "tecdsa.Init", nil, func() {
-		proto, err = tecdsa.Init(uint16(member.pid), nProc, server)
+		proto, err = tecdsa.Init(uint16(member.pid), nProc, uint16(options.threshold), server, backend)
 		if err != nil {
 			fmt.Fprintf(logFile, "error during tecdsa initialization: %v\n.", err)
 			os.Exit(1)
 		}
 	})
 
+	// all parties take part in presigning, and every presignature is generated and used in its own session
+	quorum := make([]uint16, nProc)
+	for i := range quorum {
+		quorum[i] = uint16(i)
+	}
 	totalTime := int64(0)
 	for i := 0; i < options.sigNumber; i++ {
 		logMsg := fmt.Sprintf("Generating a presignature; round %d", i)
 		bench(logFile, logMsg, &totalTime, func() {
-			if err = proto.Presign(uint16(options.threshold)); err != nil {
+			if err = proto.Presign(uint64(i+1), quorum); err != nil {
 				fmt.Fprintf(logFile, "error during generating a presignature: %v\n", err)
 				os.Exit(1)
 				return
@@ -289,8 +326,10 @@ func main() {
 	totalTime = int64(0)
 	for i := 0; i < options.sigNumber; i++ {
 		logMsg := fmt.Sprintf("Signing; round %d", i)
+		msg := make([]byte, 8)
+		binary.LittleEndian.PutUint64(msg, uint64(i))
 		bench(logFile, logMsg, &totalTime, func() {
-			if _, err := proto.Sign(big.NewInt(int64(i))); err != nil {
+			if _, err := proto.SignMessage(uint64(i+1), msg, tecdsa.SHA256); err != nil {
 				fmt.Fprintf(logFile, "error during signing: %v\n", err)
 				return
 			}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math/big"
 
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/commitment"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/zkpok"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/curve"
 )
@@ -29,47 +30,42 @@ func CheckDH(u, v curve.Point, group curve.Group, key *DKey) error {
 	testValueShare := group.Add(group.ScalarMult(u, alpha), group.ScalarMult(group.Gen(), beta))
 	verifyValueShare := group.Add(group.ScalarMult(v, alpha), group.ScalarMult(key.pk, beta))
 
+	// (testValueShare, verifyValueShare) is a rerandomization of (u, v) treated as an ElGamal commitment under pk
+	egf := commitment.NewElGamalFactory(key.pk)
+	uv := egf.FromPoints(u, v)
+	rid := key.secret.server.NextRoundID()
+	rrerand, err := zkpok.NewZKEGRerand(key.secret.transcript(rid, key.secret.pid), egf, uv, egf.FromPoints(testValueShare, verifyValueShare), alpha, beta)
+	if err != nil {
+		return err
+	}
+
 	toSendBuf := &bytes.Buffer{}
 	toSend := [][]byte{nil}
-	// TODO: replace the following commitment and check with RRerand
-	rrerand := zkpok.NoopZKproof{}
-
-	buildNMC := func(testValueShare, verifyValueShare curve.Point, group curve.Group, rrerand *zkpok.NoopZKproof) (*NMCtmp, error) {
-		dataBuf, zkpBuf := &bytes.Buffer{}, &bytes.Buffer{}
-
-		if err := group.Encode(testValueShare, dataBuf); err != nil {
-			return nil, err
-		}
 
-		if err := group.Encode(verifyValueShare, dataBuf); err != nil {
-			return nil, err
-		}
-
-		if err := rrerand.Encode(zkpBuf); err != nil {
-			return nil, err
-		}
-		nmc := &NMCtmp{dataBuf.Bytes(), zkpBuf.Bytes()}
-
-		return nmc, nil
+	if err := group.Encode(verifyValueShare, toSendBuf); err != nil {
+		return err
 	}
+	if err := group.Encode(testValueShare, toSendBuf); err != nil {
+		return err
+	}
+	if err := rrerand.Encode(toSendBuf); err != nil {
+		return err
+	}
+	payload := append([]byte{}, toSendBuf.Bytes()...)
 
-	nmc, err := buildNMC(testValueShare, verifyValueShare, group, &rrerand)
+	comm, rnd, err := commitment.NewHashCommitment(key.secret.session(rid), key.secret.pid, payload)
 	if err != nil {
 		return err
 	}
-
-	if err := nmc.encode(toSendBuf); err != nil {
+	toSendBuf.Reset()
+	if err := comm.Encode(toSendBuf); err != nil {
 		return err
 	}
 
-	nmcs := make([]*NMCtmp, nProc)
+	comms := make([]*commitment.HashCommitment, nProc)
 	check := func(pid uint16, data []byte) error {
-		buf := bytes.NewBuffer(data)
-		nmcs[pid] = &NMCtmp{}
-		if err := nmcs[pid].decode(buf); err != nil {
-			return err
-		}
-		return nil
+		comms[pid] = &commitment.HashCommitment{}
+		return comms[pid].Decode(bytes.NewBuffer(data))
 	}
 
 	toSend[0] = toSendBuf.Bytes()
@@ -79,24 +75,15 @@ func CheckDH(u, v curve.Point, group curve.Group, key *DKey) error {
 
 	//STEP 2 Decommit to previously published values, verify proofs and compute (u', v')
 
-	toSendBuf.Reset()
-	if err := rrerand.Encode(toSendBuf); err != nil {
-		return err
-	}
-	if err := group.Encode(verifyValueShare, toSendBuf); err != nil {
-		return err
-	}
-
-	if err := group.Encode(testValueShare, toSendBuf); err != nil {
-		return err
-	}
-
 	testValueShares := make([]curve.Point, nProc)
 	verifyValueShares := make([]curve.Point, nProc)
 
 	check = func(pid uint16, data []byte) error {
-		buf := bytes.NewBuffer(data)
-		var err error
+		payload, err := openCommitment(comms[pid], key.secret.session(rid), pid, data)
+		if err != nil {
+			return err
+		}
+		buf := bytes.NewBuffer(payload)
 		var verifyValueShare, testValueShare curve.Point
 		if verifyValueShare, err = group.Decode(buf); err != nil {
 			return err
@@ -108,27 +95,18 @@ func CheckDH(u, v curve.Point, group curve.Group, key *DKey) error {
 		}
 		testValueShares[pid] = testValueShare
 
-		var rrerand zkpok.NoopZKproof
+		var rrerand zkpok.ZKEGRerand
 		if err := rrerand.Decode(buf); err != nil {
 			return err
 		}
-		if !rrerand.Verify() {
-			return fmt.Errorf("Wrong rrerand proof")
-		}
-
-		nmc, err := buildNMC(testValueShare, verifyValueShare, group, &rrerand)
-		if err != nil {
-			return err
-		}
-
-		if err := nmcs[pid].Verify(nmc.dataBytes, nmc.zkpBytes); err != nil {
-			return err
+		if err := rrerand.Verify(key.secret.transcript(rid, pid), egf, uv, egf.FromPoints(testValueShare, verifyValueShare)); err != nil {
+			return fmt.Errorf("Wrong rrerand proof: %v", err)
 		}
 
 		return nil
 	}
 
-	toSend[0] = toSendBuf.Bytes()
+	toSend[0] = append(payload, rnd...)
 	if err := key.secret.server.Round(toSend, check); err != nil {
 		return err
 	}
@@ -145,6 +123,9 @@ func CheckDH(u, v curve.Point, group curve.Group, key *DKey) error {
 		}
 	}
 
+	// (pkShare, testValue^skShare) is an ElGamal commitment to 0 under testValue,
+	// so ZKEGReveal proves that testValue is raised to the secret behind pkShare
+	testEGF := commitment.NewElGamalFactory(testValue)
 	testValue = group.ScalarMult(testValue, key.secret.skShare)
 
 	//STEP 3 Publish testValue with ZKPOK
@@ -154,7 +135,11 @@ func CheckDH(u, v curve.Point, group curve.Group, key *DKey) error {
 		return err
 	}
 
-	regexp := zkpok.NoopZKproof{}
+	rid = key.secret.server.NextRoundID()
+	regexp, err := zkpok.NewZKEGReveal(key.secret.transcript(rid, key.secret.pid), testEGF, testEGF.FromPoints(group.ScalarBaseMult(key.secret.skShare), testValue), big.NewInt(0), key.secret.skShare)
+	if err != nil {
+		return err
+	}
 	if err := regexp.Encode(toSendBuf); err != nil {
 		return err
 	}
@@ -171,13 +156,13 @@ func CheckDH(u, v curve.Point, group curve.Group, key *DKey) error {
 		}
 		testValues[pid] = testValue
 
-		var regexp zkpok.NoopZKproof
+		var regexp zkpok.ZKEGReveal
 
 		if err := regexp.Decode(buf); err != nil {
 			return fmt.Errorf("decode: regexp %v", err)
 		}
-		if !regexp.Verify() {
-			return fmt.Errorf("Wrong regexp proof")
+		if err := regexp.Verify(key.secret.transcript(rid, pid), testEGF, testEGF.FromPoints(key.pkShares[pid], testValue), big.NewInt(0)); err != nil {
+			return fmt.Errorf("Wrong regexp proof: %v", err)
 		}
 
 		return nil
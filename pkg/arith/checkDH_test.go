@@ -1,6 +1,7 @@
 package arith_test
 
 import (
+	"bytes"
 	"math/big"
 	"math/rand"
 	stdsync "sync"
@@ -20,29 +21,27 @@ import (
 var _ = Describe("CheckDH Test", func() {
 
 	var (
-		nProc     uint16
-		netservs  []network.Server
-		syncservs []sync.Server
-		roundTime time.Duration
-		start     time.Time
-		wg        stdsync.WaitGroup
-		errors    []error
-		group     curve.Group
+		nProc        uint16
+		netservs     []network.Server
+		syncservs    []sync.Server
+		roundTimeout time.Duration
+		wg           stdsync.WaitGroup
+		errors       []error
+		group        curve.Group
 	)
 
 	JustBeforeEach(func() {
 		wg = stdsync.WaitGroup{}
 		netservs = tests.NewNetwork(int(nProc), time.Millisecond*100)
 		syncservs = make([]sync.Server, int(nProc))
-		start = time.Now().Add(50 * time.Millisecond)
 		for i := uint16(0); i < nProc; i++ {
-			syncservs[i] = sync.NewServer(i, nProc, start, roundTime, netservs[i])
+			syncservs[i] = sync.NewServer(i, nProc, roundTimeout, netservs[i])
 			syncservs[i].Start()
 		}
 	})
 
 	BeforeEach(func() {
-		roundTime = 100 * time.Millisecond
+		roundTimeout = 2 * time.Second
 		rand.Seed(1729)
 		group = curve.NewSecp256k1Group()
 	})
@@ -139,6 +138,52 @@ var _ = Describe("CheckDH Test", func() {
 					Expect(errors[alice]).To(HaveOccurred())
 					Expect(errors[bob]).To(HaveOccurred())
 				})
+
+				It("Should blame alice raising the test value to a different secret", func() {
+					keys = make([]*arith.DKey, nProc)
+					errors = make([]error, nProc)
+
+					// rounds of CheckDH: 0 commits to the rerandomization, 1 reveals it and 2 publishes the test value
+					syncservs[alice] = &tamperingServer{Server: syncservs[alice], target: 2, tamper: func(data []byte) []byte {
+						buf := bytes.NewBuffer(data)
+						testValue, err := group.Decode(buf)
+						Expect(err).NotTo(HaveOccurred())
+
+						tampered := &bytes.Buffer{}
+						Expect(group.Encode(group.Add(testValue, group.Gen()), tampered)).To(Succeed())
+						tampered.Write(buf.Bytes())
+						return tampered.Bytes()
+					}}
+
+					aSecretValue := big.NewInt(rand.Int63())
+					bSecretValue := big.NewInt(rand.Int63())
+
+					aSecret := arith.NewDSecret(alice, "x", aSecretValue, syncservs[alice])
+					bSecret := arith.NewDSecret(bob, "x", bSecretValue, syncservs[bob])
+
+					pkShares := []curve.Point{group.ScalarBaseMult(aSecretValue), group.ScalarBaseMult(bSecretValue)}
+					keys[alice] = arith.NewDKey(aSecret, pkShares, group)
+					keys[bob] = arith.NewDKey(bSecret, pkShares, group)
+
+					u = group.ScalarBaseMult(big.NewInt(rand.Int63()))
+					v = group.ScalarMult(u, new(big.Int).Add(aSecretValue, bSecretValue))
+
+					wg.Add(int(nProc))
+					go func() {
+						defer wg.Done()
+						errors[alice] = arith.CheckDH(u, v, group, keys[alice])
+					}()
+					go func() {
+						defer wg.Done()
+						errors[bob] = arith.CheckDH(u, v, group, keys[bob])
+					}()
+					wg.Wait()
+
+					Expect(errors[bob]).To(HaveOccurred())
+					rErr, ok := errors[bob].(*sync.RoundError)
+					Expect(ok).To(BeTrue())
+					Expect(rErr.Missing()).To(Equal([]uint16{alice}))
+				})
 			})
 		})
 	})
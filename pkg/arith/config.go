@@ -3,11 +3,12 @@ package arith
 import (
 	"crypto/rand"
 	"io"
-	"math/big"
 )
 
-var (
-	randReader io.Reader = rand.Reader
-	// Q TODO: placeholder, should be replaced with order of the curve
-	Q, _ = big.NewInt(0).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F", 16)
-)
+// mtaSecurity is the statistical security parameter of masking used in MtA
+const mtaSecurity = 80
+
+// PaillierMinBits is the minimal bit length of Paillier moduli accepted by SetupPaillier
+const PaillierMinBits = 2048
+
+var randReader io.Reader = rand.Reader
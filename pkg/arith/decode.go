@@ -0,0 +1,280 @@
+package arith
+
+import (
+	"fmt"
+	"math/big"
+
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/curve"
+)
+
+// decode computes the value at 0 of the polynomial of degree t-1 agreeing with all but at most (m-t)/2
+// of the m given evaluations, using the Berlekamp-Welch algorithm. It also returns the indices of the evaluations
+// that disagree with the polynomial. As in interpolate, the evaluation at index i is the value at i+1,
+// and nil evaluations are skipped.
+func decode(evals []*big.Int, t uint16, q *big.Int) (*big.Int, []uint16, error) {
+	xs := []*big.Int{}
+	ys := []*big.Int{}
+	pids := []uint16{}
+	for i, eval := range evals {
+		if eval == nil {
+			continue
+		}
+		xs = append(xs, big.NewInt(int64(i+1)))
+		ys = append(ys, new(big.Int).Mod(eval, q))
+		pids = append(pids, uint16(i))
+	}
+	m := len(xs)
+	if m < int(t) {
+		return nil, nil, fmt.Errorf("too few evaluations to decode: expected %v, got %v", t, m)
+	}
+	e := (m - int(t)) / 2
+
+	// Find Q of degree e+t-1 and monic E of degree e such that Q(x_i) = y_i E(x_i) for all i.
+	// The unknowns are the coefficients of Q followed by the lower coefficients of E.
+	nQ := e + int(t)
+	a := make([][]*big.Int, m)
+	b := make([]*big.Int, m)
+	for i := range a {
+		a[i] = make([]*big.Int, nQ+e)
+		pow := big.NewInt(1)
+		for k := 0; k < nQ; k++ {
+			a[i][k] = new(big.Int).Set(pow)
+			if k < e {
+				a[i][nQ+k] = new(big.Int).Mul(ys[i], pow)
+				a[i][nQ+k].Neg(a[i][nQ+k])
+				a[i][nQ+k].Mod(a[i][nQ+k], q)
+			}
+			if k == e {
+				b[i] = new(big.Int).Mul(ys[i], pow)
+				b[i].Mod(b[i], q)
+			}
+			pow.Mul(pow, xs[i])
+			pow.Mod(pow, q)
+		}
+	}
+	sol, err := solve(a, b, q)
+	if err != nil {
+		return nil, nil, fmt.Errorf("too many corrupted evaluations to decode: %v", err)
+	}
+
+	errLocator := append(sol[nQ:], big.NewInt(1))
+	f, rem := polyDivide(sol[:nQ], errLocator, q)
+	for _, c := range rem {
+		if c.Sign() != 0 {
+			return nil, nil, fmt.Errorf("too many corrupted evaluations to decode")
+		}
+	}
+
+	culprits := []uint16{}
+	for i := range xs {
+		if polyEval(f, xs[i], q).Cmp(ys[i]) != 0 {
+			culprits = append(culprits, pids[i])
+		}
+	}
+	if len(culprits) > e {
+		return nil, nil, fmt.Errorf("too many corrupted evaluations to decode")
+	}
+
+	return new(big.Int).Set(f[0]), culprits, nil
+}
+
+// maxErrorsInExp is the maximal number of corrupted evaluations decodeInExp corrects
+const maxErrorsInExp = 2
+
+// decodeInExp is the counterpart of decode for evaluations in the exponent, i.e. points g^{f(i+1)}.
+// Since the coefficients of the error locator cannot be found without discrete logarithms, it searches
+// for the smallest set of evaluations whose removal leaves evaluations of a polynomial of degree t-1.
+// The search tries all sets of up to e evaluations, so its cost grows as m^e for m evaluations, and e is capped:
+// it corrects up to min((m-t)/2, maxErrorsInExp) corrupted evaluations, and fails if there are more.
+// In Exp every evaluation comes with a proof against its commitment, so only inconsistent commitments get here.
+func decodeInExp(group curve.Group, evals []curve.Point, t uint16) (curve.Point, []uint16, error) {
+	pids := []uint16{}
+	for i, eval := range evals {
+		if eval != nil {
+			pids = append(pids, uint16(i))
+		}
+	}
+	m := len(pids)
+	if m < int(t) {
+		return nil, nil, fmt.Errorf("too few evaluations to decode: expected %v, got %v", t, m)
+	}
+	e := (m - int(t)) / 2
+	if e > maxErrorsInExp {
+		e = maxErrorsInExp
+	}
+
+	removed := make([]bool, m)
+	var search func(start, left int) []uint16
+	search = func(start, left int) []uint16 {
+		if left == 0 {
+			kept := []uint16{}
+			culprits := []uint16{}
+			for i, pid := range pids {
+				if removed[i] {
+					culprits = append(culprits, pid)
+				} else {
+					kept = append(kept, pid)
+				}
+			}
+			if consistentInExp(group, evals, kept, t) {
+				return culprits
+			}
+			return nil
+		}
+		for i := start; i <= m-left; i++ {
+			removed[i] = true
+			culprits := search(i+1, left-1)
+			removed[i] = false
+			if culprits != nil {
+				return culprits
+			}
+		}
+		return nil
+	}
+
+	for nErr := 0; nErr <= e; nErr++ {
+		culprits := search(0, nErr)
+		if culprits == nil {
+			continue
+		}
+		isCulprit := make(map[uint16]bool, len(culprits))
+		for _, pid := range culprits {
+			isCulprit[pid] = true
+		}
+		base := []uint16{}
+		for _, pid := range pids {
+			if !isCulprit[pid] && len(base) < int(t) {
+				base = append(base, pid)
+			}
+		}
+		return interpolateInExp(group, evals, base, big.NewInt(0)), culprits, nil
+	}
+
+	return nil, nil, fmt.Errorf("too many corrupted evaluations to decode")
+}
+
+// consistentInExp checks if the evaluations of the given parties lie on a polynomial of degree t-1
+func consistentInExp(group curve.Group, evals []curve.Point, pids []uint16, t uint16) bool {
+	for _, pid := range pids[t:] {
+		expected := interpolateInExp(group, evals, pids[:t], big.NewInt(int64(pid)+1))
+		if !group.Equal(expected, evals[pid]) {
+			return false
+		}
+	}
+	return true
+}
+
+// interpolateMissingInExp sets the missing evaluations to the ones interpolated from t evaluations of the parties
+// other than culprits
+func interpolateMissingInExp(group curve.Group, evals []curve.Point, culprits []uint16, t uint16) {
+	isCulprit := make(map[uint16]bool, len(culprits))
+	for _, pid := range culprits {
+		isCulprit[pid] = true
+	}
+	base := []uint16{}
+	for pid, eval := range evals {
+		if eval != nil && !isCulprit[uint16(pid)] && len(base) < int(t) {
+			base = append(base, uint16(pid))
+		}
+	}
+	for pid, eval := range evals {
+		if eval == nil {
+			evals[pid] = interpolateInExp(group, evals, base, big.NewInt(int64(pid)+1))
+		}
+	}
+}
+
+// interpolateInExp computes g^{f(x)} given the evaluations g^{f(pid+1)} of the given parties
+func interpolateInExp(group curve.Group, evals []curve.Point, pids []uint16, x *big.Int) curve.Point {
+	args := make([]*big.Int, len(pids))
+	for i, pid := range pids {
+		args[i] = big.NewInt(int64(pid))
+	}
+	result := group.Neutral()
+	for i, arg := range args {
+		result = group.Add(result, group.ScalarMult(evals[pids[i]], lagrangeCoefAt(x, arg, args, group.Order())))
+	}
+	return result
+}
+
+// solve finds a solution of the linear system ax = b over Z_q with the free variables set to 0.
+// It modifies a and b.
+func solve(a [][]*big.Int, b []*big.Int, q *big.Int) ([]*big.Int, error) {
+	nVars := len(a[0])
+	pivots := []int{}
+	row := 0
+	tmp := new(big.Int)
+	for col := 0; col < nVars && row < len(a); col++ {
+		pivot := -1
+		for i := row; i < len(a); i++ {
+			if a[i][col].Sign() != 0 {
+				pivot = i
+				break
+			}
+		}
+		if pivot < 0 {
+			continue
+		}
+		a[row], a[pivot] = a[pivot], a[row]
+		b[row], b[pivot] = b[pivot], b[row]
+
+		inv := new(big.Int).ModInverse(a[row][col], q)
+		for k := col; k < nVars; k++ {
+			a[row][k].Mul(a[row][k], inv).Mod(a[row][k], q)
+		}
+		b[row].Mul(b[row], inv).Mod(b[row], q)
+
+		for i := range a {
+			if i == row || a[i][col].Sign() == 0 {
+				continue
+			}
+			factor := new(big.Int).Set(a[i][col])
+			for k := col; k < nVars; k++ {
+				tmp.Mul(factor, a[row][k])
+				a[i][k].Sub(a[i][k], tmp).Mod(a[i][k], q)
+			}
+			tmp.Mul(factor, b[row])
+			b[i].Sub(b[i], tmp).Mod(b[i], q)
+		}
+		pivots = append(pivots, col)
+		row++
+	}
+
+	for i := row; i < len(a); i++ {
+		if b[i].Sign() != 0 {
+			return nil, fmt.Errorf("the system is inconsistent")
+		}
+	}
+
+	x := make([]*big.Int, nVars)
+	for i := range x {
+		x[i] = big.NewInt(0)
+	}
+	for i, col := range pivots {
+		x[col].Set(b[i])
+	}
+	return x, nil
+}
+
+// polyDivide divides the polynomial num by the monic polynomial den over Z_q, returning the quotient and the remainder
+func polyDivide(num, den []*big.Int, q *big.Int) ([]*big.Int, []*big.Int) {
+	rem := make([]*big.Int, len(num))
+	for i, c := range num {
+		rem[i] = new(big.Int).Set(c)
+	}
+	degDen := len(den) - 1
+	if len(num) <= degDen {
+		return []*big.Int{big.NewInt(0)}, rem
+	}
+
+	quot := make([]*big.Int, len(num)-degDen)
+	tmp := new(big.Int)
+	for i := len(quot) - 1; i >= 0; i-- {
+		quot[i] = new(big.Int).Set(rem[i+degDen])
+		for j, c := range den {
+			tmp.Mul(quot[i], c)
+			rem[i+j].Sub(rem[i+j], tmp).Mod(rem[i+j], q)
+		}
+	}
+	return quot, rem[:degDen]
+}
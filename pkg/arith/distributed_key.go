@@ -2,11 +2,11 @@ package arith
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
-	"encoding/binary"
 	"fmt"
-	"io"
 
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/commitment"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/zkpok"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/curve"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/sync"
@@ -43,6 +43,13 @@ func (dk *DKey) PublicKey() curve.Point {
 	return dk.pk
 }
 
+// WithContext returns a copy of the key whose rounds, e.g. in CheckDH, fail as soon as ctx is done
+func (dk *DKey) WithContext(ctx context.Context) *DKey {
+	secret := *dk.secret
+	secret.server = dk.secret.server.WithContext(ctx)
+	return &DKey{&secret, dk.pk, dk.pkShares}
+}
+
 // TDKey is a thresholded distirbuted key
 type TDKey struct {
 	DKey
@@ -54,116 +61,64 @@ func (tdk TDKey) Threshold() uint16 {
 	return tdk.secret.t
 }
 
-// NMCtmp is a temporary placeholder
-type NMCtmp struct {
-	dataBytes, zkpBytes []byte
-}
-
-func (nmc *NMCtmp) encode(w io.Writer) error {
-	lenBytes := make([]byte, 8)
-	binary.LittleEndian.PutUint32(lenBytes[:4], uint32(len(nmc.dataBytes)))
-	binary.LittleEndian.PutUint32(lenBytes[4:8], uint32(len(nmc.zkpBytes)))
-	if _, err := w.Write(lenBytes); err != nil {
-		return err
-	}
-	if _, err := w.Write(nmc.dataBytes); err != nil {
-		return err
-	}
-	if _, err := w.Write(nmc.zkpBytes); err != nil {
-		return err
-	}
-	return nil
-}
-
-func (nmc *NMCtmp) decode(r io.Reader) error {
-	lenBytes := make([]byte, 8)
-	n, err := r.Read(lenBytes)
-	if err != nil {
-		return err
-	}
-	if n < 8 {
-		return fmt.Errorf("nmc wrong number of bytes in decode")
-	}
-
-	lenData := int(binary.LittleEndian.Uint32(lenBytes[:4]))
-	nmc.dataBytes = make([]byte, lenData)
-	n, err = r.Read(nmc.dataBytes)
-	if err != nil {
-		return err
-	}
-	if n < lenData {
-		return fmt.Errorf("nmc wrong number of dataBytes in decode")
-	}
-
-	lenZkp := int(binary.LittleEndian.Uint32(lenBytes[4:8]))
-	nmc.zkpBytes = make([]byte, lenZkp)
-	n, err = r.Read(nmc.zkpBytes)
-	if err != nil {
-		return err
-	}
-	if n < lenZkp {
-		return fmt.Errorf("nmc wrong number of zkpBytes in decode")
-	}
-
-	return nil
-
+// WithContext returns a copy of the threshold key whose rounds fail as soon as ctx is done
+func (tdk *TDKey) WithContext(ctx context.Context) *TDKey {
+	secret := tdk.secret.WithContext(ctx)
+	return &TDKey{DKey{&secret.DSecret, tdk.pk, tdk.pkShares}, secret}
 }
 
-// Verify tests if ncm is a commitment to given args
-func (nmc *NMCtmp) Verify(dataBytes, zkpBytes []byte) error {
-	if !bytes.Equal(nmc.dataBytes, dataBytes) {
-		return fmt.Errorf("wrong data bytes")
+// openCommitment splits a decommitment into the payload and the randomness, and verifies it against comm
+func openCommitment(comm *commitment.HashCommitment, session []byte, pid uint16, data []byte) ([]byte, error) {
+	if len(data) < commitment.HashRandLen {
+		return nil, fmt.Errorf("decommitment is too short %v", len(data))
 	}
-	if !bytes.Equal(nmc.zkpBytes, zkpBytes) {
-		return fmt.Errorf("wrong proof bytes")
+	payload, rnd := data[:len(data)-commitment.HashRandLen], data[len(data)-commitment.HashRandLen:]
+	if err := comm.Verify(session, pid, payload, rnd); err != nil {
+		return nil, fmt.Errorf("Wrong decommitment: %v", err)
 	}
-
-	return nil
+	return payload, nil
 }
 
 // GenExpReveal is a method for generating a new distirbuted key
 func GenExpReveal(pid uint16, label string, server sync.Server, nProc uint16, group curve.Group) (*DKey, error) {
 	// generate a secret key share
-	skShare, err := rand.Int(randReader, Q)
+	skShare, err := rand.Int(randReader, group.Order())
 	if err != nil {
 		return nil, err
 	}
-	dSecret := &DSecret{pid, label, skShare, server}
+	dSecret := NewDSecret(pid, label, skShare, server)
 
 	pkShares := make([]curve.Point, nProc)
 	pkShares[pid] = group.ScalarBaseMult(dSecret.skShare)
 
 	// Round 1: commmit to (g^{a_k}, pi_k)
-	// TODO: replace with a proper zkpok and nmc when it's ready, now it sends just the values
 	toSendBuf := &bytes.Buffer{}
 	if err = group.Encode(pkShares[pid], toSendBuf); err != nil {
 		return nil, err
 	}
-	dataBytes := make([]byte, len(toSendBuf.Bytes()))
-	copy(dataBytes, toSendBuf.Bytes())
-
-	zkp := zkpok.NoopZKproof{}
+	rid := server.NextRoundID()
+	zkp, err := zkpok.NewZKDLog(dSecret.transcript(rid, pid), group, pkShares[pid], skShare)
+	if err != nil {
+		return nil, err
+	}
 	if err = zkp.Encode(toSendBuf); err != nil {
 		return nil, err
 	}
-	zkpBytes := toSendBuf.Bytes()[len(dataBytes):]
+	payload := append([]byte{}, toSendBuf.Bytes()...)
 
-	nmc := &NMCtmp{dataBytes, zkpBytes}
+	comm, rnd, err := commitment.NewHashCommitment(dSecret.session(rid), pid, payload)
+	if err != nil {
+		return nil, err
+	}
 	toSendBuf.Reset()
-	if err = nmc.encode(toSendBuf); err != nil {
+	if err = comm.Encode(toSendBuf); err != nil {
 		return nil, err
 	}
 
-	// TODO: sth we can check here?
-	nmcs := make([]*NMCtmp, nProc)
+	comms := make([]*commitment.HashCommitment, nProc)
 	check := func(pid uint16, data []byte) error {
-		buf := bytes.NewBuffer(data)
-		nmcs[pid] = &NMCtmp{}
-		if err := nmcs[pid].decode(buf); err != nil {
-			return err
-		}
-
-		return nil
+		comms[pid] = &commitment.HashCommitment{}
+		return comms[pid].Decode(bytes.NewBuffer(data))
 	}
 
 	err = server.Round([][]byte{toSendBuf.Bytes()}, check)
@@ -172,30 +127,24 @@ func GenExpReveal(pid uint16, label string, server sync.Server, nProc uint16, gr
 	}
 
 	// Round 2: decommit to (g^{a_k}, pi_k)
-	toSendBuf.Reset()
-	if err = group.Encode(pkShares[pid], toSendBuf); err != nil {
-		return nil, err
-	}
-	if err = zkp.Encode(toSendBuf); err != nil {
-		return nil, err
-	}
+	toSend := append(payload, rnd...)
 
 	check = func(pid uint16, data []byte) error {
-		buf := bytes.NewBuffer(data)
+		payload, err := openCommitment(comms[pid], dSecret.session(rid), pid, data)
+		if err != nil {
+			return err
+		}
+		buf := bytes.NewBuffer(payload)
 		cp, err := group.Decode(buf)
 		if err != nil {
 			return err
 		}
-		var zkp zkpok.NoopZKproof
+		var zkp zkpok.ZKDLog
 		if err = zkp.Decode(buf); err != nil {
 			return err
 		}
-		if !zkp.Verify() {
-			return fmt.Errorf("Wrong proof")
-		}
-
-		if err := nmcs[pid].Verify(data, []byte{}); err != nil {
-			return err
+		if err := zkp.Verify(dSecret.transcript(rid, pid), group, cp); err != nil {
+			return fmt.Errorf("Wrong proof: %v", err)
 		}
 
 		pkShares[pid] = cp
@@ -203,7 +152,7 @@ func GenExpReveal(pid uint16, label string, server sync.Server, nProc uint16, gr
 		return nil
 	}
 
-	err = server.Round([][]byte{toSendBuf.Bytes()}, check)
+	err = server.Round([][]byte{toSend}, check)
 	if err != nil {
 		return nil, err
 	}
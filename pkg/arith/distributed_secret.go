@@ -2,11 +2,14 @@ package arith
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
+	"encoding/binary"
 	"fmt"
 	"math/big"
-	stdsync "sync"
+	"sort"
 
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/commitment"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/zkpok"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/curve"
@@ -36,12 +39,32 @@ func (ds *DSecret) Label() string {
 	return ds.label
 }
 
+// transcript returns a transcript binding proofs to the secret, the session and the round with given id and the prover
+func (ds *DSecret) transcript(roundID int64, pid uint16) *pkg.Transcript {
+	tr := pkg.NewTranscript("ThresholdECDSA")
+	tr.AppendMessage("label", []byte(ds.label))
+	tr.AppendUint64("session", ds.server.SessionID())
+	tr.AppendUint64("round", uint64(roundID))
+	tr.AppendUint64("pid", uint64(pid))
+	return tr
+}
+
+// session returns an identifier binding commitments to the secret, the session and the round with given id
+func (ds *DSecret) session(roundID int64) []byte {
+	sid := make([]byte, 16, 16+len(ds.label))
+	binary.LittleEndian.PutUint64(sid[:8], ds.server.SessionID())
+	binary.LittleEndian.PutUint64(sid[8:], uint64(roundID))
+	return append(sid, ds.label...)
+}
+
 // ADSecret is an arithmetic distirbuted secret
 type ADSecret struct {
 	DSecret
 	r   *big.Int
 	egf *commitment.ElGamalFactory
 	egs []*commitment.ElGamal
+	// quorum lists in increasing order the parties sharing the secret when it is shared by a quorum, and is nil otherwise
+	quorum []uint16
 }
 
 // TDSecret is a thresholded distributed secret
@@ -51,107 +74,255 @@ type TDSecret struct {
 }
 
 // Reveal computes a join secret, which share is kept in tds.
+// Every party proves that its share agrees with its commitment in egs. Shares with wrong proofs are rejected,
+// and the secret is decoded from the remaining ones, correcting up to (m-t)/2 corrupted shares out of m.
+// Only the n parties sharing the secret, i.e. its quorum if it is shared by one, take part in the round.
+// The round completes as soon as revealQuorum shares, counting ours, pass the proofs, so that up to (n-t)/2
+// corrupted shares may be corrected. If the round fails, e.g. as some parties are offline, the secret is still decoded
+// from the shares of the live parties, as long as there are at least t of them. If some shares were rejected,
+// Reveal returns the secret together with a DecodingError naming their senders.
 func (tds *TDSecret) Reveal() (*big.Int, error) {
-	// TODO: add EGReveal
-	toSend := [][]byte{tds.skShare.Bytes()}
+	order := tds.egf.Curve().Order()
+	secrets, rejected, err := tds.revealShares(tds.holdersRound())
+	if err != nil && countShares(secrets) < int(tds.t) {
+		return nil, err
+	}
+
+	secret, culprits, err := decode(secrets, tds.t, order)
+	if err != nil {
+		return nil, err
+	}
+	culprits = append(culprits, rejected...)
+	if len(culprits) > 0 {
+		sort.Slice(culprits, func(i, j int) bool { return culprits[i] < culprits[j] })
+		return secret, newDecodingError(fmt.Sprintf("Reveal: rejected shares of the parties %v", culprits), culprits)
+	}
 
-	secrets := make([]*big.Int, len(tds.egs))
-	secrets[tds.pid] = tds.skShare
+	return secret, nil
+}
 
-	check := func(pid uint16, data []byte) error {
-		// TODO: check zkpok
-		secrets[pid] = new(big.Int).SetBytes(data)
-		return nil
+// revealQuorum returns the number of shares, counting ours, Reveal and Exp of a threshold secret wait for:
+// t+2e for the largest e with t+2e not exceeding the number of parties sharing the secret, so that e corrupted shares are corrected
+func revealQuorum(t uint16, holders int) uint16 {
+	return t + 2*((uint16(holders)-t)/2)
+}
+
+// holdersRound returns a function running a round of Reveal or Exp among the parties sharing the threshold secret,
+// which completes as soon as revealQuorum of them, counting us, have sent data passing the check.
+// The parties outside the quorum of a secret shared by one hold no shares, so they are neither sent data nor waited for.
+func (tds *TDSecret) holdersRound() func([][]byte, func(uint16, []byte) error) error {
+	server, holders := tds.server, len(tds.egs)
+	if tds.quorum != nil {
+		server, holders = newQuorumServer(tds.server, len(tds.egs), tds.quorum), len(tds.quorum)
 	}
+	return func(toSend [][]byte, check func(uint16, []byte) error) error {
+		_, err := server.QuorumRound(toSend, check, revealQuorum(tds.t, holders))
+		return err
+	}
+}
 
-	nProc := len(tds.egs)
-	if err := tds.server.Round(toSend, check); err != nil {
-		if rErr, ok := err.(*sync.RoundError); ok && rErr.Missing() != nil && nProc-len(rErr.Missing()) < int(tds.t) {
-			return nil, err
+// countShares returns the number of the shares that are set
+func countShares(shares []*big.Int) int {
+	n := 0
+	for _, share := range shares {
+		if share != nil {
+			n++
 		}
 	}
+	return n
+}
 
-	sum := big.NewInt(0)
-	for _, secret := range secrets {
-		if secret != nil {
-			sum.Add(sum, secret)
-		}
+// Reveal computes a joint secret as the sum of the shares of all parties.
+// Every party proves that its share agrees with its commitment in egs, so all parties have to send correct shares.
+func (ads *ADSecret) Reveal() (*big.Int, error) {
+	secrets, _, err := ads.revealShares(ads.server.Round)
+	if err != nil {
+		return nil, err
 	}
 
-	return sum, nil
+	order := ads.egf.Curve().Order()
+	secret := big.NewInt(0)
+	for _, share := range secrets {
+		// parties outside a quorum hold 0
+		if share != nil {
+			secret.Add(secret, share)
+		}
+	}
+	return secret.Mod(secret, order), nil
 }
 
-// Exp computes a common public key and its share related to this secret
-func (tds *TDSecret) Exp() (*TDKey, error) {
-	// TODO: keep it somewhere
-	group := curve.NewSecp256k1Group()
-	pid := tds.pid
-	tdk := &TDKey{}
-	tdk.secret = tds
-	tdk.pkShares = make([]curve.Point, len(tds.egs))
-	tdk.pkShares[pid] = group.ScalarBaseMult(tds.skShare)
+// revealShares publishes our share with a proof that it agrees with our commitment and collects the shares of others
+// in a round run by round. It returns the verified shares, the parties whose shares were rejected, and the error of the round.
+func (ads *ADSecret) revealShares(round func([][]byte, func(uint16, []byte) error) error) ([]*big.Int, []uint16, error) {
+	order := ads.egf.Curve().Order()
+	share := new(big.Int).Mod(ads.skShare, order)
 
-	// TODO: add EGRefresh
+	rid := ads.server.NextRoundID()
+	zkp, err := zkpok.NewZKEGReveal(ads.transcript(rid, ads.pid), ads.egf, ads.egs[ads.pid], share, ads.r)
+	if err != nil {
+		return nil, nil, err
+	}
 	toSendBuf := &bytes.Buffer{}
-	if err := group.Encode(tdk.pkShares[pid], toSendBuf); err != nil {
-		return nil, fmt.Errorf("Encoding tkd.pkShare in Exp: %v", err)
+	lenBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(lenBytes, uint32(len(share.Bytes())))
+	toSendBuf.Write(lenBytes)
+	toSendBuf.Write(share.Bytes())
+	if err := zkp.Encode(toSendBuf); err != nil {
+		return nil, nil, err
 	}
 
+	secrets := make([]*big.Int, len(ads.egs))
+	secrets[ads.pid] = share
+
+	verify := func(pid uint16, data []byte) error {
+		if len(data) < 4 {
+			return fmt.Errorf("data for pid %v is to short %v", pid, len(data))
+		}
+		l := int(binary.LittleEndian.Uint32(data[:4]))
+		if l > len(data)-4 {
+			return fmt.Errorf("wrong length of the share %v", l)
+		}
+		share := new(big.Int).SetBytes(data[4 : 4+l])
+		var zkp zkpok.ZKEGReveal
+		if err := zkp.Decode(bytes.NewBuffer(data[4+l:])); err != nil {
+			return fmt.Errorf("decode: zkp %v", err)
+		}
+		if ads.egs[pid] == nil {
+			return fmt.Errorf("missing commitment to the share")
+		}
+		if err := zkp.Verify(ads.transcript(rid, pid), ads.egf, ads.egs[pid], share); err != nil {
+			return fmt.Errorf("Wrong proof: %v", err)
+		}
+		secrets[pid] = share
+		return nil
+	}
+	// parties which sent wrong shares are told apart from the missing ones
+	rejected := []uint16{}
 	check := func(pid uint16, data []byte) error {
-		// TODO: check zkpok
-		buf := bytes.NewBuffer(data)
-		var err error
-		tdk.pkShares[pid], err = group.Decode(buf)
+		err := verify(pid, data)
 		if err != nil {
-			return err
+			rejected = append(rejected, pid)
 		}
-		return nil
+		return err
 	}
 
-	nProc := len(tds.egs)
-	if err := tds.server.Round([][]byte{toSendBuf.Bytes()}, check); err != nil {
-		if rErr, ok := err.(*sync.RoundError); ok && rErr.Missing() != nil && nProc-len(rErr.Missing()) < int(tds.t) {
-			return nil, err
-		}
+	err = round([][]byte{toSendBuf.Bytes()}, check)
+	return secrets, rejected, err
+}
+
+// Exp computes a common public key and its share related to this secret.
+// Every party proves that its public key share agrees with its commitment in egs, and shares with wrong proofs are rejected.
+// As in Reveal, only the parties sharing the secret take part, and the round completes as soon as revealQuorum shares,
+// counting ours, pass the proofs, or the key is decoded from the shares of at least t live parties if the round fails.
+// The shares of the parties which did not send them in time are interpolated from the others. Unlike Reveal, Exp corrects at most maxErrorsInExp shares which passed the proofs
+// but do not agree with the others, as decodeInExp does. If some shares were rejected, Exp returns the key together with
+// a DecodingError naming their senders.
+func (tds *TDSecret) Exp() (*TDKey, error) {
+	group := tds.egf.Curve()
+	tdk := &TDKey{}
+	tdk.secret = tds
+	tdk.DKey.secret = &tds.DSecret
+
+	pkShares, rejected, err := tds.publishPKShares(tds.holdersRound())
+	if err != nil && countPoints(pkShares) < int(tds.t) {
+		return nil, err
+	}
+	tdk.pkShares = pkShares
+
+	pk, culprits, err := decodeInExp(group, tdk.pkShares, tds.t)
+	if err != nil {
+		return nil, err
+	}
+	tdk.pk = pk
+	interpolateMissingInExp(group, tdk.pkShares, culprits, tds.t)
+	culprits = append(culprits, rejected...)
+	if len(culprits) > 0 {
+		sort.Slice(culprits, func(i, j int) bool { return culprits[i] < culprits[j] })
+		return tdk, newDecodingError(fmt.Sprintf("Exp: rejected public key shares of the parties %v", culprits), culprits)
+	}
+
+	return tdk, nil
+}
+
+// Exp computes a common public key and its share related to this secret.
+// Every party proves that its public key share agrees with its commitment in egs, so all parties have to send correct shares.
+func (ads *ADSecret) Exp() (*DKey, error) {
+	pkShares, _, err := ads.publishPKShares(ads.server.Round)
+	if err != nil {
+		return nil, err
 	}
 
-	var wg stdsync.WaitGroup
-	channel := make(chan curve.Point, nProc)
-	counter := tds.t
+	return NewDKey(&ads.DSecret, pkShares, ads.egf.Curve()), nil
+}
 
-	args := make([]*big.Int, tds.t)
-	values := make([]curve.Point, tds.t)
-	for i, value := range tdk.pkShares {
-		if value == nil {
-			continue
+// publishPKShares publishes our public key share with a proof that it agrees with our commitment and collects the shares
+// of others in a round run by round. It returns the verified shares, the parties whose shares were rejected,
+// and the error of the round.
+//
+// The share g^x of a secret x committed to with ElGamal(x,r) is proven with ZKEGExp for the commitments
+// c1 = ElGamal(1,0), c2 = ElGamal(x,r) and c3 = c1^x = ElGamal(x,0), whose second point is g^x.
+func (ads *ADSecret) publishPKShares(round func([][]byte, func(uint16, []byte) error) error) ([]curve.Point, []uint16, error) {
+	group := ads.egf.Curve()
+	share := new(big.Int).Mod(ads.skShare, group.Order())
+	one := ads.egf.Create(big.NewInt(1), big.NewInt(0))
+	pkShares := make([]curve.Point, len(ads.egs))
+	pkShares[ads.pid] = group.ScalarBaseMult(share)
+
+	rid := ads.server.NextRoundID()
+	zkp, err := zkpok.NewZKEGExp(ads.transcript(rid, ads.pid), ads.egf, one, ads.egs[ads.pid], ads.egf.FromPoints(group.Neutral(), pkShares[ads.pid]), big.NewInt(0), ads.r, share)
+	if err != nil {
+		return nil, nil, err
+	}
+	toSendBuf := &bytes.Buffer{}
+	if err := group.Encode(pkShares[ads.pid], toSendBuf); err != nil {
+		return nil, nil, fmt.Errorf("Encoding pkShare in Exp: %v", err)
+	}
+	if err := zkp.Encode(toSendBuf); err != nil {
+		return nil, nil, err
+	}
+
+	verify := func(pid uint16, data []byte) error {
+		buf := bytes.NewBuffer(data)
+		pkShare, err := group.Decode(buf)
+		if err != nil {
+			return fmt.Errorf("decode: pkShare %v", err)
 		}
-		args[i] = big.NewInt(int64(i))
-		values[i] = value
-		counter = counter - 1
-		if counter == 0 {
-			break
+		var zkp zkpok.ZKEGExp
+		if err := zkp.Decode(buf); err != nil {
+			return fmt.Errorf("decode: zkp %v", err)
 		}
+		if ads.egs[pid] == nil {
+			return fmt.Errorf("missing commitment to the share")
+		}
+		if err := zkp.Verify(ads.transcript(rid, pid), ads.egf, one, ads.egs[pid], ads.egf.FromPoints(group.Neutral(), pkShare)); err != nil {
+			return fmt.Errorf("Wrong proof: %v", err)
+		}
+		pkShares[pid] = pkShare
+		return nil
 	}
-
-	for i, arg := range args {
-		wg.Add(1)
-		go func(i int, arg *big.Int) {
-			defer wg.Done()
-			channel <- group.ScalarMult(values[i], lagrangeCoef(arg, args, group.Order()))
-		}(i, arg)
+	// parties which sent wrong shares are told apart from the missing ones
+	rejected := []uint16{}
+	check := func(pid uint16, data []byte) error {
+		err := verify(pid, data)
+		if err != nil {
+			rejected = append(rejected, pid)
+		}
+		return err
 	}
 
-	go func() {
-		wg.Wait()
-		close(channel)
-	}()
+	err = round([][]byte{toSendBuf.Bytes()}, check)
+	return pkShares, rejected, err
+}
 
-	tdk.pk = group.Neutral()
-	for elem := range channel {
-		tdk.pk = group.Add(tdk.pk, elem)
+// countPoints returns the number of the points that are set
+func countPoints(points []curve.Point) int {
+	n := 0
+	for _, p := range points {
+		if p != nil {
+			n++
+		}
 	}
-
-	return tdk, nil
+	return n
 }
 
 // Threshold returns the number of parties that must collude to reveal the secret
@@ -159,23 +330,40 @@ func (tds TDSecret) Threshold() uint16 {
 	return tds.t
 }
 
+// WithContext returns a copy of the secret whose rounds fail as soon as ctx is done.
+// Secrets computed from the copy, e.g. by Reshare or Mult, run their rounds with ctx as well.
+func (ads *ADSecret) WithContext(ctx context.Context) *ADSecret {
+	result := *ads
+	result.server = ads.server.WithContext(ctx)
+	return &result
+}
+
+// WithContext returns a copy of the threshold secret whose rounds fail as soon as ctx is done
+func (tds *TDSecret) WithContext(ctx context.Context) *TDSecret {
+	return &TDSecret{*tds.ADSecret.WithContext(ctx), tds.t}
+}
+
 // Gen generates a new distributed key with given label
 func Gen(label string, server sync.Server, egf *commitment.ElGamalFactory, pid, nProc uint16) (*ADSecret, error) {
 	var err error
 	// create a secret
 	ads := &ADSecret{DSecret: DSecret{pid: pid, label: label, server: server}, egf: egf}
-	if ads.skShare, err = rand.Int(randReader, Q); err != nil {
+	order := egf.Curve().Order()
+	if ads.skShare, err = rand.Int(randReader, order); err != nil {
 		return nil, err
 	}
-	if ads.r, err = rand.Int(randReader, Q); err != nil {
+	if ads.r, err = rand.Int(randReader, order); err != nil {
 		return nil, err
 	}
 
 	// create a commitment and a zkpok
 	ads.egs = make([]*commitment.ElGamal, nProc)
 	ads.egs[ads.pid] = egf.Create(ads.skShare, ads.r)
-	// TODO: replace with a proper zkpok when it's ready
-	zkp := zkpok.NoopZKproof{}
+	rid := server.NextRoundID()
+	zkp, err := zkpok.NewZKEGKnow(ads.transcript(rid, ads.pid), egf, ads.egs[ads.pid], ads.skShare, ads.r)
+	if err != nil {
+		return nil, err
+	}
 
 	toSendBuf := &bytes.Buffer{}
 	if err := ads.egs[ads.pid].Encode(toSendBuf); err != nil {
@@ -185,11 +373,10 @@ func Gen(label string, server sync.Server, egf *commitment.ElGamalFactory, pid,
 		return nil, err
 	}
 
-	// TODO: reimplement after ZKPs are implemented
 	check := func(pid uint16, data []byte) error {
 		var (
 			eg  commitment.ElGamal
-			zkp zkpok.NoopZKproof
+			zkp zkpok.ZKEGKnow
 		)
 		buf := bytes.NewBuffer(data)
 		if err := eg.Decode(buf); err != nil {
@@ -198,8 +385,8 @@ func Gen(label string, server sync.Server, egf *commitment.ElGamalFactory, pid,
 		if err := zkp.Decode(buf); err != nil {
 			return fmt.Errorf("decode: zkp %v", err)
 		}
-		if !zkp.Verify() {
-			return fmt.Errorf("Wrong proof")
+		if err := zkp.Verify(ads.transcript(rid, pid), egf, &eg); err != nil {
+			return fmt.Errorf("Wrong proof: %v", err)
 		}
 		ads.egs[pid] = &eg
 
@@ -210,41 +397,58 @@ func Gen(label string, server sync.Server, egf *commitment.ElGamalFactory, pid,
 	if err != nil {
 		return nil, err
 	}
+	fillNeutral(ads.egs, egf)
 
 	return ads, nil
 }
 
-// Lin computes locally a linear combination of the secrets
-func Lin(alpha, beta *big.Int, a, b *TDSecret, cLabel string) *TDSecret {
-	tds := &TDSecret{}
-	tds.label = cLabel
-	tds.server = a.server
-	tds.egf = a.egf
-	tds.t = a.t
-
-	tds.skShare = new(big.Int).Mul(alpha, a.skShare)
-	tmp := new(big.Int).Mul(beta, b.skShare)
-	tds.skShare.Add(tds.skShare, tmp)
-
-	makeEGLin := func(aeg, beg *commitment.ElGamal) *commitment.ElGamal {
-		result := tds.egf.Neutral()
-		result.Compose(result, aeg)
-		result.Exp(result, alpha)
-		tmp := tds.egf.Neutral()
-		tmp.Compose(tmp, beg)
-		tmp.Exp(tmp, beta)
-		result.Compose(result, tmp)
+// GenThreshold generates a new threshold secret with given label and threshold t.
+// Only the parties in the quorum, at least t of them, take part: they generate an additive secret and reshare it.
+func GenThreshold(label string, server sync.Server, egf *commitment.ElGamalFactory, pid, nProc, t uint16, quorum []uint16) (*TDSecret, error) {
+	if err := checkQuorum(quorum, pid, int(nProc), t); err != nil {
+		return nil, err
+	}
+	ads, err := Gen(label, newQuorumServer(server, int(nProc), quorum), egf, pid, nProc)
+	if err != nil {
+		return nil, err
+	}
+	ads.quorum = sortedQuorum(quorum)
+	return ads.reshareFrom(t, server)
+}
 
-		return result
+// fillNeutral sets the missing commitments of the parties outside a quorum, which hold 0, to neutral ones
+func fillNeutral(egs []*commitment.ElGamal, egf *commitment.ElGamalFactory) {
+	for pid, eg := range egs {
+		if eg == nil {
+			egs[pid] = egf.Neutral()
+		}
 	}
+}
 
-	tds.egs = make([]*commitment.ElGamal, len(a.egs))
-	tds.egs[a.pid] = makeEGLin(a.egs[a.pid], b.egs[b.pid])
-	for pid, eg := range a.egs {
-		if eg != nil {
-			tds.egs[pid] = makeEGLin(a.egs[pid], b.egs[pid])
+// Lin computes locally the linear combination sum_i alphas[i]*secrets[i] of the threshold secrets.
+// The secrets have to have the same threshold, and be shared by the same committee with commitments under the same key.
+// The shares and their randomizing elements are reduced modulo the group order.
+func Lin(alphas []*big.Int, secrets []*TDSecret, cLabel string) (*TDSecret, error) {
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("no secrets to combine")
+	}
+	if len(alphas) != len(secrets) {
+		return nil, fmt.Errorf("got %v coefficients for %v secrets", len(alphas), len(secrets))
+	}
+	first := secrets[0]
+	for _, tds := range secrets[1:] {
+		if tds.t != first.t {
+			return nil, fmt.Errorf("the thresholds of the secrets differ: %v and %v", first.t, tds.t)
+		}
+		if err := first.compatible(&tds.ADSecret); err != nil {
+			return nil, err
 		}
 	}
 
-	return tds
+	// the commitments are combined linearly, and so are their randomizing elements
+	result := first.ADSecret.ScalarMul(alphas[0], cLabel)
+	for i, tds := range secrets[1:] {
+		result = result.addScaled(&tds.ADSecret, alphas[i+1], cLabel)
+	}
+	return newTDSecret(result, first.t)
 }
@@ -0,0 +1,20 @@
+package arith
+
+// DecodingError describes shares that were identified as corrupted while reconstructing a secret or a key
+type DecodingError struct {
+	msg      string
+	culprits []uint16
+}
+
+func newDecodingError(msg string, culprits []uint16) *DecodingError {
+	return &DecodingError{msg, culprits}
+}
+
+func (de *DecodingError) Error() string {
+	return de.msg
+}
+
+// Culprits is a collection of parties whose shares were rejected
+func (de *DecodingError) Culprits() []uint16 {
+	return de.culprits
+}
@@ -0,0 +1,54 @@
+package arith
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Inverse computes the inverse of the secret. It multiplies the secret by a random mask rho,
+// reveals the product tau and divides rho by it, so that only tau, which is uniformly random, is disclosed.
+// The mask and the product are labeled with cLabel followed by "_rho" and "_tau".
+func (ads *ADSecret) Inverse(cLabel string, egKey *DKey, mta MtA) (*ADSecret, error) {
+	rho, err := Gen(cLabel+"_rho", ads.server, ads.egf, ads.pid, uint16(len(ads.egs)))
+	if err != nil {
+		return nil, err
+	}
+	rho.quorum = ads.quorum
+	tau, err := Mult(ads, rho, cLabel+"_tau", egKey, mta)
+	if err != nil {
+		return nil, err
+	}
+	tauValue, err := tau.Reveal()
+	if err != nil {
+		return nil, err
+	}
+
+	tauInv := new(big.Int).ModInverse(tauValue, ads.egf.Curve().Order())
+	if tauInv == nil {
+		return nil, fmt.Errorf("the secret %v is not invertible", ads.label)
+	}
+	return rho.ScalarMul(tauInv, cLabel), nil
+}
+
+// Inverse computes the inverse of the threshold secret as a threshold secret with the same threshold.
+// Only the parties in the quorum, at least t of them, take part: they invert the additive secret with the same value
+// and reshare the result.
+func (tds *TDSecret) Inverse(cLabel string, egKey *TDKey, mta MtA, quorum []uint16) (*TDSecret, error) {
+	if err := checkQuorum(quorum, tds.pid, len(tds.egs), tds.t); err != nil {
+		return nil, err
+	}
+	server := newQuorumServer(tds.server, len(tds.egs), quorum)
+	ads, err := tds.additive(quorum, server)
+	if err != nil {
+		return nil, err
+	}
+	key, err := egKey.additive(quorum, server)
+	if err != nil {
+		return nil, err
+	}
+	inv, err := ads.Inverse(cLabel, key, mta)
+	if err != nil {
+		return nil, err
+	}
+	return inv.reshareFrom(tds.t, tds.server)
+}
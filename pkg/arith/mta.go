@@ -0,0 +1,36 @@
+package arith
+
+import (
+	"math/big"
+
+	"github.com/binance-chain/tss-lib/crypto/paillier"
+
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/zkpok"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/sync"
+)
+
+// MtA is a multiplicative-to-additive backend used by Mult
+type MtA interface {
+	// PrivMult computes an additive share of the product of two additively shared secrets, given our shares a and b in Z_q.
+	// The shares of all parties sum up to the product modulo q. Proofs of the backend are bound to the product with transcript.
+	PrivMult(a, b, q *big.Int, server sync.Server, transcript func(int64, uint16) *pkg.Transcript) (*big.Int, error)
+}
+
+// paillierMtA runs PrivMult with Paillier keys of all parties
+type paillierMtA struct {
+	pid, nProc int
+	priv       *paillier.PrivateKey
+	pubs       []*paillier.PublicKey
+	rps        []*zkpok.RingPedersen
+}
+
+// NewPaillierMtA returns the MtA backend based on Paillier encryption.
+// The keys of other parties and their ring-Pedersen parameters should be checked with SetupPaillier first.
+func NewPaillierMtA(pid, nProc uint16, priv *paillier.PrivateKey, pubs []*paillier.PublicKey, rps []*zkpok.RingPedersen) MtA {
+	return &paillierMtA{int(pid), int(nProc), priv, pubs, rps}
+}
+
+func (pm *paillierMtA) PrivMult(a, b, q *big.Int, server sync.Server, transcript func(int64, uint16) *pkg.Transcript) (*big.Int, error) {
+	return PrivMult(a, b, q, pm.pid, pm.nProc, server, transcript, pm.priv, pm.pubs[pm.pid], pm.pubs, pm.rps)
+}
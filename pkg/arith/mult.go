@@ -3,68 +3,90 @@ package arith
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/binary"
 	"fmt"
 	"math/big"
 
 	"github.com/binance-chain/tss-lib/crypto/paillier"
 
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/commitment"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/zkpok"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/sync"
 )
 
-// Mult computes a multiplication of two arithmetic secrets
-func Mult(a, b *ADSecret, cLabel string, priv *paillier.PrivateKey, pub *paillier.PublicKey, pubs []*paillier.PublicKey) (c *ADSecret, err error) {
+// Mult computes a multiplication of two arithmetic secrets.
+// egKey is the distributed key whose public key is used by the ElGamal commitments to a and b,
+// it is needed to verify that the commitments to the shares of c agree with the product.
+// The shares of the product are computed with the given MtA backend.
+//
+// Parties whose messages fail the checks of Mult or of the backend are blamed with a sync.RoundError.
+// The final check of the product only tells whether some party cheated in a way the proofs do not catch,
+// e.g. by running the backend with other values than its committed shares. It does not tell which party,
+// so then Mult fails with an error blaming no one.
+func Mult(a, b *ADSecret, cLabel string, egKey *DKey, mta MtA) (c *ADSecret, err error) {
 	nProc := len(a.egs)
+	group := a.egf.Curve()
+	if !group.Equal(egKey.PublicKey(), a.egf.H()) {
+		return nil, fmt.Errorf("the commitments are not made with respect to the public key of egKey")
+	}
 
 	c = &ADSecret{}
+	c.pid = a.pid
 	c.label = cLabel
 	c.server = a.server
+	c.egf = a.egf
+	c.quorum = a.quorum
 
 	// Step 1. Compute a product of commitments to b
-	pid := int(a.pid)
+	order := a.egf.Curve().Order()
 	bProd := b.egf.Neutral()
 	for _, eg := range b.egs {
 		bProd.Compose(bProd, eg)
 	}
 
 	// Step 2. Run priv mult and compute the share of c
-	if c.skShare, err = PrivMult(a.skShare, b.skShare, pid, nProc, a.server, priv, pub, pubs); err != nil {
+	if c.skShare, err = mta.PrivMult(a.skShare, b.skShare, order, a.server, c.transcript); err != nil {
 		return nil, err
 	}
+	c.skShare.Mod(c.skShare, order)
 
 	// Step 3. Compute and publish an ElGamal commitment to the share of c
 	c.egs = make([]*commitment.ElGamal, nProc)
-	if c.r, err = rand.Int(randReader, Q); err != nil {
+	if c.r, err = rand.Int(randReader, order); err != nil {
 		return nil, err
 	}
 	c.egs[a.pid] = a.egf.Create(c.skShare, c.r)
 
-	toSendBuf := &bytes.Buffer{}
-	// TODO: replace the following commitment and check with EGKnow
-	egknow := zkpok.NoopZKproof{}
-	if err := egknow.Encode(toSendBuf); err != nil {
+	rid := a.server.NextRoundID()
+	egknow, err := zkpok.NewZKEGKnow(c.transcript(rid, c.pid), a.egf, c.egs[a.pid], c.skShare, c.r)
+	if err != nil {
 		return nil, err
 	}
+
+	toSendBuf := &bytes.Buffer{}
 	if err := c.egs[a.pid].Encode(toSendBuf); err != nil {
 		return nil, err
 	}
+	if err := egknow.Encode(toSendBuf); err != nil {
+		return nil, err
+	}
 
 	check := func(pid uint16, data []byte) error {
-		var egknow zkpok.NoopZKproof
 		buf := bytes.NewBuffer(data)
-		if err := egknow.Decode(buf); err != nil {
-			return fmt.Errorf("decode: egknow %v", err)
-		}
-		if !egknow.Verify() {
-			return fmt.Errorf("Wrong egknow proof")
-		}
-
 		eg := commitment.ElGamal{}
 		if err := eg.Decode(buf); err != nil {
 			return fmt.Errorf("decode: ElGamal %v", err)
 		}
 
+		var egknow zkpok.ZKEGKnow
+		if err := egknow.Decode(buf); err != nil {
+			return fmt.Errorf("decode: egknow %v", err)
+		}
+		if err := egknow.Verify(c.transcript(rid, pid), a.egf, &eg); err != nil {
+			return fmt.Errorf("Wrong egknow proof: %v", err)
+		}
+
 		c.egs[pid] = &eg
 		return nil
 	}
@@ -72,42 +94,47 @@ func Mult(a, b *ADSecret, cLabel string, priv *paillier.PrivateKey, pub *paillie
 	if err := a.server.Round([][]byte{toSendBuf.Bytes()}, check); err != nil {
 		return nil, err
 	}
+	fillNeutral(c.egs, c.egf)
 
 	// Step 4. Compute and publish an ElGamal commitment to product of b and private share of a
-	r, err := rand.Int(randReader, Q)
+	r, err := rand.Int(randReader, order)
 	if err != nil {
 		return nil, err
 	}
-	bProd.Exp(bProd, a.skShare)
-	baShareEG := a.egf.Create(big.NewInt(0), r)
-	baShareEG.Compose(bProd, baShareEG)
+	baShareEG := a.egf.Neutral()
+	baShareEG.Compose(baShareEG.Exp(bProd, a.skShare), a.egf.Create(big.NewInt(0), r))
 
-	toSendBuf.Reset()
-	// TODO: replace the following commitment and check with EGKnow
-	egexp := zkpok.NoopZKproof{}
-	if err := egexp.Encode(toSendBuf); err != nil {
+	rid = a.server.NextRoundID()
+	egexp, err := zkpok.NewZKEGExp(c.transcript(rid, c.pid), a.egf, bProd, a.egs[a.pid], baShareEG, r, a.r, a.skShare)
+	if err != nil {
 		return nil, err
 	}
+
+	toSendBuf.Reset()
 	if err := baShareEG.Encode(toSendBuf); err != nil {
 		return nil, err
 	}
+	if err := egexp.Encode(toSendBuf); err != nil {
+		return nil, err
+	}
 
 	baShareEGs := make([]*commitment.ElGamal, nProc)
+	baShareEGs[a.pid] = baShareEG
 	check = func(pid uint16, data []byte) error {
-		var egexp zkpok.NoopZKproof
 		buf := bytes.NewBuffer(data)
-		if err := egexp.Decode(buf); err != nil {
-			return fmt.Errorf("decode: egknow %v", err)
-		}
-		if !egknow.Verify() {
-			return fmt.Errorf("Wrong egknow proof")
-		}
-
 		eg := commitment.ElGamal{}
 		if err := eg.Decode(buf); err != nil {
 			return fmt.Errorf("decode: ElGamal %v", err)
 		}
 
+		var egexp zkpok.ZKEGExp
+		if err := egexp.Decode(buf); err != nil {
+			return fmt.Errorf("decode: egexp %v", err)
+		}
+		if err := egexp.Verify(c.transcript(rid, pid), a.egf, bProd, a.egs[pid], &eg); err != nil {
+			return fmt.Errorf("Wrong egexp proof: %v", err)
+		}
+
 		baShareEGs[pid] = &eg
 		return nil
 	}
@@ -116,12 +143,11 @@ func Mult(a, b *ADSecret, cLabel string, priv *paillier.PrivateKey, pub *paillie
 		return nil, err
 	}
 
-	// Step 5. Compute ElGamal commitments to a product ab and c
+	// Step 5. Compute ElGamal commitments to a product ab and c.
+	// Parties outside a quorum hold 0 as their share of a, so they add nothing to ab.
 	abEG := b.egf.Neutral()
 	for _, eg := range baShareEGs {
-		if eg == nil {
-			abEG.Compose(abEG, baShareEG)
-		} else {
+		if eg != nil {
 			abEG.Compose(abEG, eg)
 		}
 	}
@@ -132,131 +158,216 @@ func Mult(a, b *ADSecret, cLabel string, priv *paillier.PrivateKey, pub *paillie
 	}
 
 	// Step 6. Run the CheckDH procedure on E(ab)/E(c)
-	// TODO: @Jedrzej Kula
+	// E(ab)/E(c) = (g^s, h^s g^{ab-c}) is a commitment to 0 iff it is a DH triple with h = g^{egKey}.
+	// Parties sending wrong proofs in CheckDH are blamed. A failed check blames no one, as its cause cannot be attributed:
+	// the proofs of PrivMult do not bind its inputs and outputs to the commitments to a, b and c.
+	quotient := b.egf.Neutral()
+	quotient.Compose(abEG, quotient.Inverse(cEG))
+	u, v := quotient.Points()
+	if err := CheckDH(u, v, group, egKey); err != nil {
+		switch err.(type) {
+		case *sync.RoundError, *sync.TimeoutError:
+			return nil, err
+		}
+		return nil, fmt.Errorf("Step 6: the shares of c do not sum up to the product, the culprit cannot be identified: %v", err)
+	}
 
 	return c, nil
 }
 
-// PrivMult computes the product ab
-func PrivMult(a, b *big.Int, pid, nProc int, server sync.Server, priv *paillier.PrivateKey, pub *paillier.PublicKey, pubs []*paillier.PublicKey) (*big.Int, error) {
-	// For all parties with id < pid, we act as Alice in MtA for a and Act as Bob for b.
-	// For all parties with id > pid, we act as Bob in MtA for a and act as Alice for b.
+// TMult computes a multiplication of two threshold secrets with the same threshold t as a threshold secret with threshold t.
+// Only the parties in the quorum, at least t of them, take part: they multiply the additive secrets with the same values
+// as a and b with Mult, and reshare the product, which brings the degree of its sharing back to t-1.
+// egKey is the threshold key whose public key is used by the ElGamal commitments to a and b.
+func TMult(a, b *TDSecret, cLabel string, egKey *TDKey, mta MtA, quorum []uint16) (*TDSecret, error) {
+	if a.t != b.t {
+		return nil, fmt.Errorf("the thresholds of the secrets differ: %v and %v", a.t, b.t)
+	}
+	if err := checkQuorum(quorum, a.pid, len(a.egs), a.t); err != nil {
+		return nil, err
+	}
 
-	// Step 1. First round of MtA. For id < pid wait for their Enc(a') and send Enc(b), and
-	// for id > pid send Enc(a) and wait for their Enc(b').
+	server := newQuorumServer(a.server, len(a.egs), quorum)
+	aq, err := a.additive(quorum, server)
+	if err != nil {
+		return nil, err
+	}
+	bq, err := b.additive(quorum, server)
+	if err != nil {
+		return nil, err
+	}
+	key, err := egKey.additive(quorum, server)
+	if err != nil {
+		return nil, err
+	}
 
-	toSendBuf1 := make([][]byte, nProc)
-	encA, err := pub.Encrypt(a)
+	c, err := Mult(aq, bq, cLabel, key, mta)
 	if err != nil {
 		return nil, err
 	}
-	encB, err := pub.Encrypt(b)
+	return c.reshareFrom(a.t, a.server)
+}
+
+// PrivMult computes an additive share of the product of two additively shared secrets, given our shares a and b in Z_q.
+// The returned share is not reduced, the shares of all parties sum up to the product over integers.
+// Every Paillier ciphertext comes with a range proof for the ring-Pedersen parameters of its recipient,
+// which are verified with ours, rps[pid].
+func PrivMult(a, b, q *big.Int, pid, nProc int, server sync.Server, transcript func(int64, uint16) *pkg.Transcript, priv *paillier.PrivateKey, pub *paillier.PublicKey, pubs []*paillier.PublicKey, rps []*zkpok.RingPedersen) (*big.Int, error) {
+	// For every other party we act as Alice in MtA for our a and their b', and as Bob for their a' and our b.
+	// Range proofs only guarantee that a' and b' are below q*2^PaillierRangeSlack, so Bob masks a'b with a random value
+	// much bigger than such a product, and Paillier moduli have to be big enough for plaintexts never to wrap around.
+	slack := uint(zkpok.PaillierRangeSlack)
+	maskBound := new(big.Int).Mul(q, q)
+	maskBound.Lsh(maskBound, mtaSecurity+slack)
+	minN := new(big.Int).Mul(q, q)
+	minN.Lsh(minN, slack)
+	minN.Add(minN, maskBound)
+	minN.Lsh(minN, slack+1)
+	for id, pk := range pubs {
+		if pk.N.Cmp(minN) <= 0 {
+			return nil, fmt.Errorf("Paillier modulus of pid %v is too small: expected more than %v bits, got %v", id, minN.BitLen(), pk.N.BitLen())
+		}
+	}
+
+	// Step 1. First round of MtA. Send Enc(a) with a range proof to everyone and wait for their Enc(a').
+	encA, rA, err := pub.EncryptAndReturnRandomness(a)
 	if err != nil {
 		return nil, err
 	}
-	for id := range toSendBuf1 {
-		if id < pid {
-			// Bob for b
-			toSendBuf1[id] = encB.Bytes()
-		} else if id > pid {
-			// Bob for a
-			toSendBuf1[id] = encA.Bytes()
+	rid := server.NextRoundID()
+	toSend := make([][]byte, nProc)
+	for id := range toSend {
+		if id == pid {
+			continue
+		}
+		zkp, err := zkpok.NewZKPaillierRange(transcript(rid, uint16(pid)), pub, rps[id], encA, a, rA, q)
+		if err != nil {
+			return nil, err
 		}
+		buf := &bytes.Buffer{}
+		writeInt(buf, encA)
+		if err := zkp.Encode(buf); err != nil {
+			return nil, err
+		}
+		toSend[id] = buf.Bytes()
 	}
 
-	encShares := make([]*big.Int, nProc)
+	encAs := make([]*big.Int, nProc)
 	check := func(id uint16, data []byte) error {
-		if id < uint16(pid) {
-			// Alice for a
-			encShares[id] = new(big.Int).SetBytes(data)
-		} else if id > uint16(pid) {
-			// Alice for b
-			encShares[id] = new(big.Int).SetBytes(data)
+		buf := bytes.NewBuffer(data)
+		encA, err := readInt(buf)
+		if err != nil {
+			return err
 		}
-
+		var zkp zkpok.ZKPaillierRange
+		if err := zkp.Decode(buf); err != nil {
+			return fmt.Errorf("decode: range proof %v", err)
+		}
+		if err := zkp.Verify(transcript(rid, id), pubs[id], rps[pid], encA, q); err != nil {
+			return fmt.Errorf("Wrong range proof: %v", err)
+		}
+		encAs[id] = encA
 		return nil
 	}
 
-	if err := server.Round(toSendBuf1, check); err != nil {
+	if err := server.Round(toSend, check); err != nil {
 		return nil, err
 	}
 
-	// Step 2. Second round of MtA. For id < pid send Enc(aa'-t) and wait for E(bb'-t), and
-	// for id > pid wait for Enc(aa'-t) and send Enc(bb'-t).
-	myShares := make([]*big.Int, nProc) // collection of t_A
-	toSendBuf2 := make([][]byte, nProc)
-	genEncABmt := func(id int, share *big.Int) error {
-		var err error
-		encABmt, err := pubs[id].HomoMult(share, encShares[id])
+	// Step 2. Second round of MtA. Send Enc(a'b+t) with a proof of the affine operation to the owner of a' and keep -t,
+	// and wait for Enc(ab'+t') from everyone.
+	myShares := make([]*big.Int, nProc) // collection of -t
+	rid = server.NextRoundID()
+	for id := range toSend {
+		// parties outside a quorum send nothing and take no part
+		if id == pid || encAs[id] == nil {
+			toSend[id] = nil
+			continue
+		}
+		encABpt, err := pubs[id].HomoMult(b, encAs[id])
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		myShares[id], err = rand.Int(randReader, Q)
+		t, err := rand.Int(randReader, maskBound)
 		if err != nil {
-			return err
+			return nil, err
 		}
-
-		negMyShare := new(big.Int).Sub(pubs[id].N, myShares[id])
-		enc, err := pubs[id].Encrypt(negMyShare)
+		encT, rT, err := pubs[id].EncryptAndReturnRandomness(t)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		encABmt, err = pubs[id].HomoAdd(encABmt, enc)
+		if encABpt, err = pubs[id].HomoAdd(encABpt, encT); err != nil {
+			return nil, err
+		}
+		zkp, err := zkpok.NewZKPaillierAffine(transcript(rid, uint16(pid)), pubs[id], rps[id], encAs[id], encABpt, b, t, rT, q, maskBound)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		toSendBuf2[id] = encABmt.Bytes()
-
-		return nil
-	}
-
-	for id := range toSendBuf2 {
-		if id < pid {
-			// Alice for a
-			if err := genEncABmt(id, a); err != nil {
-				return nil, err
-			}
-		} else if id > pid {
-			// Alice for b
-			if err := genEncABmt(id, b); err != nil {
-				return nil, err
-			}
+		buf := &bytes.Buffer{}
+		writeInt(buf, encABpt)
+		if err := zkp.Encode(buf); err != nil {
+			return nil, err
 		}
+		toSend[id] = buf.Bytes()
+		myShares[id] = t.Neg(t)
 	}
 
-	abmts := make([]*big.Int, nProc) // collection of decrypted shares for Bob
+	abpts := make([]*big.Int, nProc) // collection of decrypted shares for Alice
 	check = func(id uint16, data []byte) error {
-		if id != uint16(pid) {
-			var err error
-			// Bob for b
-			abmts[id] = new(big.Int).SetBytes(data)
-			abmts[id].Sub(abmts[id], pub.N)
-			if abmts[id], err = priv.Decrypt(abmts[id]); err != nil {
-				return err
-			}
+		buf := bytes.NewBuffer(data)
+		encABpt, err := readInt(buf)
+		if err != nil {
+			return err
+		}
+		var zkp zkpok.ZKPaillierAffine
+		if err := zkp.Decode(buf); err != nil {
+			return fmt.Errorf("decode: affine proof %v", err)
+		}
+		if err := zkp.Verify(transcript(rid, id), pub, rps[pid], encA, encABpt, q, maskBound); err != nil {
+			return fmt.Errorf("Wrong affine proof: %v", err)
+		}
+		if abpts[id], err = priv.Decrypt(encABpt); err != nil {
+			return err
 		}
 
 		return nil
 	}
 
-	if err := server.Round(toSendBuf2, check); err != nil {
+	if err := server.Round(toSend, check); err != nil {
 		return nil, err
 	}
 
 	// Step 3. Compute a share of a product of a and b
 	share := new(big.Int).Mul(a, b)
-	for id, t := range myShares {
-		if id == pid {
+	for id := range myShares {
+		if id == pid || myShares[id] == nil || abpts[id] == nil {
 			continue
 		}
-		share.Add(share, t)
-		share.Add(share, abmts[id])
-	}
-	if len(share.Bytes()) > 32 {
-		share.Mod(share, Q)
+		share.Add(share, myShares[id])
+		share.Add(share, abpts[id])
 	}
 
 	return share, nil
 }
+
+// writeInt writes the length of x followed by its bytes
+func writeInt(buf *bytes.Buffer, x *big.Int) {
+	lenBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(lenBytes, uint32(len(x.Bytes())))
+	buf.Write(lenBytes)
+	buf.Write(x.Bytes())
+}
+
+// readInt reads an integer written by writeInt
+func readInt(buf *bytes.Buffer) (*big.Int, error) {
+	if buf.Len() < 4 {
+		return nil, fmt.Errorf("too short data %v", buf.Len())
+	}
+	l := int(binary.LittleEndian.Uint32(buf.Next(4)))
+	if l > buf.Len() {
+		return nil, fmt.Errorf("wrong length of an integer %v", l)
+	}
+	return new(big.Int).SetBytes(buf.Next(l)), nil
+}
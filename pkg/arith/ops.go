@@ -0,0 +1,159 @@
+package arith
+
+import (
+	"fmt"
+	"math/big"
+
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/commitment"
+)
+
+// Add computes locally the sum of the secrets
+func (ads *ADSecret) Add(b *ADSecret, cLabel string) (*ADSecret, error) {
+	if err := ads.compatible(b); err != nil {
+		return nil, err
+	}
+	return ads.addScaled(b, big.NewInt(1), cLabel), nil
+}
+
+// Sub computes locally the difference of the secrets
+func (ads *ADSecret) Sub(b *ADSecret, cLabel string) (*ADSecret, error) {
+	if err := ads.compatible(b); err != nil {
+		return nil, err
+	}
+	return ads.addScaled(b, big.NewInt(-1), cLabel), nil
+}
+
+// ScalarMul computes locally the secret multiplied by a public scalar alpha
+func (ads *ADSecret) ScalarMul(alpha *big.Int, cLabel string) *ADSecret {
+	order := ads.egf.Curve().Order()
+	alpha = new(big.Int).Mod(alpha, order)
+	result := ads.derive(cLabel)
+	result.skShare = new(big.Int).Mul(alpha, ads.skShare)
+	result.skShare.Mod(result.skShare, order)
+	result.r = new(big.Int).Mul(alpha, ads.r)
+	result.r.Mod(result.r, order)
+	for pid, eg := range ads.egs {
+		if eg != nil {
+			result.egs[pid] = ads.egf.Neutral().Exp(eg, alpha)
+		}
+	}
+	return result
+}
+
+// AddConst computes locally the secret plus a public constant c.
+// The constant is added to the share of the first party holding a share, and to its commitment with no randomness.
+// For a secret shared by a quorum this is the first party in the quorum, as the others hold 0.
+func (ads *ADSecret) AddConst(c *big.Int, cLabel string) *ADSecret {
+	first := 0
+	if len(ads.quorum) > 0 {
+		first = int(ads.quorum[0])
+	}
+	return ads.addConstTo(c, cLabel, func(pid int) bool { return pid == first })
+}
+
+// Add computes locally the sum of the threshold secrets, which have to have the same threshold
+func (tds *TDSecret) Add(b *TDSecret, cLabel string) (*TDSecret, error) {
+	if tds.t != b.t {
+		return nil, fmt.Errorf("the thresholds of the secrets differ: %v and %v", tds.t, b.t)
+	}
+	ads, err := tds.ADSecret.Add(&b.ADSecret, cLabel)
+	if err != nil {
+		return nil, err
+	}
+	return newTDSecret(ads, tds.t)
+}
+
+// Sub computes locally the difference of the threshold secrets, which have to have the same threshold
+func (tds *TDSecret) Sub(b *TDSecret, cLabel string) (*TDSecret, error) {
+	if tds.t != b.t {
+		return nil, fmt.Errorf("the thresholds of the secrets differ: %v and %v", tds.t, b.t)
+	}
+	ads, err := tds.ADSecret.Sub(&b.ADSecret, cLabel)
+	if err != nil {
+		return nil, err
+	}
+	return newTDSecret(ads, tds.t)
+}
+
+// ScalarMul computes locally the threshold secret multiplied by a public scalar alpha
+func (tds *TDSecret) ScalarMul(alpha *big.Int, cLabel string) *TDSecret {
+	return &TDSecret{*tds.ADSecret.ScalarMul(alpha, cLabel), tds.t}
+}
+
+// AddConst computes locally the threshold secret plus a public constant c.
+// The constant is added to the shares of all parties, which shifts the polynomial by c, and to their commitments with no randomness.
+func (tds *TDSecret) AddConst(c *big.Int, cLabel string) *TDSecret {
+	return &TDSecret{*tds.addConstTo(c, cLabel, func(int) bool { return true }), tds.t}
+}
+
+// newTDSecret returns the threshold secret with threshold t combined from threshold secrets as ads.
+// It fails if the secrets they were combined from are shared by fewer than t common parties, as they could not reveal it.
+func newTDSecret(ads *ADSecret, t uint16) (*TDSecret, error) {
+	if ads.quorum != nil && len(ads.quorum) < int(t) {
+		return nil, fmt.Errorf("the secrets combined into %v are shared by fewer than %v common parties", ads.label, t)
+	}
+	return &TDSecret{*ads, t}, nil
+}
+
+// compatible checks that the secrets are shared by the same committee with commitments under the same key
+func (ads *ADSecret) compatible(b *ADSecret) error {
+	if len(ads.egs) != len(b.egs) || ads.pid != b.pid {
+		return fmt.Errorf("the secrets %v and %v are shared by different committees", ads.label, b.label)
+	}
+	if !ads.egf.Curve().Equal(ads.egf.H(), b.egf.H()) {
+		return fmt.Errorf("the secrets %v and %v are committed to under different keys", ads.label, b.label)
+	}
+	return nil
+}
+
+// derive returns a secret with the given label shared by the same committee as ads, with no shares or commitments set
+func (ads *ADSecret) derive(cLabel string) *ADSecret {
+	result := &ADSecret{DSecret: DSecret{pid: ads.pid, label: cLabel, server: ads.server}, egf: ads.egf, quorum: ads.quorum}
+	result.egs = make([]*commitment.ElGamal, len(ads.egs))
+	return result
+}
+
+// addScaled computes locally the secret plus b multiplied by beta.
+// Commitments missing for either secret are missing for the result, which is shared by the parties sharing both.
+func (ads *ADSecret) addScaled(b *ADSecret, beta *big.Int, cLabel string) *ADSecret {
+	order := ads.egf.Curve().Order()
+	beta = new(big.Int).Mod(beta, order)
+	result := ads.derive(cLabel)
+	result.quorum = commonQuorum(ads.quorum, b.quorum)
+	result.skShare = new(big.Int).Mul(beta, b.skShare)
+	result.skShare.Add(result.skShare, ads.skShare)
+	result.skShare.Mod(result.skShare, order)
+	result.r = new(big.Int).Mul(beta, b.r)
+	result.r.Add(result.r, ads.r)
+	result.r.Mod(result.r, order)
+	for pid := range ads.egs {
+		if ads.egs[pid] != nil && b.egs[pid] != nil {
+			result.egs[pid] = ads.egf.Neutral().Exp(b.egs[pid], beta)
+			result.egs[pid].Compose(ads.egs[pid], result.egs[pid])
+		}
+	}
+	return result
+}
+
+// addConstTo computes locally the secret with c added to the shares of the parties chosen by shifted
+func (ads *ADSecret) addConstTo(c *big.Int, cLabel string, shifted func(pid int) bool) *ADSecret {
+	order := ads.egf.Curve().Order()
+	c = new(big.Int).Mod(c, order)
+	result := ads.derive(cLabel)
+	result.skShare = new(big.Int).Set(ads.skShare)
+	if shifted(int(ads.pid)) {
+		result.skShare.Add(result.skShare, c)
+		result.skShare.Mod(result.skShare, order)
+	}
+	result.r = new(big.Int).Set(ads.r)
+	for pid, eg := range ads.egs {
+		if eg == nil {
+			continue
+		}
+		result.egs[pid] = ads.egf.Neutral().Compose(ads.egf.Neutral(), eg)
+		if shifted(pid) {
+			result.egs[pid].Compose(result.egs[pid], ads.egf.Create(c, big.NewInt(0)))
+		}
+	}
+	return result
+}
@@ -0,0 +1,290 @@
+package arith
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	stdsync "sync"
+
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/ot"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/curve"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/sync"
+)
+
+// otMtA runs multiplications of Gilboa with correlated OTs extended from base OTs with every other party.
+// For every other party we are the sender of OT extension in multiplications of our a and their b',
+// and the receiver with a randomized encoding of our b in multiplications of their a' and our b.
+//
+// The sender checks the consistency of the messages of the receiver, so the receiver uses the same choice bits
+// in all base OTs. A sender may still learn whether the receiver used some choice bits by sending wrong corrections,
+// but the choice bits are statistically independent of b thanks to the randomized encoding. Wrong products are detected,
+// though not attributed to a party, in step 6 of Mult. After any failed check we stop running OTs with the offending party for good,
+// as the base OTs with it may be compromised.
+type otMtA struct {
+	pid, nProc int
+	senders    []*ot.ExtSender
+	receivers  []*ot.ExtReceiver
+	mx         stdsync.Mutex
+	aborted    []bool
+}
+
+// otRandomBits is the number of random bits in the encoding of b,
+// which makes the choice bits of the receiver statistically independent of b
+const otRandomBits = 2 * ot.Kappa
+
+// NewOTMtA runs base OTs with all other parties over the given group and returns the MtA backend based on OT extension
+func NewOTMtA(pid, nProc uint16, server sync.Server, group curve.Group) (MtA, error) {
+	om := &otMtA{
+		pid:       int(pid),
+		nProc:     int(nProc),
+		senders:   make([]*ot.ExtSender, nProc),
+		receivers: make([]*ot.ExtReceiver, nProc),
+		aborted:   make([]bool, nProc),
+	}
+
+	// Round 1: as the receiver of OT extension with a party, we are the sender in base OTs with it
+	baseSenders := make([]*ot.BaseSender, nProc)
+	toSend := make([][]byte, nProc)
+	for id := range toSend {
+		if id == om.pid {
+			continue
+		}
+		var err error
+		if baseSenders[id], err = ot.NewBaseSender(group); err != nil {
+			return nil, err
+		}
+		buf := &bytes.Buffer{}
+		if err = group.Encode(baseSenders[id].Message(), buf); err != nil {
+			return nil, err
+		}
+		toSend[id] = buf.Bytes()
+	}
+
+	ss := make([]curve.Point, nProc)
+	check := om.abortOnError(func(id uint16, data []byte) error {
+		s, err := group.Decode(bytes.NewBuffer(data))
+		if err != nil {
+			return fmt.Errorf("decode: base OT point %v", err)
+		}
+		ss[id] = s
+		return nil
+	})
+
+	if err := server.Round(toSend, check); err != nil {
+		return nil, err
+	}
+
+	// Round 2: as the sender of OT extension, we are the receiver in base OTs with random choice bits
+	for id := range toSend {
+		if id == om.pid {
+			continue
+		}
+		delta := make([]byte, ot.Kappa/8)
+		if _, err := io.ReadFull(rand.Reader, delta); err != nil {
+			return nil, err
+		}
+		rs, keys, err := ot.BaseReceive(group, ss[id], delta)
+		if err != nil {
+			return nil, err
+		}
+		om.senders[id] = ot.NewExtSender(delta, keys)
+
+		buf := &bytes.Buffer{}
+		for _, r := range rs {
+			if err = group.Encode(r, buf); err != nil {
+				return nil, err
+			}
+		}
+		toSend[id] = buf.Bytes()
+	}
+
+	check = om.abortOnError(func(id uint16, data []byte) error {
+		buf := bytes.NewBuffer(data)
+		rs := make([]curve.Point, ot.Kappa)
+		for j := range rs {
+			var err error
+			if rs[j], err = group.Decode(buf); err != nil {
+				return fmt.Errorf("decode: base OT point %v", err)
+			}
+		}
+		keys, err := baseSenders[id].Keys(rs)
+		if err != nil {
+			return err
+		}
+		om.receivers[id] = ot.NewExtReceiver(keys)
+		return nil
+	})
+
+	if err := server.Round(toSend, check); err != nil {
+		return nil, err
+	}
+
+	return om, nil
+}
+
+// PrivMult implements MtA. The transcript is not used, as OT extension comes with no proofs.
+func (om *otMtA) PrivMult(a, b, q *big.Int, server sync.Server, transcript func(int64, uint16) *pkg.Transcript) (*big.Int, error) {
+	gadget := otGadget(q)
+	n := len(gadget)
+	choices, err := otEncode(new(big.Int).Mod(b, q), q, gadget)
+	if err != nil {
+		return nil, err
+	}
+	deltas := make([]*big.Int, n)
+	for i := range deltas {
+		deltas[i] = new(big.Int).Mod(a, q)
+	}
+
+	// Step 1. Send the message of the receiver of OT extension with the encoding of b to everyone
+	// and compute our pads and corrections for the correlation a as the sender.
+	// the nonce is unique for every extension, as rounds of every session are run one at a time
+	nonce := make([]byte, 16)
+	binary.LittleEndian.PutUint64(nonce[:8], server.SessionID())
+	binary.LittleEndian.PutUint64(nonce[8:], uint64(server.NextRoundID()))
+
+	rows := make([][][]byte, om.nProc)
+	toSend := make([][]byte, om.nProc)
+	for id := range toSend {
+		if id == om.pid || om.isAborted(id) {
+			continue
+		}
+		msg, t, err := om.receivers[id].Extend(nonce, choices, n)
+		if err != nil {
+			return nil, err
+		}
+		rows[id] = t
+		buf := &bytes.Buffer{}
+		if err = msg.Encode(buf); err != nil {
+			return nil, err
+		}
+		toSend[id] = buf.Bytes()
+	}
+
+	pads := make([][]*big.Int, om.nProc)
+	corrections := make([][]*big.Int, om.nProc)
+	check := om.abortOnError(func(id uint16, data []byte) error {
+		msg := &ot.ExtMessage{}
+		if err := msg.Decode(bytes.NewBuffer(data)); err != nil {
+			return fmt.Errorf("decode: OT extension message %v", err)
+		}
+		var err error
+		pads[id], corrections[id], err = om.senders[id].SendCorrelated(nonce, msg, deltas, q)
+		return err
+	})
+
+	if err := server.Round(toSend, check); err != nil {
+		return nil, err
+	}
+
+	// Step 2. Send the corrections to everyone and obtain our outputs as the receiver
+	for id := range toSend {
+		if id == om.pid || corrections[id] == nil {
+			continue
+		}
+		buf := &bytes.Buffer{}
+		for _, c := range corrections[id] {
+			writeInt(buf, c)
+		}
+		toSend[id] = buf.Bytes()
+	}
+
+	outputs := make([][]*big.Int, om.nProc)
+	check = om.abortOnError(func(id uint16, data []byte) error {
+		buf := bytes.NewBuffer(data)
+		corrections := make([]*big.Int, n)
+		for i := range corrections {
+			var err error
+			if corrections[i], err = readInt(buf); err != nil {
+				return err
+			}
+		}
+		var err error
+		outputs[id], err = om.receivers[id].ReceiveCorrelated(nonce, rows[id], choices, corrections, q)
+		return err
+	})
+
+	if err := server.Round(toSend, check); err != nil {
+		return nil, err
+	}
+
+	// Step 3. Compute a share of the product of a and b: sum_i g_i (output_i - pad_i) over all other parties plus ab
+	share := new(big.Int).Mul(a, b)
+	term := new(big.Int)
+	for id := range outputs {
+		// parties outside a quorum send nothing and take no part
+		if id == om.pid || outputs[id] == nil || pads[id] == nil {
+			continue
+		}
+		for i := 0; i < n; i++ {
+			term.Sub(outputs[id][i], pads[id][i])
+			term.Mul(term, gadget[i])
+			share.Add(share, term)
+		}
+	}
+	return share.Mod(share, q), nil
+}
+
+// isAborted tells whether we stopped running OTs with the given party
+func (om *otMtA) isAborted(id int) bool {
+	om.mx.Lock()
+	defer om.mx.Unlock()
+	return om.aborted[id]
+}
+
+// abortOnError wraps a check, so that a party that failed a check once fails all later checks
+func (om *otMtA) abortOnError(check func(uint16, []byte) error) func(uint16, []byte) error {
+	return func(id uint16, data []byte) error {
+		if om.isAborted(int(id)) {
+			return fmt.Errorf("OTs with %v were aborted after a failed check", id)
+		}
+		if err := check(id, data); err != nil {
+			om.mx.Lock()
+			om.aborted[id] = true
+			om.mx.Unlock()
+			return err
+		}
+		return nil
+	}
+}
+
+// otGadget returns the public vector g, such that b = sum_i g_i w_i for the encoding w of b:
+// the powers of 2 for the bits of b followed by otRandomBits pseudorandom elements of Z_q
+func otGadget(q *big.Int) []*big.Int {
+	m := q.BitLen()
+	gadget := make([]*big.Int, m+otRandomBits)
+	for i := 0; i < m; i++ {
+		gadget[i] = new(big.Int).Lsh(big.NewInt(1), uint(i))
+	}
+	label := make([]byte, 8)
+	for i := m; i < len(gadget); i++ {
+		binary.LittleEndian.PutUint64(label, uint64(i))
+		gadget[i] = pkg.HashToBigInt(append([]byte("otMtA_gadget"), label...), q)
+	}
+	return gadget
+}
+
+// otEncode returns the bits of a random encoding w of b with respect to the gadget: random bits at the positions
+// of the pseudorandom elements, and the bits of b - sum_j g_j w_j over them at the first positions
+func otEncode(b, q *big.Int, gadget []*big.Int) ([]byte, error) {
+	m := q.BitLen()
+	w := make([]byte, (len(gadget)+7)/8)
+	if _, err := io.ReadFull(rand.Reader, w); err != nil {
+		return nil, err
+	}
+	rest := new(big.Int).Set(b)
+	for i := m; i < len(gadget); i++ {
+		if (w[i/8]>>uint(i%8))&1 == 1 {
+			rest.Sub(rest, gadget[i])
+		}
+	}
+	rest.Mod(rest, q)
+	for i := 0; i < m; i++ {
+		w[i/8] &^= 1 << uint(i%8)
+		w[i/8] |= byte(rest.Bit(i)) << uint(i%8)
+	}
+	return w, nil
+}
@@ -5,7 +5,14 @@ import (
 	"math/big"
 )
 
+// lagrangeCoef computes the Lagrange coefficient of the party index for the value at 0.
+// Parties are given by their pids, and the party pid evaluates the polynomial at pid+1.
 func lagrangeCoef(index *big.Int, args []*big.Int, groupOrd *big.Int) *big.Int {
+	return lagrangeCoefAt(big.NewInt(0), index, args, groupOrd)
+}
+
+// lagrangeCoefAt computes the Lagrange coefficient of the party index for the value at x
+func lagrangeCoefAt(x, index *big.Int, args []*big.Int, groupOrd *big.Int) *big.Int {
 	num := big.NewInt(1)
 	den := big.NewInt(1)
 	for _, arg := range args {
@@ -14,7 +21,7 @@ func lagrangeCoef(index *big.Int, args []*big.Int, groupOrd *big.Int) *big.Int {
 
 		}
 		partialNum := new(big.Int).Add(arg, big.NewInt(1))
-		partialNum.Neg(partialNum)
+		partialNum.Sub(x, partialNum)
 		partialDen := new(big.Int).Sub(index, arg)
 
 		num.Mul(num, partialNum)
@@ -28,7 +35,8 @@ func lagrangeCoef(index *big.Int, args []*big.Int, groupOrd *big.Int) *big.Int {
 	return num
 }
 
-func poly(deg uint16, a0 *big.Int) ([]*big.Int, error) {
+// poly returns coefficients of a random polynomial of degree deg over Z_q with the constant term a0
+func poly(deg uint16, a0 *big.Int, q *big.Int) ([]*big.Int, error) {
 	var err error
 	f := make([]*big.Int, deg+1)
 	for i := range f {
@@ -38,7 +46,7 @@ func poly(deg uint16, a0 *big.Int) ([]*big.Int, error) {
 		}
 		if i == int(deg) {
 			tmp := big.NewInt(1)
-			tmp.Sub(Q, tmp)
+			tmp.Sub(q, tmp)
 			if f[i], err = rand.Int(randReader, tmp); err != nil {
 				return nil, err
 			}
@@ -47,7 +55,7 @@ func poly(deg uint16, a0 *big.Int) ([]*big.Int, error) {
 
 			continue
 		}
-		if f[i], err = rand.Int(randReader, Q); err != nil {
+		if f[i], err = rand.Int(randReader, q); err != nil {
 			return nil, err
 		}
 	}
@@ -0,0 +1,270 @@
+package arith
+
+import (
+	"math/big"
+	"math/rand"
+
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/curve"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Polynomials", func() {
+
+	var (
+		order *big.Int
+		rnd   *rand.Rand
+	)
+
+	BeforeEach(func() {
+		order = curve.NewSecp256k1Group().Order()
+		rnd = rand.New(rand.NewSource(1729))
+	})
+
+	evaluate := func(f []*big.Int, nProc int) []*big.Int {
+		evals := make([]*big.Int, nProc)
+		for i := range evals {
+			evals[i] = polyEval(f, big.NewInt(int64(i+1)), order)
+		}
+		return evals
+	}
+
+	Describe("Sampling with poly", func() {
+
+		It("Should sample coefficients modulo the group order", func() {
+			for deg := uint16(1); deg < 10; deg++ {
+				a0 := new(big.Int).Rand(rnd, order)
+				f, err := poly(deg, a0, order)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(f).To(HaveLen(int(deg) + 1))
+				Expect(f[0]).To(Equal(a0))
+				for _, c := range f {
+					Expect(c.Sign()).To(BeNumerically(">=", 0))
+					Expect(c.Cmp(order)).To(Equal(-1))
+				}
+				Expect(f[deg].Sign()).To(Equal(1))
+			}
+		})
+	})
+
+	Describe("Lagrange coefficients", func() {
+
+		It("Should sum up to one modulo the group order", func() {
+			args := make([]*big.Int, 7)
+			for i := range args {
+				args[i] = big.NewInt(int64(3 * i))
+			}
+			sum := big.NewInt(0)
+			for _, arg := range args {
+				sum.Add(sum, lagrangeCoef(arg, args, order))
+			}
+			Expect(sum.Mod(sum, order)).To(Equal(big.NewInt(1)))
+		})
+	})
+
+	Describe("Decoding with decode", func() {
+
+		var (
+			nProc int
+			t     uint16
+		)
+
+		BeforeEach(func() {
+			nProc = 10
+			t = 4
+		})
+
+		It("Should recover the constant term from shares", func() {
+			a0 := new(big.Int).Rand(rnd, order)
+			f, err := poly(t-1, a0, order)
+			Expect(err).NotTo(HaveOccurred())
+			evals := evaluate(f, nProc)
+
+			result, culprits, err := decode(evals, t, order)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(culprits).To(BeEmpty())
+			Expect(result).To(Equal(a0))
+		})
+
+		It("Should recover the constant term from any t shares", func() {
+			a0 := new(big.Int).Rand(rnd, order)
+			f, err := poly(t-1, a0, order)
+			Expect(err).NotTo(HaveOccurred())
+			evals := evaluate(f, nProc)
+
+			for _, i := range rnd.Perm(nProc)[:nProc-int(t)] {
+				evals[i] = nil
+			}
+			result, culprits, err := decode(evals, t, order)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(culprits).To(BeEmpty())
+			Expect(result).To(Equal(a0))
+		})
+
+		It("Should reduce the constant term modulo the group order", func() {
+			a0 := new(big.Int).Add(order, big.NewInt(1729))
+			f, err := poly(t-1, a0, order)
+			Expect(err).NotTo(HaveOccurred())
+			evals := evaluate(f, nProc)
+
+			result, culprits, err := decode(evals, t, order)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(culprits).To(BeEmpty())
+			Expect(result).To(Equal(big.NewInt(1729)))
+		})
+
+		It("Should fail on too few shares", func() {
+			a0 := new(big.Int).Rand(rnd, order)
+			f, err := poly(t-1, a0, order)
+			Expect(err).NotTo(HaveOccurred())
+			evals := evaluate(f, nProc)
+
+			for i := int(t) - 1; i < nProc; i++ {
+				evals[i] = nil
+			}
+			_, _, err = decode(evals, t, order)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should correct up to (m-t)/2 corrupted shares and identify them", func() {
+			for nErr := 0; nErr <= (nProc-int(t))/2; nErr++ {
+				a0 := new(big.Int).Rand(rnd, order)
+				f, err := poly(t-1, a0, order)
+				Expect(err).NotTo(HaveOccurred())
+				evals := evaluate(f, nProc)
+
+				corrupted := rnd.Perm(nProc)[:nErr]
+				expected := make([]uint16, 0, nErr)
+				for i := 0; i < nProc; i++ {
+					for _, j := range corrupted {
+						if i == j {
+							evals[i] = new(big.Int).Rand(rnd, order)
+							expected = append(expected, uint16(i))
+						}
+					}
+				}
+
+				result, culprits, err := decode(evals, t, order)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal(a0))
+				Expect(culprits).To(Equal(expected))
+			}
+		})
+
+		It("Should correct corrupted shares when some shares are missing", func() {
+			a0 := new(big.Int).Rand(rnd, order)
+			f, err := poly(t-1, a0, order)
+			Expect(err).NotTo(HaveOccurred())
+			evals := evaluate(f, nProc)
+			evals[0], evals[5] = nil, nil
+			evals[3] = new(big.Int).Add(evals[3], big.NewInt(1))
+
+			result, culprits, err := decode(evals, t, order)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(a0))
+			Expect(culprits).To(Equal([]uint16{3}))
+		})
+
+		It("Should fail on too many corrupted shares", func() {
+			a0 := new(big.Int).Rand(rnd, order)
+			f, err := poly(t-1, a0, order)
+			Expect(err).NotTo(HaveOccurred())
+			evals := evaluate(f, nProc)
+			for _, i := range rnd.Perm(nProc)[:(nProc-int(t))/2+1] {
+				evals[i] = new(big.Int).Rand(rnd, order)
+			}
+
+			_, _, err = decode(evals, t, order)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Decoding in the exponent with decodeInExp", func() {
+
+		var (
+			group curve.Group
+			nProc int
+			t     uint16
+		)
+
+		BeforeEach(func() {
+			group = curve.NewSecp256k1Group()
+			nProc = 7
+			t = 3
+		})
+
+		evaluateInExp := func(f []*big.Int) []curve.Point {
+			evals := make([]curve.Point, nProc)
+			for i, eval := range evaluate(f, nProc) {
+				evals[i] = group.ScalarBaseMult(eval)
+			}
+			return evals
+		}
+
+		It("Should recover g to the constant term from any t shares", func() {
+			a0 := new(big.Int).Rand(rnd, order)
+			f, err := poly(t-1, a0, order)
+			Expect(err).NotTo(HaveOccurred())
+			evals := evaluateInExp(f)
+			for _, i := range rnd.Perm(nProc)[:nProc-int(t)] {
+				evals[i] = nil
+			}
+
+			result, culprits, err := decodeInExp(group, evals, t)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(culprits).To(BeEmpty())
+			Expect(group.Equal(result, group.ScalarBaseMult(a0))).To(BeTrue())
+		})
+
+		It("Should correct up to (m-t)/2 corrupted shares and identify them", func() {
+			a0 := new(big.Int).Rand(rnd, order)
+			f, err := poly(t-1, a0, order)
+			Expect(err).NotTo(HaveOccurred())
+			evals := evaluateInExp(f)
+			evals[0] = group.Add(evals[0], group.Gen())
+			evals[4] = group.ScalarBaseMult(big.NewInt(1729))
+
+			result, culprits, err := decodeInExp(group, evals, t)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(culprits).To(Equal([]uint16{0, 4}))
+			Expect(group.Equal(result, group.ScalarBaseMult(a0))).To(BeTrue())
+		})
+
+		It("Should fail on too many corrupted shares", func() {
+			a0 := new(big.Int).Rand(rnd, order)
+			f, err := poly(t-1, a0, order)
+			Expect(err).NotTo(HaveOccurred())
+			evals := evaluateInExp(f)
+			for _, i := range []int{1, 2, 6} {
+				evals[i] = group.Add(evals[i], group.Gen())
+			}
+
+			_, _, err = decodeInExp(group, evals, t)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should correct at most maxErrorsInExp corrupted shares", func() {
+			t = 1
+			a0 := new(big.Int).Rand(rnd, order)
+			f, err := poly(t-1, a0, order)
+			Expect(err).NotTo(HaveOccurred())
+			evals := evaluateInExp(f)
+			culprits := []uint16{}
+			for i := 0; i <= maxErrorsInExp; i++ {
+				evals[i] = group.Add(evals[i], group.Gen())
+				culprits = append(culprits, uint16(i))
+			}
+			Expect(len(culprits)).To(BeNumerically("<=", (nProc-int(t))/2))
+
+			_, _, err = decodeInExp(group, evals, t)
+			Expect(err).To(HaveOccurred())
+
+			evals[0] = group.ScalarBaseMult(a0)
+			result, found, err := decodeInExp(group, evals, t)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(Equal(culprits[1:]))
+			Expect(group.Equal(result, group.ScalarBaseMult(a0))).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,240 @@
+package arith
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/commitment"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/curve"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/sync"
+)
+
+// quorumServer runs rounds in which only the parties in a quorum take part.
+// Data of the other parties is ignored, and a round fails only if some party in the quorum is missing or sent wrong data.
+type quorumServer struct {
+	sync.Server
+	inQuorum []bool
+}
+
+// newQuorumServer returns a server running rounds among the given parties over server
+func newQuorumServer(server sync.Server, nProc int, quorum []uint16) *quorumServer {
+	inQuorum := make([]bool, nProc)
+	for _, pid := range quorum {
+		inQuorum[pid] = true
+	}
+	return &quorumServer{server, inQuorum}
+}
+
+// Round runs a round completing as soon as the data of all parties in the quorum has passed check,
+// so it does not wait for the data of the others.
+func (qs *quorumServer) Round(toSend [][]byte, check func(uint16, []byte) error) error {
+	size := uint16(0)
+	for _, in := range qs.inQuorum {
+		if in {
+			size++
+		}
+	}
+	_, err := qs.Server.QuorumRound(qs.toQuorum(toSend), qs.inQuorumCheck(check), size)
+	return qs.filter(err)
+}
+
+// QuorumRound runs a round completing as soon as the data of quorum parties in the quorum of the server has passed check.
+// Data of the other parties is ignored, and only the parties in the quorum of the server are reported as laggards.
+func (qs *quorumServer) QuorumRound(toSend [][]byte, check func(uint16, []byte) error, quorum uint16) ([]uint16, error) {
+	laggards, err := qs.Server.QuorumRound(qs.toQuorum(toSend), qs.inQuorumCheck(check), quorum)
+	if err != nil {
+		return nil, err
+	}
+	inQuorum := []uint16{}
+	for _, pid := range laggards {
+		if qs.inQuorum[pid] {
+			inQuorum = append(inQuorum, pid)
+		}
+	}
+	return inQuorum, nil
+}
+
+func (qs *quorumServer) WithContext(ctx context.Context) sync.Server {
+	return &quorumServer{qs.Server.WithContext(ctx), qs.inQuorum}
+}
+
+// toQuorum returns the data to send to the parties in the quorum only, so that the others,
+// which do not run the round, are not sent data they would never take
+func (qs *quorumServer) toQuorum(toSend [][]byte) [][]byte {
+	perParty := make([][]byte, len(qs.inQuorum))
+	for pid, in := range qs.inQuorum {
+		if !in {
+			continue
+		}
+		if len(toSend) == 1 {
+			perParty[pid] = toSend[0]
+		} else {
+			perParty[pid] = toSend[pid]
+		}
+		// nil is not sent at all, and parties in the quorum have to get something
+		if perParty[pid] == nil {
+			perParty[pid] = []byte{}
+		}
+	}
+	return perParty
+}
+
+// errOutsideQuorum is returned by checks of data sent by parties outside the quorum, so that they do not count towards it
+var errOutsideQuorum = fmt.Errorf("the party is outside the quorum")
+
+// inQuorumCheck runs check only for the parties in the quorum and returns errOutsideQuorum for the others
+func (qs *quorumServer) inQuorumCheck(check func(uint16, []byte) error) func(uint16, []byte) error {
+	return func(pid uint16, data []byte) error {
+		if !qs.inQuorum[pid] {
+			return errOutsideQuorum
+		}
+		return check(pid, data)
+	}
+}
+
+// filter drops a RoundError or a TimeoutError caused only by the parties outside the quorum
+func (qs *quorumServer) filter(err error) error {
+	var missing []uint16
+	switch rErr := err.(type) {
+	case *sync.RoundError:
+		missing = rErr.Missing()
+	case *sync.TimeoutError:
+		missing = rErr.Unresponsive()
+	default:
+		return err
+	}
+	for _, pid := range missing {
+		if qs.inQuorum[pid] {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkQuorum checks that the quorum consists of at least t distinct parties including pid
+func checkQuorum(quorum []uint16, pid uint16, nProc int, t uint16) error {
+	seen := make([]bool, nProc)
+	for _, id := range quorum {
+		if int(id) >= nProc {
+			return fmt.Errorf("pid %v in the quorum is out of range", id)
+		}
+		if seen[id] {
+			return fmt.Errorf("pid %v appears in the quorum twice", id)
+		}
+		seen[id] = true
+	}
+	if !seen[pid] {
+		return fmt.Errorf("pid %v is not in the quorum", pid)
+	}
+	if len(quorum) < int(t) {
+		return fmt.Errorf("the quorum of %v parties is smaller than the threshold %v", len(quorum), t)
+	}
+	return nil
+}
+
+// sortedQuorum returns a copy of the quorum in increasing order
+func sortedQuorum(quorum []uint16) []uint16 {
+	sorted := append([]uint16{}, quorum...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// commonQuorum returns the parties in both sorted quorums, where nil stands for all parties
+func commonQuorum(a, b []uint16) []uint16 {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	common := []uint16{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			common = append(common, a[i])
+			i++
+			j++
+		}
+	}
+	return common
+}
+
+// quorumCoefs returns the Lagrange coefficients at 0 of the parties in the quorum
+func quorumCoefs(quorum []uint16, order *big.Int) map[uint16]*big.Int {
+	args := make([]*big.Int, len(quorum))
+	for i, pid := range quorum {
+		args[i] = big.NewInt(int64(pid))
+	}
+	coefs := make(map[uint16]*big.Int, len(quorum))
+	for i, pid := range quorum {
+		coefs[pid] = lagrangeCoef(args[i], args, order)
+	}
+	return coefs
+}
+
+// additive computes locally the additive secret with the same value shared by the parties in the quorum,
+// i.e. their shares multiplied by their Lagrange coefficients at 0. The other parties hold 0 with neutral commitments.
+// The resulting secret runs rounds with server.
+func (tds *TDSecret) additive(quorum []uint16, server sync.Server) (*ADSecret, error) {
+	order := tds.egf.Curve().Order()
+	coefs := quorumCoefs(quorum, order)
+
+	ads := &ADSecret{DSecret: DSecret{pid: tds.pid, label: tds.label, server: server}, egf: tds.egf, quorum: sortedQuorum(quorum)}
+	ads.skShare = new(big.Int).Mul(coefs[tds.pid], tds.skShare)
+	ads.skShare.Mod(ads.skShare, order)
+	ads.r = new(big.Int).Mul(coefs[tds.pid], tds.r)
+	ads.r.Mod(ads.r, order)
+	ads.egs = make([]*commitment.ElGamal, len(tds.egs))
+	for pid := range ads.egs {
+		coef, ok := coefs[uint16(pid)]
+		if !ok {
+			ads.egs[pid] = tds.egf.Neutral()
+			continue
+		}
+		if tds.egs[pid] == nil {
+			return nil, fmt.Errorf("missing commitment to the share of pid %v", pid)
+		}
+		ads.egs[pid] = tds.egf.Neutral().Exp(tds.egs[pid], coef)
+	}
+	return ads, nil
+}
+
+// additive computes locally the additive key with the same public key shared by the parties in the quorum,
+// as TDSecret.additive does for secrets. The resulting key runs rounds with server.
+func (tdk *TDKey) additive(quorum []uint16, server sync.Server) (*DKey, error) {
+	group := tdk.secret.egf.Curve()
+	coefs := quorumCoefs(quorum, group.Order())
+
+	skShare := new(big.Int).Mul(coefs[tdk.secret.pid], tdk.secret.skShare)
+	skShare.Mod(skShare, group.Order())
+	pkShares := make([]curve.Point, len(tdk.pkShares))
+	for pid := range pkShares {
+		coef, ok := coefs[uint16(pid)]
+		if !ok {
+			pkShares[pid] = group.Neutral()
+			continue
+		}
+		if tdk.pkShares[pid] == nil {
+			return nil, fmt.Errorf("missing public key share of pid %v", pid)
+		}
+		pkShares[pid] = group.ScalarMult(tdk.pkShares[pid], coef)
+	}
+	return NewDKey(NewDSecret(tdk.secret.pid, tdk.secret.label, skShare, server), pkShares, group), nil
+}
+
+// reshareFrom reshares the secret, which is additively shared by the parties in a quorum, with threshold t.
+// The result is shared by the same quorum, and runs later rounds with server, restricted to the quorum where needed.
+func (ads *ADSecret) reshareFrom(t uint16, server sync.Server) (*TDSecret, error) {
+	tds, err := ads.Reshare(t)
+	if err != nil {
+		return nil, err
+	}
+	tds.server = server
+	return tds, nil
+}
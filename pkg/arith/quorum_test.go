@@ -0,0 +1,99 @@
+package arith
+
+import (
+	"context"
+	"math/big"
+	"math/rand"
+
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/commitment"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/curve"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// localServer stands for a server of secrets which are only combined locally, and may wrap another one
+type localServer struct {
+	sync.Server
+}
+
+func (ls localServer) WithContext(context.Context) sync.Server {
+	return ls
+}
+
+var _ = Describe("Secrets shared by a quorum", func() {
+
+	const (
+		nProc = 4
+		t     = 2
+	)
+
+	var (
+		order  *big.Int
+		egf    *commitment.ElGamalFactory
+		value  *big.Int
+		quorum []uint16
+		tds    []*TDSecret
+	)
+
+	BeforeEach(func() {
+		rnd := rand.New(rand.NewSource(1729))
+		group := curve.NewSecp256k1Group()
+		order = group.Order()
+		egf = commitment.NewElGamalFactory(group.ScalarBaseMult(big.NewInt(rnd.Int63())))
+		value = new(big.Int).Rand(rnd, order)
+		quorum = []uint16{3, 1}
+
+		f := []*big.Int{value, new(big.Int).Rand(rnd, order)}
+		egs := make([]*commitment.ElGamal, nProc)
+		tds = make([]*TDSecret, nProc)
+		for pid := range tds {
+			share := polyEval(f, big.NewInt(int64(pid+1)), order)
+			r := new(big.Int).Rand(rnd, order)
+			egs[pid] = egf.Create(share, r)
+			tds[pid] = &TDSecret{ADSecret{DSecret: DSecret{pid: uint16(pid), label: "x", skShare: share, server: localServer{}}, r: r, egf: egf, egs: egs}, t}
+		}
+	})
+
+	// sum returns the sum of the shares of the parties in the quorum and checks it against the product of their commitments
+	sum := func(ads []*ADSecret) *big.Int {
+		total, r := big.NewInt(0), big.NewInt(0)
+		for _, pid := range quorum {
+			total.Add(total, ads[pid].skShare)
+			r.Add(r, ads[pid].r)
+		}
+		comm := egf.Neutral()
+		for _, eg := range ads[quorum[0]].egs {
+			comm.Compose(comm, eg)
+		}
+		Expect(comm.Equal(comm, egf.Create(total, r))).To(BeTrue())
+		return total.Mod(total, order)
+	}
+
+	It("Should add a constant once, also to a secret running rounds with a context over a wrapped server", func() {
+		c := big.NewInt(7)
+		shifted := make([]*ADSecret, nProc)
+		for _, pid := range quorum {
+			ads, err := tds[pid].additive(quorum, localServer{newQuorumServer(tds[pid].server, nProc, quorum)})
+			Expect(err).NotTo(HaveOccurred())
+			shifted[pid] = ads.WithContext(context.Background()).ScalarMul(big.NewInt(1), "y").AddConst(c, "z")
+		}
+		Expect(sum(shifted)).To(Equal(new(big.Int).Mod(new(big.Int).Add(value, c), order)))
+	})
+
+	It("Should combine secrets into one shared by the parties sharing all of them", func() {
+		x, y := tds[1].ADSecret, tds[1].ADSecret
+		x.quorum, y.quorum = []uint16{0, 1, 3}, []uint16{1, 2, 3}
+		sum, err := Lin([]*big.Int{big.NewInt(1), big.NewInt(1)}, []*TDSecret{{x, t}, {y, t}}, "sum")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sum.quorum).To(Equal([]uint16{1, 3}))
+		sum, err = tds[1].Add(&TDSecret{x, t}, "sum")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sum.quorum).To(Equal(x.quorum))
+
+		y.quorum = []uint16{1, 2}
+		_, err = Lin([]*big.Int{big.NewInt(1), big.NewInt(1)}, []*TDSecret{{x, t}, {y, t}}, "sum")
+		Expect(err).To(MatchError(ContainSubstring("fewer than 2 common parties")))
+	})
+})
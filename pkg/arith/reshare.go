@@ -25,7 +25,8 @@ func (ads *ADSecret) Reshare(t uint16) (*TDSecret, error) {
 	// STEP 1. Publish a proof of knowledge of ads.skShare and ads.r
 	toSend := [][]byte{nil}
 	toSendBuf := &bytes.Buffer{}
-	secretEGKnow, err := zkpok.NewZKEGKnow(ads.egf, ads.egs[ads.pid], ads.skShare, ads.r)
+	rid := ads.server.NextRoundID()
+	secretEGKnow, err := zkpok.NewZKEGKnow(ads.transcript(rid, ads.pid), ads.egf, ads.egs[ads.pid], ads.skShare, ads.r)
 	if err != nil {
 		return nil, err
 	}
@@ -39,7 +40,7 @@ func (ads *ADSecret) Reshare(t uint16) (*TDSecret, error) {
 		if err := egknow.Decode(buf); err != nil {
 			return fmt.Errorf("STEP 1: decode: egknow %v", err)
 		}
-		if err := egknow.Verify(ads.egf, ads.egs[pid]); err != nil {
+		if err := egknow.Verify(ads.transcript(rid, pid), ads.egf, ads.egs[pid]); err != nil {
 			return fmt.Errorf("STEP 1: Wrong egknow proof: %v", err)
 		}
 
@@ -55,12 +56,14 @@ func (ads *ADSecret) Reshare(t uint16) (*TDSecret, error) {
 	// STEP 2. Pick a random polynomial f of degree t such that f(0) = ads.skShare
 
 	var f []*big.Int
-	if f, err = poly(t-1, ads.skShare); err != nil {
+	if f, err = poly(t-1, ads.skShare, ads.egf.Curve().Order()); err != nil {
 		return nil, err
 	}
 
 	// STEP 3. Compute commitments to coefs of f, EGKnow, and EGRefresh
+	// The proofs are bound to the round of Step 4, in which we commit to them.
 
+	coefRid := ads.server.NextRoundID()
 	var egrefresh *zkpok.ZKEGRefresh
 	coefComms := make([]*commitment.ElGamal, t)
 	coefEGKnows := make([]*zkpok.ZKEGKnow, t)
@@ -81,11 +84,11 @@ func (ads *ADSecret) Reshare(t uint16) (*TDSecret, error) {
 			effectiveCoefRands[i].Add(coefRands[i], ads.r)
 			effectiveCoefRands[i].Mod(effectiveCoefRands[i], order)
 
-			coefEGKnows[i], err = zkpok.NewZKEGKnow(ads.egf, coefComms[i], f[i], effectiveCoefRands[i])
+			coefEGKnows[i], err = zkpok.NewZKEGKnow(ads.transcript(coefRid, ads.pid), ads.egf, coefComms[i], f[i], effectiveCoefRands[i])
 			if err != nil {
 				return nil, err
 			}
-			egrefresh, err = zkpok.NewZKEGRefresh(ads.egf, ads.egs[ads.pid], coefComms[i], coefRands[i])
+			egrefresh, err = zkpok.NewZKEGRefresh(ads.transcript(coefRid, ads.pid), ads.egf, ads.egs[ads.pid], coefComms[i], coefRands[i])
 			if err != nil {
 				return nil, err
 			}
@@ -93,7 +96,7 @@ func (ads *ADSecret) Reshare(t uint16) (*TDSecret, error) {
 		}
 		effectiveCoefRands[i] = coefRands[i]
 		coefComms[i] = ads.egf.Create(f[i], coefRands[i])
-		coefEGKnows[i], err = zkpok.NewZKEGKnow(ads.egf, coefComms[i], f[i], effectiveCoefRands[i])
+		coefEGKnows[i], err = zkpok.NewZKEGKnow(ads.transcript(coefRid, ads.pid), ads.egf, coefComms[i], f[i], effectiveCoefRands[i])
 		if err != nil {
 			return nil, err
 		}
@@ -101,49 +104,35 @@ func (ads *ADSecret) Reshare(t uint16) (*TDSecret, error) {
 
 	// STEP 4. Commit to values from Step 3.
 
-	// TODO: build proper NMC
-	buildNMC := func(coefComms []*commitment.ElGamal, coefEGKnows []*zkpok.ZKEGKnow, egrefresh *zkpok.ZKEGRefresh) (*NMCtmp, error) {
-		dataBuf, zkpBuf := &bytes.Buffer{}, &bytes.Buffer{}
-		for _, c := range coefComms {
-			if err := c.Encode(dataBuf); err != nil {
-				return nil, err
-			}
-		}
-
-		for _, z := range coefEGKnows {
-			if err := z.Encode(zkpBuf); err != nil {
-				return nil, err
-			}
+	toSendBuf.Reset()
+	for _, c := range coefComms {
+		if err := c.Encode(toSendBuf); err != nil {
+			return nil, err
 		}
-
-		if err := egrefresh.Encode(zkpBuf); err != nil {
+	}
+	for _, z := range coefEGKnows {
+		if err := z.Encode(toSendBuf); err != nil {
 			return nil, err
 		}
-
-		// TODO: build actual nmc
-		nmc := &NMCtmp{dataBuf.Bytes(), zkpBuf.Bytes()}
-
-		return nmc, nil
-
 	}
-	nmc, err := buildNMC(coefComms, coefEGKnows, egrefresh)
-	if err != nil {
+	if err := egrefresh.Encode(toSendBuf); err != nil {
 		return nil, err
 	}
+	payload := append([]byte{}, toSendBuf.Bytes()...)
 
+	comm, rnd, err := commitment.NewHashCommitment(ads.session(coefRid), ads.pid, payload)
+	if err != nil {
+		return nil, err
+	}
 	toSendBuf.Reset()
-	if err := nmc.encode(toSendBuf); err != nil {
+	if err := comm.Encode(toSendBuf); err != nil {
 		return nil, err
 	}
 
-	nmcs := make([]*NMCtmp, nProc)
+	comms := make([]*commitment.HashCommitment, nProc)
 	check = func(pid uint16, data []byte) error {
-		buf := bytes.NewBuffer(data)
-		nmcs[pid] = &NMCtmp{}
-		if err := nmcs[pid].decode(buf); err != nil {
-			return err
-		}
-		return nil
+		comms[pid] = &commitment.HashCommitment{}
+		return comms[pid].Decode(bytes.NewBuffer(data))
 	}
 
 	toSend[0] = toSendBuf.Bytes()
@@ -153,24 +142,13 @@ func (ads *ADSecret) Reshare(t uint16) (*TDSecret, error) {
 
 	// STEP 5. Decommit to values from Step 4.
 
-	toSendBuf.Reset()
-	for _, c := range coefComms {
-		if err := c.Encode(toSendBuf); err != nil {
-			return nil, err
-		}
-	}
-	for _, z := range coefEGKnows {
-		if err := z.Encode(toSendBuf); err != nil {
-			return nil, err
-		}
-	}
-	if err := egrefresh.Encode(toSendBuf); err != nil {
-		return nil, err
-	}
-
 	allCoefComms := make([][]*commitment.ElGamal, nProc)
 	check = func(pid uint16, data []byte) error {
-		buf := bytes.NewBuffer(data)
+		payload, err := openCommitment(comms[pid], ads.session(coefRid), pid, data)
+		if err != nil {
+			return fmt.Errorf("STEP 5: %v", err)
+		}
+		buf := bytes.NewBuffer(payload)
 		allCoefComms[pid] = make([]*commitment.ElGamal, t)
 		for i := range allCoefComms[pid] {
 			allCoefComms[pid][i] = &commitment.ElGamal{}
@@ -179,13 +157,12 @@ func (ads *ADSecret) Reshare(t uint16) (*TDSecret, error) {
 			}
 		}
 
-		coefEGKnows := make([]*zkpok.ZKEGKnow, t)
-		for i := range coefEGKnows {
-			coefEGKnows[i] = &zkpok.ZKEGKnow{}
-			if err := coefEGKnows[i].Decode(buf); err != nil {
+		for i := uint16(0); i < t; i++ {
+			var egknow zkpok.ZKEGKnow
+			if err := egknow.Decode(buf); err != nil {
 				return err
 			}
-			if err := coefEGKnows[i].Verify(ads.egf, allCoefComms[pid][i]); err != nil {
+			if err := egknow.Verify(ads.transcript(coefRid, pid), ads.egf, allCoefComms[pid][i]); err != nil {
 				return fmt.Errorf("STEP 5: Wrong egknow proof")
 			}
 		}
@@ -194,24 +171,14 @@ func (ads *ADSecret) Reshare(t uint16) (*TDSecret, error) {
 		if err := egrefresh.Decode(buf); err != nil {
 			return err
 		}
-		if egrefresh.Verify(ads.egf, ads.egs[pid], allCoefComms[pid][0]) != nil {
+		if egrefresh.Verify(ads.transcript(coefRid, pid), ads.egf, ads.egs[pid], allCoefComms[pid][0]) != nil {
 			return fmt.Errorf("STEP 5: Wrong egrefresh proof")
 		}
 
-		nmc, err := buildNMC(allCoefComms[pid], coefEGKnows, &egrefresh)
-		if err != nil {
-			return err
-		}
-
-		if err := nmcs[pid].Verify(nmc.dataBytes, nmc.zkpBytes); err != nil {
-
-			return err
-		}
-
 		return nil
 	}
 
-	toSend[0] = toSendBuf.Bytes()
+	toSend[0] = append(payload, rnd...)
 	if err := ads.server.Round(toSend, check); err != nil {
 		return nil, err
 	}
@@ -237,13 +204,15 @@ func (ads *ADSecret) Reshare(t uint16) (*TDSecret, error) {
 		}
 	}
 
-	// And now for every other pid (needed to verify ZKEGRefreshes later)
+	// And now for every other pid (needed to verify ZKEGRefreshes later).
+	// Parties outside a quorum deal nothing.
 	allEGEval := make([][]*commitment.ElGamal, nProc)
+	allCoefComms[ads.pid] = coefComms
 	for pidk := 0; pidk < nProc; pidk++ {
-		allEGEval[pidk] = make([]*commitment.ElGamal, nProc)
 		if allCoefComms[pidk] == nil {
-			allCoefComms[pidk] = coefComms
+			continue
 		}
+		allEGEval[pidk] = make([]*commitment.ElGamal, nProc)
 		for pidl := 0; pidl < nProc; pidl++ {
 			allEGEval[pidk][pidl] = ads.egf.Neutral()
 			exp := big.NewInt(int64(pidl + 1))
@@ -263,6 +232,7 @@ func (ads *ADSecret) Reshare(t uint16) (*TDSecret, error) {
 	effectiveRandEval := make([]*big.Int, nProc)
 	evalRefreshComm := make([]*commitment.ElGamal, nProc)
 	evalRefreshZK := make([]*zkpok.ZKEGRefresh, nProc)
+	rid = ads.server.NextRoundID()
 	for pid := range eval {
 		eval[pid] = polyEval(f, big.NewInt(int64(pid+1)), order)
 		if randEvalRefresh[pid], err = rand.Int(randReader, order); err != nil {
@@ -275,7 +245,7 @@ func (ads *ADSecret) Reshare(t uint16) (*TDSecret, error) {
 
 		evalRefreshComm[pid] = ads.egf.Neutral()
 		evalRefreshComm[pid].Compose(egEval[pid], ads.egf.Create(big.NewInt(0), randEvalRefresh[pid]))
-		if evalRefreshZK[pid], err = zkpok.NewZKEGRefresh(ads.egf, egEval[pid], evalRefreshComm[pid], randEvalRefresh[pid]); err != nil {
+		if evalRefreshZK[pid], err = zkpok.NewZKEGRefresh(ads.transcript(rid, ads.pid), ads.egf, egEval[pid], evalRefreshComm[pid], randEvalRefresh[pid]); err != nil {
 			return nil, err
 		}
 	}
@@ -311,7 +281,7 @@ func (ads *ADSecret) Reshare(t uint16) (*TDSecret, error) {
 			if err := allEvalRefreshZK[pid][i].Decode(buf); err != nil {
 				return err
 			}
-			if allEvalRefreshZK[pid][i].Verify(ads.egf, allEGEval[pid][i], allEvalRefreshComm[pid][i]) != nil {
+			if allEvalRefreshZK[pid][i].Verify(ads.transcript(rid, pid), ads.egf, allEGEval[pid][i], allEvalRefreshComm[pid][i]) != nil {
 				return fmt.Errorf("STEP 7: Wrong Refresh proof")
 			}
 		}
@@ -339,7 +309,10 @@ func (ads *ADSecret) Reshare(t uint16) (*TDSecret, error) {
 		if len(data) < 4 {
 			return fmt.Errorf("data for pid %v is to short %v", pid, len(data))
 		}
-		l := binary.LittleEndian.Uint32(data[:4])
+		l := int(binary.LittleEndian.Uint32(data[:4]))
+		if l > len(data)-4 {
+			return fmt.Errorf("wrong length of the share %v from pid %v", l, pid)
+		}
 		recvEvals[pid] = new(big.Int).SetBytes(data[4 : 4+l])
 		recvRand[pid] = new(big.Int).SetBytes(data[4+l:])
 		if !allEvalRefreshComm[pid][ads.pid].Equal(ads.egf.Create(recvEvals[pid], recvRand[pid]), allEvalRefreshComm[pid][ads.pid]) {
@@ -357,27 +330,23 @@ func (ads *ADSecret) Reshare(t uint16) (*TDSecret, error) {
 	share := big.NewInt(0)
 	shareRand := big.NewInt(0)
 	shareComms := make([]*commitment.ElGamal, nProc)
+	recvEvals[ads.pid] = eval[ads.pid]
+	recvRand[ads.pid] = effectiveRandEval[ads.pid]
+	allEvalRefreshComm[ads.pid] = evalRefreshComm
 	for pid, e := range recvEvals {
 		shareComms[pid] = ads.egf.Neutral()
-		// While this looks risky, note that resharing is part of preprocessing which can be aborted by a single node anyway
+		// parties outside a quorum deal nothing
 		if e == nil {
-			share.Add(share, eval[pid])
-			shareRand.Add(shareRand, effectiveRandEval[pid])
 			continue
 		}
 		share.Add(share, e)
 		shareRand.Add(shareRand, recvRand[pid])
 	}
 	share.Mod(share, order)
-	for _, egs := range allEvalRefreshComm {
-		comms := egs
-		if comms == nil {
-			comms = evalRefreshComm
-		}
+	for _, comms := range allEvalRefreshComm {
 		for pid, eg := range comms {
 			shareComms[pid].Compose(shareComms[pid], eg)
 		}
-
 	}
 
 	// STEP 10. Commit to coefs of F and EGRefresh
@@ -388,7 +357,8 @@ func (ads *ADSecret) Reshare(t uint16) (*TDSecret, error) {
 	}
 	shareCommRefresh := ads.egf.Neutral()
 	shareCommRefresh.Compose(shareComms[ads.pid], ads.egf.Create(big.NewInt(0), shareRandRefresh))
-	shareRefreshZK, err := zkpok.NewZKEGRefresh(ads.egf, shareComms[ads.pid], shareCommRefresh, shareRandRefresh)
+	rid = ads.server.NextRoundID()
+	shareRefreshZK, err := zkpok.NewZKEGRefresh(ads.transcript(rid, ads.pid), ads.egf, shareComms[ads.pid], shareCommRefresh, shareRandRefresh)
 	if err != nil {
 		return nil, err
 	}
@@ -413,7 +383,7 @@ func (ads *ADSecret) Reshare(t uint16) (*TDSecret, error) {
 		if err := egTemp.Decode(buf); err != nil {
 			return fmt.Errorf("STEP 10, decode: eg %v", err)
 		}
-		if egrefreshTemp.Verify(ads.egf, shareComms[pid], &egTemp) != nil {
+		if egrefreshTemp.Verify(ads.transcript(rid, pid), ads.egf, shareComms[pid], &egTemp) != nil {
 			return fmt.Errorf("STEP 10, Wrong proof")
 		}
 		// After checking that eg agrees with previous commitment, replace the old one with it
@@ -428,10 +398,15 @@ func (ads *ADSecret) Reshare(t uint16) (*TDSecret, error) {
 		return nil, err
 	}
 
+	// The randomizing element of our refreshed commitment is the sum of the received ones and the refreshing one
+	shareRand.Add(shareRand, shareRandRefresh)
+	shareRand.Mod(shareRand, order)
+	shareComms[ads.pid] = shareCommRefresh
+
 	tds := &TDSecret{*ads, t}
-	ads.skShare = share
-	ads.r = shareRandRefresh
-	ads.egs = shareComms
+	tds.skShare = share
+	tds.r = shareRand
+	tds.egs = shareComms
 
 	return tds, nil
 }
@@ -1,6 +1,10 @@
 package arith_test
 
 import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
 	"math/big"
 	"math/rand"
 	stdsync "sync"
@@ -8,6 +12,7 @@ import (
 
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/arith"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/commitment"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/zkpok"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/curve"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/sync"
 
@@ -23,24 +28,22 @@ import (
 var _ = Describe("Secret Test", func() {
 
 	var (
-		nProc     uint16
-		netservs  []network.Server
-		syncservs []sync.Server
-		roundTime time.Duration
-		start     time.Time
-		label     string
-		wg        stdsync.WaitGroup
-		errors    []error
-		group     curve.Group
+		nProc        uint16
+		netservs     []network.Server
+		syncservs    []sync.Server
+		roundTimeout time.Duration
+		label        string
+		wg           stdsync.WaitGroup
+		errors       []error
+		group        curve.Group
 	)
 
 	JustBeforeEach(func() {
 		wg = stdsync.WaitGroup{}
 		netservs = tests.NewNetwork(int(nProc), time.Millisecond*100)
 		syncservs = make([]sync.Server, int(nProc))
-		start = time.Now().Add(50 * time.Millisecond)
 		for i := uint16(0); i < nProc; i++ {
-			syncservs[i] = sync.NewServer(i, nProc, start, roundTime, netservs[i])
+			syncservs[i] = sync.NewServer(i, nProc, roundTimeout, netservs[i])
 			syncservs[i].Start()
 		}
 		errors = make([]error, nProc)
@@ -48,7 +51,7 @@ var _ = Describe("Secret Test", func() {
 
 	BeforeEach(func() {
 		label = "x"
-		roundTime = 100 * time.Millisecond
+		roundTimeout = 2 * time.Second
 		rand.Seed(1729)
 		group = curve.NewSecp256k1Group()
 	})
@@ -76,6 +79,26 @@ var _ = Describe("Secret Test", func() {
 		}
 	}
 
+	// genSecretInSession generates a secret like genSecret in the session with the given id,
+	// so that it may run concurrently with generating other secrets
+	genSecretInSession := func(ads []*arith.ADSecret, label string, egf *commitment.ElGamalFactory, sid uint64) {
+		errs := make([]error, nProc)
+		var wgs stdsync.WaitGroup
+		wgs.Add(int(nProc))
+		for i := uint16(0); i < nProc; i++ {
+			go func(i uint16) {
+				defer wgs.Done()
+				ads[i], errs[i] = arith.Gen(label, syncservs[i].Session(sid), egf, i, nProc)
+			}(i)
+		}
+
+		wgs.Wait()
+		for i := uint16(0); i < nProc; i++ {
+			Expect(errs[i]).NotTo(HaveOccurred())
+			Expect(ads[i]).NotTo(BeNil())
+		}
+	}
+
 	genKey := func(dks []*arith.DKey) {
 		wg.Add(int(nProc))
 		for i := uint16(0); i < nProc; i++ {
@@ -124,17 +147,37 @@ var _ = Describe("Secret Test", func() {
 		}
 	}
 
-	mult := func(a, b, c []*arith.ADSecret, cl string) {
+	reveal := func(tds []*arith.TDSecret, values []*big.Int) {
+		wg.Add(int(nProc))
+		for i := uint16(0); i < nProc; i++ {
+			go func(i uint16) {
+				defer wg.Done()
+				values[i], errors[i] = tds[i].Reveal()
+			}(i)
+		}
+		wg.Wait()
+
+		for i := uint16(0); i < nProc; i++ {
+			Expect(errors[i]).NotTo(HaveOccurred())
+			Expect(values[i]).NotTo(BeNil())
+		}
+	}
+
+	paillierKeys := func() ([]*paillier.PrivateKey, []*paillier.PublicKey, []*zkpok.RingPedersen) {
 		privs := make([]*paillier.PrivateKey, nProc)
 		pubs := make([]*paillier.PublicKey, nProc)
-		bitLen := 264
-		timeout := 1 * time.Second
+		rps := make([]*zkpok.RingPedersen, nProc)
+		bitLen := arith.PaillierMinBits
+		timeout := 30 * time.Second
 
 		wg.Add(int(nProc))
 		for i := uint16(0); i < nProc; i++ {
 			go func(i uint16) {
 				defer wg.Done()
 				privs[i], pubs[i], errors[i] = paillier.GenerateKeyPair(bitLen, timeout)
+				if errors[i] == nil {
+					rps[i], _, errors[i] = zkpok.NewRingPedersen(privs[i])
+				}
 			}(i)
 		}
 		wg.Wait()
@@ -143,13 +186,89 @@ var _ = Describe("Secret Test", func() {
 			Expect(errors[i]).NotTo(HaveOccurred())
 			Expect(privs[i]).NotTo(BeNil())
 			Expect(pubs[i]).NotTo(BeNil())
+			Expect(rps[i]).NotTo(BeNil())
+		}
+
+		return privs, pubs, rps
+	}
+
+	allParties := func() []uint16 {
+		quorum := make([]uint16, nProc)
+		for i := range quorum {
+			quorum[i] = uint16(i)
+		}
+		return quorum
+	}
+
+	// thresholdKey generates a threshold key for commitments, whose secret is committed to under an auxiliary key
+	thresholdKey := func(tdks []*arith.TDKey, t uint16) {
+		aux := make([]*arith.DKey, nProc)
+		genKey(aux)
+		h := make([]*arith.ADSecret, nProc)
+		genSecret(h, "h", commitment.NewElGamalFactory(aux[0].PublicKey()))
+		tds := make([]*arith.TDSecret, nProc)
+		reshare(h, tds, t)
+		exp(tds, tdks)
+	}
+
+	genThresholdSecret := func(tds []*arith.TDSecret, label string, egf *commitment.ElGamalFactory, t uint16) {
+		ads := make([]*arith.ADSecret, nProc)
+		genSecret(ads, label, egf)
+		reshare(ads, tds, t)
+	}
+
+	// withOT runs base OTs with all parties, and then runs op with the OT backend by the parties in the quorum
+	withOT := func(quorum []uint16, op func(uint16, arith.MtA) error) {
+		mtas := make([]arith.MtA, nProc)
+		wg.Add(int(nProc))
+		for i := uint16(0); i < nProc; i++ {
+			go func(i uint16) {
+				defer wg.Done()
+				mtas[i], errors[i] = arith.NewOTMtA(i, nProc, syncservs[i], group)
+			}(i)
+		}
+		wg.Wait()
+		for i := uint16(0); i < nProc; i++ {
+			Expect(errors[i]).NotTo(HaveOccurred())
 		}
 
+		wg.Add(len(quorum))
+		for _, i := range quorum {
+			go func(i uint16) {
+				defer wg.Done()
+				errors[i] = op(i, mtas[i])
+			}(i)
+		}
+		wg.Wait()
+		for _, i := range quorum {
+			Expect(errors[i]).NotTo(HaveOccurred())
+		}
+	}
+
+	revealIn := func(quorum []uint16, tds []*arith.TDSecret, values []*big.Int) {
+		wg.Add(len(quorum))
+		for _, i := range quorum {
+			go func(i uint16) {
+				defer wg.Done()
+				values[i], errors[i] = tds[i].Reveal()
+			}(i)
+		}
+		wg.Wait()
+
+		for _, i := range quorum {
+			Expect(errors[i]).NotTo(HaveOccurred())
+			Expect(values[i]).To(Equal(values[quorum[0]]))
+		}
+	}
+
+	mult := func(a, b, c []*arith.ADSecret, cl string, keys []*arith.DKey) {
+		privs, pubs, rps := paillierKeys()
+
 		wg.Add(int(nProc))
 		for i := uint16(0); i < nProc; i++ {
 			go func(i uint16) {
 				defer wg.Done()
-				c[i], errors[i] = arith.Mult(a[i], b[i], cl, privs[i], pubs[i], pubs)
+				c[i], errors[i] = arith.Mult(a[i], b[i], cl, keys[i], arith.NewPaillierMtA(i, nProc, privs[i], pubs, rps))
 			}(i)
 		}
 		wg.Wait()
@@ -419,6 +538,153 @@ var _ = Describe("Secret Test", func() {
 		})
 	})
 
+	Describe("Revealing threshold secrets with arith.TDSecret.Reveal", func() {
+
+		var (
+			t      uint16
+			ads    []*arith.ADSecret
+			tds    []*arith.TDSecret
+			tdks   []*arith.TDKey
+			values []*big.Int
+			egf    *commitment.ElGamalFactory
+		)
+
+		checkReveal := func() {
+			genSecret(ads, label, egf)
+			reshare(ads, tds, t)
+			reveal(tds, values)
+			exp(tds, tdks)
+
+			for i := uint16(0); i < nProc; i++ {
+				Expect(values[i]).To(Equal(values[0]))
+				Expect(values[i].Sign()).To(BeNumerically(">=", 0))
+				Expect(values[i].Cmp(group.Order())).To(Equal(-1))
+				Expect(group.Equal(group.ScalarBaseMult(values[i]), tdks[i].PublicKey())).To(BeTrue())
+			}
+		}
+
+		JustBeforeEach(func() {
+			ads = make([]*arith.ADSecret, nProc)
+			tds = make([]*arith.TDSecret, nProc)
+			tdks = make([]*arith.TDKey, nProc)
+			values = make([]*big.Int, nProc)
+			egsk := group.ScalarBaseMult(big.NewInt(rand.Int63()))
+			egf = commitment.NewElGamalFactory(egsk)
+		})
+
+		Context("Two parties", func() {
+
+			BeforeEach(func() {
+				nProc = 2
+				t = 2
+			})
+
+			Context("Alice and Bob are honest and alive", func() {
+
+				It("Should reveal a value modulo the group order agreeing with Exp", func() {
+					checkReveal()
+				})
+
+				It("Should give keys with the label and the threshold of the secret, also when bound to a context", func() {
+					checkReveal()
+					for i := uint16(0); i < nProc; i++ {
+						bound := tdks[i].WithContext(context.Background())
+						Expect(tdks[i].Label()).To(Equal(label))
+						Expect(bound.Label()).To(Equal(label))
+						Expect(bound.Threshold()).To(Equal(t))
+						Expect(group.Equal(bound.PublicKey(), tdks[i].PublicKey())).To(BeTrue())
+						Expect(tdks[i].DKey.WithContext(context.Background()).Label()).To(Equal(label))
+					}
+				})
+			})
+		})
+
+		Context("Three parties", func() {
+
+			BeforeEach(func() {
+				nProc = 3
+				t = 2
+			})
+
+			Context("The third party is offline during Reveal and Exp", func() {
+
+				It("Should reveal a value agreeing with Exp to the others", func() {
+					genSecret(ads, label, egf)
+					reshare(ads, tds, t)
+
+					online := []uint16{0, 1}
+					wg.Add(len(online))
+					for _, i := range online {
+						go func(i uint16) {
+							defer wg.Done()
+							if values[i], errors[i] = tds[i].Reveal(); errors[i] != nil {
+								return
+							}
+							tdks[i], errors[i] = tds[i].Exp()
+						}(i)
+					}
+					wg.Wait()
+
+					for _, i := range online {
+						Expect(errors[i]).NotTo(HaveOccurred())
+						Expect(values[i]).To(Equal(values[0]))
+						Expect(group.Equal(group.ScalarBaseMult(values[i]), tdks[i].PublicKey())).To(BeTrue())
+					}
+				})
+			})
+
+			Context("The third party is slow during Reveal and Exp", func() {
+
+				It("Should let the others finish without waiting for it", func() {
+					genSecret(ads, label, egf)
+					reshare(ads, tds, t)
+
+					delay := roundTimeout / 2
+					took := make([]time.Duration, nProc)
+					wg.Add(int(nProc))
+					for i := uint16(0); i < nProc; i++ {
+						go func(i uint16) {
+							defer wg.Done()
+							begin := time.Now()
+							if i == 2 {
+								time.Sleep(delay)
+							}
+							if values[i], errors[i] = tds[i].Reveal(); errors[i] != nil {
+								return
+							}
+							tdks[i], errors[i] = tds[i].Exp()
+							took[i] = time.Since(begin)
+						}(i)
+					}
+					wg.Wait()
+
+					for i := uint16(0); i < nProc; i++ {
+						Expect(errors[i]).NotTo(HaveOccurred())
+						Expect(values[i]).To(Equal(values[0]))
+						Expect(group.Equal(group.ScalarBaseMult(values[i]), tdks[i].PublicKey())).To(BeTrue())
+					}
+					Expect(took[0]).To(BeNumerically("<", delay))
+					Expect(took[1]).To(BeNumerically("<", delay))
+				})
+			})
+		})
+
+		Context("Ten parties", func() {
+
+			BeforeEach(func() {
+				nProc = 10
+				t = 4
+			})
+
+			Context("All parties are honest and alive", func() {
+
+				It("Should reveal a value modulo the group order agreeing with Exp", func() {
+					checkReveal()
+				})
+			})
+		})
+	})
+
 	Describe("Multiplying two secrets with arith.Mul", func() {
 
 		var (
@@ -426,6 +692,7 @@ var _ = Describe("Secret Test", func() {
 			b          []*arith.ADSecret
 			c          []*arith.ADSecret
 			al, bl, cl string
+			keys       []*arith.DKey
 			egf        *commitment.ElGamalFactory
 		)
 
@@ -437,8 +704,9 @@ var _ = Describe("Secret Test", func() {
 			bl = "b"
 			cl = "c"
 
-			egsk := group.ScalarBaseMult(big.NewInt(rand.Int63()))
-			egf = commitment.NewElGamalFactory(egsk)
+			keys = make([]*arith.DKey, nProc)
+			genKey(keys)
+			egf = commitment.NewElGamalFactory(keys[0].PublicKey())
 		})
 
 		Context("Two parties", func() {
@@ -453,15 +721,17 @@ var _ = Describe("Secret Test", func() {
 
 					wgm.Add(2)
 					go func() {
+						defer GinkgoRecover()
 						defer wgm.Done()
-						genSecret(a, al, egf)
+						genSecretInSession(a, al, egf, 1)
 					}()
 					go func() {
+						defer GinkgoRecover()
 						defer wgm.Done()
-						genSecret(b, bl, egf)
+						genSecretInSession(b, bl, egf, 2)
 					}()
 					wgm.Wait()
-					mult(a, b, c, cl)
+					mult(a, b, c, cl, keys)
 				})
 			})
 		})
@@ -478,17 +748,980 @@ var _ = Describe("Secret Test", func() {
 
 					wgm.Add(2)
 					go func() {
+						defer GinkgoRecover()
 						defer wgm.Done()
-						genSecret(a, al, egf)
+						genSecretInSession(a, al, egf, 1)
 					}()
 					go func() {
+						defer GinkgoRecover()
 						defer wgm.Done()
-						genSecret(b, bl, egf)
+						genSecretInSession(b, bl, egf, 2)
 					}()
 					wgm.Wait()
-					mult(a, b, c, cl)
+					mult(a, b, c, cl, keys)
+				})
+			})
+		})
+	})
+
+	Describe("Inverting secrets with arith.ADSecret.Inverse and arith.TDSecret.Inverse", func() {
+
+		Context("Two parties", func() {
+
+			BeforeEach(func() {
+				nProc = 2
+			})
+
+			Context("Alice and Bob are honest and alive", func() {
+
+				It("Should compute the inverse of an additive secret", func() {
+					keys := make([]*arith.DKey, nProc)
+					genKey(keys)
+					x := make([]*arith.ADSecret, nProc)
+					genSecret(x, "x", commitment.NewElGamalFactory(keys[0].PublicKey()))
+
+					xInv := make([]*arith.ADSecret, nProc)
+					withOT(allParties(), func(i uint16, mta arith.MtA) error {
+						var err error
+						xInv[i], err = x[i].Inverse("xInv", keys[i], mta)
+						return err
+					})
+
+					values := make([]*big.Int, nProc)
+					invValues := make([]*big.Int, nProc)
+					wg.Add(int(nProc))
+					for i := uint16(0); i < nProc; i++ {
+						go func(i uint16) {
+							defer wg.Done()
+							if values[i], errors[i] = x[i].Reveal(); errors[i] != nil {
+								return
+							}
+							invValues[i], errors[i] = xInv[i].Reveal()
+						}(i)
+					}
+					wg.Wait()
+
+					for i := uint16(0); i < nProc; i++ {
+						Expect(errors[i]).NotTo(HaveOccurred())
+						product := new(big.Int).Mul(values[i], invValues[i])
+						Expect(product.Mod(product, group.Order()).Int64()).To(Equal(int64(1)))
+					}
+				})
+			})
+		})
+
+		Context("Three parties", func() {
+
+			var (
+				t    uint16
+				keys []*arith.TDKey
+				x    []*arith.TDSecret
+			)
+
+			BeforeEach(func() {
+				nProc = 3
+				t = 2
+			})
+
+			JustBeforeEach(func() {
+				keys = make([]*arith.TDKey, nProc)
+				thresholdKey(keys, t)
+				x = make([]*arith.TDSecret, nProc)
+				genThresholdSecret(x, "x", commitment.NewElGamalFactory(keys[0].PublicKey()), t)
+			})
+
+			checkInverse := func(quorum []uint16) {
+				xInv := make([]*arith.TDSecret, nProc)
+				withOT(quorum, func(i uint16, mta arith.MtA) error {
+					var err error
+					xInv[i], err = x[i].Inverse("xInv", keys[i], mta, quorum)
+					return err
+				})
+
+				values := make([]*big.Int, nProc)
+				invValues := make([]*big.Int, nProc)
+				revealIn(quorum, x, values)
+				revealIn(quorum, xInv, invValues)
+				for _, i := range quorum {
+					Expect(xInv[i].Threshold()).To(Equal(t))
+					product := new(big.Int).Mul(values[i], invValues[i])
+					Expect(product.Mod(product, group.Order()).Int64()).To(Equal(int64(1)))
+				}
+			}
+
+			Context("All parties are honest and alive", func() {
+
+				It("Should compute the inverse of a threshold secret with the same threshold", func() {
+					checkInverse(allParties())
+				})
+			})
+
+			Context("The third party is offline during Inverse", func() {
+
+				It("Should compute the inverse with the quorum of the others", func() {
+					checkInverse([]uint16{0, 1})
+				})
+			})
+		})
+	})
+
+	Describe("Combining secrets locally with Add, Sub, ScalarMul, AddConst and Lin", func() {
+
+		var (
+			egf            *commitment.ElGamalFactory
+			alpha, c       *big.Int
+			expectedValues func(a, b *big.Int) []*big.Int
+		)
+
+		BeforeEach(func() {
+			egf = commitment.NewElGamalFactory(group.ScalarBaseMult(big.NewInt(rand.Int63())))
+			alpha = big.NewInt(5)
+			c = big.NewInt(7)
+			// the values of a+b, a-b, alpha*a and a+c
+			expectedValues = func(a, b *big.Int) []*big.Int {
+				order := group.Order()
+				values := []*big.Int{
+					new(big.Int).Add(a, b),
+					new(big.Int).Sub(a, b),
+					new(big.Int).Mul(alpha, a),
+					new(big.Int).Add(a, c),
+				}
+				for _, v := range values {
+					v.Mod(v, order)
+				}
+				return values
+			}
+		})
+
+		Context("Two parties with additive secrets", func() {
+
+			BeforeEach(func() {
+				nProc = 2
+			})
+
+			It("Should compute values agreeing with the commitments", func() {
+				a := make([]*arith.ADSecret, nProc)
+				b := make([]*arith.ADSecret, nProc)
+				genSecret(a, "a", egf)
+				genSecret(b, "b", egf)
+
+				values := make([][]*big.Int, nProc)
+				wg.Add(int(nProc))
+				for i := uint16(0); i < nProc; i++ {
+					go func(i uint16) {
+						defer wg.Done()
+						sum, err := a[i].Add(b[i], "sum")
+						if err != nil {
+							errors[i] = err
+							return
+						}
+						diff, err := a[i].Sub(b[i], "diff")
+						if err != nil {
+							errors[i] = err
+							return
+						}
+						for _, x := range []*arith.ADSecret{a[i], b[i], sum, diff, a[i].ScalarMul(alpha, "prod"), a[i].AddConst(c, "shift")} {
+							value, err := x.Reveal()
+							if err != nil {
+								errors[i] = err
+								return
+							}
+							values[i] = append(values[i], value)
+						}
+					}(i)
+				}
+				wg.Wait()
+
+				for i := uint16(0); i < nProc; i++ {
+					Expect(errors[i]).NotTo(HaveOccurred())
+					Expect(values[i][2:]).To(Equal(expectedValues(values[i][0], values[i][1])))
+				}
+			})
+		})
+
+		Context("Three parties with threshold secrets", func() {
+
+			BeforeEach(func() {
+				nProc = 3
+			})
+
+			It("Should compute values agreeing with the commitments", func() {
+				t := uint16(2)
+				a := make([]*arith.TDSecret, nProc)
+				b := make([]*arith.TDSecret, nProc)
+				genThresholdSecret(a, "a", egf, t)
+				genThresholdSecret(b, "b", egf, t)
+
+				values := make([][]*big.Int, nProc)
+				wg.Add(int(nProc))
+				for i := uint16(0); i < nProc; i++ {
+					go func(i uint16) {
+						defer wg.Done()
+						sum, err := a[i].Add(b[i], "sum")
+						if err != nil {
+							errors[i] = err
+							return
+						}
+						diff, err := a[i].Sub(b[i], "diff")
+						if err != nil {
+							errors[i] = err
+							return
+						}
+						for _, x := range []*arith.TDSecret{a[i], b[i], sum, diff, a[i].ScalarMul(alpha, "prod"), a[i].AddConst(c, "shift")} {
+							value, err := x.Reveal()
+							if err != nil {
+								errors[i] = err
+								return
+							}
+							values[i] = append(values[i], value)
+						}
+					}(i)
+				}
+				wg.Wait()
+
+				for i := uint16(0); i < nProc; i++ {
+					Expect(errors[i]).NotTo(HaveOccurred())
+					Expect(values[i][2:]).To(Equal(expectedValues(values[i][0], values[i][1])))
+				}
+			})
+
+			It("Should compute a linear combination of many secrets with arith.Lin", func() {
+				t := uint16(2)
+				secrets := make([][]*arith.TDSecret, 3)
+				for j := range secrets {
+					secrets[j] = make([]*arith.TDSecret, nProc)
+					genThresholdSecret(secrets[j], "a", egf, t)
+				}
+				// coefficients outside of [0, order) are reduced
+				alphas := []*big.Int{big.NewInt(3), big.NewInt(-2), new(big.Int).Add(group.Order(), big.NewInt(4))}
+
+				values := make([][]*big.Int, nProc)
+				wg.Add(int(nProc))
+				for i := uint16(0); i < nProc; i++ {
+					go func(i uint16) {
+						defer wg.Done()
+						lin, err := arith.Lin(alphas, []*arith.TDSecret{secrets[0][i], secrets[1][i], secrets[2][i]}, "lin")
+						if err != nil {
+							errors[i] = err
+							return
+						}
+						for _, x := range []*arith.TDSecret{secrets[0][i], secrets[1][i], secrets[2][i], lin} {
+							value, err := x.Reveal()
+							if err != nil {
+								errors[i] = err
+								return
+							}
+							values[i] = append(values[i], value)
+						}
+					}(i)
+				}
+				wg.Wait()
+
+				for i := uint16(0); i < nProc; i++ {
+					Expect(errors[i]).NotTo(HaveOccurred())
+					expected := big.NewInt(0)
+					for j, alpha := range alphas {
+						expected.Add(expected, new(big.Int).Mul(alpha, values[i][j]))
+					}
+					Expect(values[i][3]).To(Equal(expected.Mod(expected, group.Order())))
+				}
+			})
+
+			It("Should refuse to combine secrets with arith.Lin which do not match", func() {
+				a := make([]*arith.TDSecret, nProc)
+				b := make([]*arith.TDSecret, nProc)
+				c := make([]*arith.TDSecret, nProc)
+				genThresholdSecret(a, "a", egf, 2)
+				genThresholdSecret(b, "b", egf, 3)
+				genThresholdSecret(c, "c", commitment.NewElGamalFactory(group.ScalarBaseMult(big.NewInt(rand.Int63()))), 2)
+
+				one := big.NewInt(1)
+				for i := uint16(0); i < nProc; i++ {
+					_, err := arith.Lin([]*big.Int{one, one}, []*arith.TDSecret{a[i], b[i]}, "lin")
+					Expect(err).To(MatchError(ContainSubstring("thresholds of the secrets differ")))
+					_, err = arith.Lin([]*big.Int{one, one}, []*arith.TDSecret{a[i], c[i]}, "lin")
+					Expect(err).To(MatchError(ContainSubstring("committed to under different keys")))
+					_, err = arith.Lin([]*big.Int{one}, []*arith.TDSecret{a[i], a[i]}, "lin")
+					Expect(err).To(MatchError(ContainSubstring("coefficients")))
+					_, err = arith.Lin(nil, nil, "lin")
+					Expect(err).To(HaveOccurred())
+				}
+			})
+
+			It("Should refuse to add secrets with different thresholds", func() {
+				a := make([]*arith.TDSecret, nProc)
+				b := make([]*arith.TDSecret, nProc)
+				genThresholdSecret(a, "a", egf, 2)
+				genThresholdSecret(b, "b", egf, 3)
+
+				for i := uint16(0); i < nProc; i++ {
+					sum, err := a[i].Add(b[i], "sum")
+					Expect(err).To(MatchError(ContainSubstring("thresholds of the secrets differ")))
+					Expect(sum).To(BeNil())
+				}
+			})
+		})
+	})
+
+	Describe("Multiplying threshold secrets with arith.TMult", func() {
+
+		var (
+			t    uint16
+			keys []*arith.TDKey
+			a, b []*arith.TDSecret
+		)
+
+		JustBeforeEach(func() {
+			keys = make([]*arith.TDKey, nProc)
+			thresholdKey(keys, t)
+			egf := commitment.NewElGamalFactory(keys[0].PublicKey())
+			a = make([]*arith.TDSecret, nProc)
+			b = make([]*arith.TDSecret, nProc)
+			genThresholdSecret(a, "a", egf, t)
+			genThresholdSecret(b, "b", egf, t)
+		})
+
+		checkTMult := func(quorum []uint16) {
+			c := make([]*arith.TDSecret, nProc)
+			withOT(quorum, func(i uint16, mta arith.MtA) error {
+				var err error
+				c[i], err = arith.TMult(a[i], b[i], "c", keys[i], mta, quorum)
+				return err
+			})
+
+			aValues := make([]*big.Int, nProc)
+			bValues := make([]*big.Int, nProc)
+			cValues := make([]*big.Int, nProc)
+			revealIn(quorum, a, aValues)
+			revealIn(quorum, b, bValues)
+			revealIn(quorum, c, cValues)
+			for _, i := range quorum {
+				Expect(c[i].Threshold()).To(Equal(t))
+				product := new(big.Int).Mul(aValues[i], bValues[i])
+				Expect(cValues[i]).To(Equal(product.Mod(product, group.Order())))
+			}
+		}
+
+		Context("Three parties", func() {
+
+			BeforeEach(func() {
+				nProc = 3
+				t = 2
+			})
+
+			Context("All parties are honest and alive", func() {
+
+				It("Should compute the product with the same threshold", func() {
+					checkTMult(allParties())
+				})
+			})
+
+			Context("The third party is offline during TMult", func() {
+
+				It("Should compute the product with the quorum of the others", func() {
+					checkTMult([]uint16{0, 1})
+				})
+			})
+
+			Context("The quorum is smaller than the threshold", func() {
+
+				It("Should refuse to multiply", func() {
+					for i := uint16(0); i < nProc; i++ {
+						c, err := arith.TMult(a[i], b[i], "c", keys[i], nil, []uint16{i})
+						Expect(err).To(MatchError(ContainSubstring("smaller than the threshold")))
+						Expect(c).To(BeNil())
+					}
+				})
+			})
+		})
+	})
+
+	Describe("Generating threshold secrets with arith.GenThreshold", func() {
+
+		Context("Four parties", func() {
+
+			BeforeEach(func() {
+				nProc = 4
+			})
+
+			Context("The last two parties take no part", func() {
+
+				It("Should reveal and exponentiate the secret in the quorum without waiting for the others", func() {
+					quorum := []uint16{0, 1}
+					egf := commitment.NewElGamalFactory(group.ScalarBaseMult(big.NewInt(rand.Int63())))
+					tds := make([]*arith.TDSecret, nProc)
+					wg.Add(len(quorum))
+					for _, i := range quorum {
+						go func(i uint16) {
+							defer wg.Done()
+							tds[i], errors[i] = arith.GenThreshold(label, syncservs[i], egf, i, nProc, 2, quorum)
+						}(i)
+					}
+					wg.Wait()
+					for _, i := range quorum {
+						Expect(errors[i]).NotTo(HaveOccurred())
+					}
+
+					begin := time.Now()
+					values := make([]*big.Int, nProc)
+					revealIn(quorum, tds, values)
+					tdks := make([]*arith.TDKey, nProc)
+					wg.Add(len(quorum))
+					for _, i := range quorum {
+						go func(i uint16) {
+							defer wg.Done()
+							tdks[i], errors[i] = tds[i].Exp()
+						}(i)
+					}
+					wg.Wait()
+					Expect(time.Since(begin)).To(BeNumerically("<", roundTimeout))
+
+					for _, i := range quorum {
+						Expect(errors[i]).NotTo(HaveOccurred())
+						Expect(group.Equal(tdks[i].PublicKey(), group.ScalarBaseMult(values[i]))).To(BeTrue())
+					}
+				})
+			})
+		})
+	})
+
+	Describe("Detecting malicious parties", func() {
+
+		var (
+			egf    *commitment.ElGamalFactory
+			honest []uint16
+		)
+
+		// shiftCommitment replaces a leading ElGamal commitment in a message with a commitment to a value bigger by one
+		shiftCommitment := func(data []byte) []byte {
+			buf := bytes.NewBuffer(data)
+			eg := &commitment.ElGamal{}
+			Expect(eg.Decode(buf)).To(Succeed())
+			eg.Compose(eg, egf.Create(big.NewInt(1), big.NewInt(0)))
+
+			tampered := &bytes.Buffer{}
+			Expect(eg.Encode(tampered)).To(Succeed())
+			tampered.Write(buf.Bytes())
+			return tampered.Bytes()
+		}
+
+		expectBlamed := func(pid uint16) {
+			for _, i := range honest {
+				Expect(errors[i]).To(HaveOccurred())
+				rErr, ok := errors[i].(*sync.RoundError)
+				Expect(ok).To(BeTrue())
+				Expect(rErr.Missing()).To(Equal([]uint16{pid}))
+			}
+		}
+
+		JustBeforeEach(func() {
+			egsk := group.ScalarBaseMult(big.NewInt(rand.Int63()))
+			egf = commitment.NewElGamalFactory(egsk)
+			honest = make([]uint16, 0, nProc-1)
+			for i := uint16(1); i < nProc; i++ {
+				honest = append(honest, i)
+			}
+		})
+
+		Context("Three parties", func() {
+
+			BeforeEach(func() {
+				nProc = 3
+			})
+
+			Context("The first party commits to a different value than it proves knowledge of in arith.Gen", func() {
+
+				It("Should be blamed by the others", func() {
+					syncservs[0] = &tamperingServer{Server: syncservs[0], target: 0, tamper: shiftCommitment}
+
+					ads := make([]*arith.ADSecret, nProc)
+					wg.Add(int(nProc))
+					for i := uint16(0); i < nProc; i++ {
+						go func(i uint16) {
+							defer wg.Done()
+							ads[i], errors[i] = arith.Gen(label, syncservs[i], egf, i, nProc)
+						}(i)
+					}
+					wg.Wait()
+
+					expectBlamed(0)
+				})
+			})
+
+			Context("The first party opens its commitment in arith.GenExpReveal with different randomness", func() {
+
+				It("Should be blamed by the others", func() {
+					flipLast := func(data []byte) []byte {
+						tampered := append([]byte{}, data...)
+						tampered[len(tampered)-1] ^= 1
+						return tampered
+					}
+					syncservs[0] = &tamperingServer{Server: syncservs[0], target: 1, tamper: flipLast}
+
+					wg.Add(int(nProc))
+					for i := uint16(0); i < nProc; i++ {
+						go func(i uint16) {
+							defer wg.Done()
+							_, errors[i] = arith.GenExpReveal(i, label, syncservs[i], nProc, group)
+						}(i)
+					}
+					wg.Wait()
+
+					expectBlamed(0)
+				})
+			})
+
+			Context("Setting up Paillier keys with arith.SetupPaillier", func() {
+
+				var (
+					privs []*paillier.PrivateKey
+					pubs  []*paillier.PublicKey
+				)
+
+				// as in tecdsa.Init, a key is generated before the Paillier keys are set up.
+				// Rounds of the first party: 0 and 1 generate the key, 2 and 3 set up the Paillier keys
+				setup := func() {
+					keys := make([]*arith.DKey, nProc)
+					genKey(keys)
+
+					wg.Add(int(nProc))
+					for i := uint16(0); i < nProc; i++ {
+						go func(i uint16) {
+							defer wg.Done()
+							_, errors[i] = arith.SetupPaillier(i, nProc, syncservs[i], privs[i], pubs)
+						}(i)
+					}
+					wg.Wait()
+				}
+
+				// keys are generated before the servers start, as it takes a while
+				BeforeEach(func() {
+					errors = make([]error, nProc)
+					privs, pubs, _ = paillierKeys()
+				})
+
+				It("Should accept well formed keys", func() {
+					setup()
+					for i := uint16(0); i < nProc; i++ {
+						Expect(errors[i]).NotTo(HaveOccurred())
+					}
+				})
+
+				It("Should blame the first party if its proofs do not verify", func() {
+					flipLast := func(data []byte) []byte {
+						tampered := append([]byte{}, data...)
+						tampered[len(tampered)-1] ^= 1
+						return tampered
+					}
+					syncservs[0] = &tamperingServer{Server: syncservs[0], target: 2, tamper: flipLast}
+					setup()
+					expectBlamed(0)
+				})
+
+				Context("The first party has a modulus with a small factor", func() {
+
+					BeforeEach(func() {
+						blumPrime := func(bits int) *big.Int {
+							for {
+								p, err := crand.Prime(crand.Reader, bits)
+								Expect(err).NotTo(HaveOccurred())
+								if p.Bit(1) == 1 {
+									return p
+								}
+							}
+						}
+						p, q := blumPrime(64), blumPrime(arith.PaillierMinBits-64)
+						pm, qm := new(big.Int).Sub(p, big.NewInt(1)), new(big.Int).Sub(q, big.NewInt(1))
+						phi := new(big.Int).Mul(pm, qm)
+						lambda := new(big.Int).Div(phi, new(big.Int).GCD(nil, nil, pm, qm))
+						pubs[0] = &paillier.PublicKey{N: new(big.Int).Mul(p, q)}
+						privs[0] = &paillier.PrivateKey{PublicKey: *pubs[0], LambdaN: lambda, PhiN: phi}
+					})
+
+					It("Should be blamed by the others", func() {
+						setup()
+						expectBlamed(0)
+					})
+				})
+
+				Context("The first party has a modulus shorter than the minimum", func() {
+
+					BeforeEach(func() {
+						privs[0], pubs[0], errors[0] = paillier.GenerateKeyPair(arith.PaillierMinBits/2, 30*time.Second)
+						Expect(errors[0]).NotTo(HaveOccurred())
+					})
+
+					It("Should be refused by all parties", func() {
+						setup()
+						for i := uint16(0); i < nProc; i++ {
+							Expect(errors[i]).To(MatchError(ContainSubstring("Paillier modulus of pid 0 is too short")))
+						}
+					})
+				})
+			})
+
+			Context("The first party sends shares with a wrong length in arith.ADSecret.Reshare", func() {
+
+				// rounds of the first party: 0 generates the secret and 5 sends the shares in the reshare
+				reshareTampered := func(length func(data []byte) int) {
+					setLength := func(data []byte) []byte {
+						tampered := append([]byte{}, data...)
+						binary.LittleEndian.PutUint32(tampered[:4], uint32(length(data)))
+						return tampered
+					}
+					syncservs[0] = &tamperingServer{Server: syncservs[0], target: 5, tamper: setLength}
+
+					ads := make([]*arith.ADSecret, nProc)
+					genSecret(ads, label, egf)
+					wg.Add(int(nProc))
+					for i := uint16(0); i < nProc; i++ {
+						go func(i uint16) {
+							defer wg.Done()
+							_, errors[i] = ads[i].Reshare(2)
+						}(i)
+					}
+					wg.Wait()
+				}
+
+				It("Should be blamed by the others if the length is too big", func() {
+					reshareTampered(func([]byte) int { return 1 << 31 })
+					expectBlamed(0)
+				})
+
+				It("Should be blamed by the others if the length exceeds the data by one", func() {
+					reshareTampered(func(data []byte) int { return len(data) - 3 })
+					expectBlamed(0)
+				})
+			})
+
+			Context("The first party reveals a share different from its commitment in arith.TDSecret.Reveal", func() {
+
+				var (
+					values []*big.Int
+				)
+
+				// rounds of the first party: 0 generates the secret, 1 to 6 reshare it and 7 reveals it
+				revealTampered := func(t uint16) {
+					shiftShare := func(data []byte) []byte {
+						tampered := append([]byte{}, data...)
+						l := binary.LittleEndian.Uint32(tampered[:4])
+						tampered[3+l] ^= 1
+						return tampered
+					}
+					syncservs[0] = &tamperingServer{Server: syncservs[0], target: 7, tamper: shiftShare}
+
+					ads := make([]*arith.ADSecret, nProc)
+					tds := make([]*arith.TDSecret, nProc)
+					genSecret(ads, label, egf)
+					reshare(ads, tds, t)
+
+					values = make([]*big.Int, nProc)
+					wg.Add(int(nProc))
+					for i := uint16(0); i < nProc; i++ {
+						go func(i uint16) {
+							defer wg.Done()
+							values[i], errors[i] = tds[i].Reveal()
+						}(i)
+					}
+					wg.Wait()
+				}
+
+				It("Should be blamed by the others if its share is needed", func() {
+					revealTampered(3)
+					expectBlamed(0)
+				})
+
+				It("Should not be trusted by the others, which still reveal the secret, if enough shares are left", func() {
+					revealTampered(2)
+					// the others do not wait for the share of the first party once they have enough shares,
+					// so they blame it only if it arrives in time
+					for _, i := range honest {
+						if errors[i] != nil {
+							dErr, ok := errors[i].(*arith.DecodingError)
+							Expect(ok).To(BeTrue())
+							Expect(dErr.Culprits()).To(Equal([]uint16{0}))
+						}
+						Expect(values[i]).To(Equal(values[0]))
+					}
+					Expect(errors[0]).NotTo(HaveOccurred())
+				})
+			})
+
+			// shiftPoint adds the generator to the public key share at the beginning of a message in Exp,
+			// leaving the proof attached to it intact
+			shiftPoint := func(data []byte) []byte {
+				buf := bytes.NewBuffer(data)
+				p, err := group.Decode(buf)
+				Expect(err).NotTo(HaveOccurred())
+				tampered := &bytes.Buffer{}
+				Expect(group.Encode(group.Add(p, group.Gen()), tampered)).To(Succeed())
+				tampered.Write(buf.Bytes())
+				return tampered.Bytes()
+			}
+
+			Context("The first party publishes a wrong public key share in arith.ADSecret.Exp", func() {
+
+				It("Should be blamed by the others", func() {
+					// rounds of the first party: 0 generates the secret and 1 exponentiates it
+					syncservs[0] = &tamperingServer{Server: syncservs[0], target: 1, tamper: shiftPoint}
+
+					ads := make([]*arith.ADSecret, nProc)
+					genSecret(ads, label, egf)
+
+					wg.Add(int(nProc))
+					for i := uint16(0); i < nProc; i++ {
+						go func(i uint16) {
+							defer wg.Done()
+							_, errors[i] = ads[i].Exp()
+						}(i)
+					}
+					wg.Wait()
+
+					expectBlamed(0)
+				})
+			})
+
+			Context("The first party publishes a wrong public key share in arith.TDSecret.Exp", func() {
+
+				It("Should not be trusted by the others, which still compute the right key", func() {
+					// rounds of the first party: 0 generates the secret, 1 to 6 reshare it and 7 exponentiates it
+					syncservs[0] = &tamperingServer{Server: syncservs[0], target: 7, tamper: shiftPoint}
+
+					ads := make([]*arith.ADSecret, nProc)
+					tds := make([]*arith.TDSecret, nProc)
+					tdks := make([]*arith.TDKey, nProc)
+					genSecret(ads, label, egf)
+					reshare(ads, tds, 1)
+
+					wg.Add(int(nProc))
+					for i := uint16(0); i < nProc; i++ {
+						go func(i uint16) {
+							defer wg.Done()
+							tdks[i], errors[i] = tds[i].Exp()
+						}(i)
+					}
+					wg.Wait()
+
+					Expect(errors[0]).NotTo(HaveOccurred())
+					for _, i := range honest {
+						// with threshold 1 the others wait for all shares to correct a corrupted one, so they always blame it
+						dErr, ok := errors[i].(*arith.DecodingError)
+						Expect(ok).To(BeTrue())
+						Expect(dErr.Culprits()).To(Equal([]uint16{0}))
+						Expect(group.Equal(tdks[i].PublicKey(), tdks[0].PublicKey())).To(BeTrue())
+					}
+				})
+			})
+		})
+
+		Context("Two parties", func() {
+
+			var (
+				a, b, c []*arith.ADSecret
+				pubs    []*paillier.PublicKey
+				privs   []*paillier.PrivateKey
+				rps     []*zkpok.RingPedersen
+			)
+
+			BeforeEach(func() {
+				nProc = 2
+			})
+
+			// rounds of the first party: 0 and 1 generate the key for commitments, 2 and 3 generate a and b,
+			// 4 and 5 run PrivMult, 6 publishes a commitment to the share of c and 7 to the product of b
+			// and the share of a, and 8 to 10 run CheckDH on E(ab)/E(c)
+			multTampered := func(target int, tamper func([]byte) []byte) {
+				syncservs[0] = &tamperingServer{Server: syncservs[0], target: target, tamper: tamper}
+
+				keys := make([]*arith.DKey, nProc)
+				genKey(keys)
+				egf = commitment.NewElGamalFactory(keys[0].PublicKey())
+
+				a = make([]*arith.ADSecret, nProc)
+				b = make([]*arith.ADSecret, nProc)
+				c = make([]*arith.ADSecret, nProc)
+				genSecret(a, "a", egf)
+				genSecret(b, "b", egf)
+				privs, pubs, rps = paillierKeys()
+
+				wg.Add(int(nProc))
+				for i := uint16(0); i < nProc; i++ {
+					go func(i uint16) {
+						defer wg.Done()
+						c[i], errors[i] = arith.Mult(a[i], b[i], "c", keys[i], arith.NewPaillierMtA(i, nProc, privs[i], pubs, rps))
+					}(i)
+				}
+				wg.Wait()
+			}
+
+			// rounds of the first party: 0 and 1 generate the key for commitments, 2 and 3 generate a and b,
+			// 4 and 5 run base OTs, 6 and 7 run PrivMult, and the rest is as in multTampered
+			multOTTampered := func(target int, tamper func([]byte) []byte) {
+				syncservs[0] = &tamperingServer{Server: syncservs[0], target: target, tamper: tamper}
+
+				keys := make([]*arith.DKey, nProc)
+				genKey(keys)
+				egf = commitment.NewElGamalFactory(keys[0].PublicKey())
+
+				a = make([]*arith.ADSecret, nProc)
+				b = make([]*arith.ADSecret, nProc)
+				c = make([]*arith.ADSecret, nProc)
+				genSecret(a, "a", egf)
+				genSecret(b, "b", egf)
+
+				wg.Add(int(nProc))
+				for i := uint16(0); i < nProc; i++ {
+					go func(i uint16) {
+						defer wg.Done()
+						var mta arith.MtA
+						if mta, errors[i] = arith.NewOTMtA(i, nProc, syncservs[i], group); errors[i] != nil {
+							return
+						}
+						c[i], errors[i] = arith.Mult(a[i], b[i], "c", keys[i], mta)
+					}(i)
+				}
+				wg.Wait()
+			}
+
+			Context("All parties are honest and use the OT backend", func() {
+
+				It("Should pass the check of the product", func() {
+					multOTTampered(-1, nil)
+					for i := uint16(0); i < nProc; i++ {
+						Expect(errors[i]).NotTo(HaveOccurred())
+						Expect(c[i]).NotTo(BeNil())
+					}
+				})
+			})
+
+			Context("The first party uses inconsistent choice bits in OT extension with the OT backend", func() {
+
+				It("Should be blamed by the other", func() {
+					// flipping a bit of the first column changes the choice bit of the first OT in this column only
+					flipColumn := func(data []byte) []byte {
+						tampered := append([]byte{}, data...)
+						tampered[4] ^= 1
+						return tampered
+					}
+					multOTTampered(6, flipColumn)
+					expectBlamed(0)
+				})
+			})
+
+			Context("The first party perturbs the corrections of OTs with the OT backend", func() {
+
+				It("Should make the product check fail for all parties, with no one blamed", func() {
+					// adding 1 to every correction shifts the share of the other party by its share of b
+					shiftCorrections := func(data []byte) []byte {
+						tampered := []byte{}
+						for len(data) > 0 {
+							l := binary.LittleEndian.Uint32(data[:4])
+							corr := new(big.Int).SetBytes(data[4 : 4+l])
+							corr.Add(corr, big.NewInt(1))
+							lenBytes := make([]byte, 4)
+							binary.LittleEndian.PutUint32(lenBytes, uint32(len(corr.Bytes())))
+							tampered = append(append(tampered, lenBytes...), corr.Bytes()...)
+							data = data[4+l:]
+						}
+						return tampered
+					}
+					multOTTampered(7, shiftCorrections)
+					for i := uint16(0); i < nProc; i++ {
+						Expect(errors[i]).To(MatchError(ContainSubstring("the culprit cannot be identified")))
+						_, blamed := errors[i].(*sync.RoundError)
+						Expect(blamed).To(BeFalse())
+						Expect(c[i]).To(BeNil())
+					}
+				})
+			})
+
+			Context("All parties are honest", func() {
+
+				It("Should pass the check of the product", func() {
+					multTampered(-1, nil)
+					for i := uint16(0); i < nProc; i++ {
+						Expect(errors[i]).NotTo(HaveOccurred())
+					}
+				})
+			})
+
+			Context("The first party publishes a commitment to a share of c it does not know in arith.Mult", func() {
+
+				It("Should be blamed by the other", func() {
+					multTampered(6, shiftCommitment)
+					expectBlamed(0)
+				})
+			})
+
+			Context("The first party publishes a wrong commitment to the product of b and its share of a in arith.Mult", func() {
+
+				It("Should be blamed by the other", func() {
+					multTampered(7, shiftCommitment)
+					expectBlamed(0)
+				})
+			})
+
+			// shiftCiphertext adds 1 to the plaintext of the Paillier ciphertext under the key of the given party
+			// at the beginning of a message in PrivMult, leaving the proof attached to it intact
+			shiftCiphertext := func(owner uint16) func([]byte) []byte {
+				return func(data []byte) []byte {
+					l := binary.LittleEndian.Uint32(data[:4])
+					one, err := pubs[owner].Encrypt(big.NewInt(1))
+					Expect(err).NotTo(HaveOccurred())
+					shifted, err := pubs[owner].HomoAdd(new(big.Int).SetBytes(data[4:4+l]), one)
+					Expect(err).NotTo(HaveOccurred())
+					result := make([]byte, 4)
+					binary.LittleEndian.PutUint32(result, uint32(len(shifted.Bytes())))
+					result = append(result, shifted.Bytes()...)
+					return append(result, data[4+l:]...)
+				}
+			}
+
+			Context("The first party sends a ciphertext of its share of a not matching the range proof in PrivMult", func() {
+
+				It("Should be blamed by the other", func() {
+					multTampered(4, shiftCiphertext(0))
+					expectBlamed(0)
+				})
+			})
+
+			Context("The first party perturbs the share of the other party in PrivMult", func() {
+
+				It("Should be blamed by the other", func() {
+					multTampered(5, shiftCiphertext(1))
+					expectBlamed(0)
 				})
 			})
 		})
 	})
 })
+
+// tamperingServer modifies the messages its party sends in the target round
+type tamperingServer struct {
+	sync.Server
+	round, target int
+	tamper        func([]byte) []byte
+}
+
+func (ts *tamperingServer) Round(toSend [][]byte, check func(uint16, []byte) error) error {
+	return ts.Server.Round(ts.tampered(toSend), check)
+}
+
+func (ts *tamperingServer) QuorumRound(toSend [][]byte, check func(uint16, []byte) error, quorum uint16) ([]uint16, error) {
+	return ts.Server.QuorumRound(ts.tampered(toSend), check, quorum)
+}
+
+// tampered returns the data to send in the current round, tampered with in the target round
+func (ts *tamperingServer) tampered(toSend [][]byte) [][]byte {
+	defer func() { ts.round++ }()
+	if ts.round != ts.target {
+		return toSend
+	}
+	tampered := make([][]byte, len(toSend))
+	for i, data := range toSend {
+		if data != nil {
+			tampered[i] = ts.tamper(data)
+		}
+	}
+	return tampered
+}
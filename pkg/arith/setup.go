@@ -0,0 +1,128 @@
+package arith
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/binance-chain/tss-lib/crypto/paillier"
+
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/zkpok"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/sync"
+)
+
+// SetupPaillier checks that the Paillier keys of all parties are well formed and collects their ring-Pedersen parameters,
+// which are needed to verify range proofs in PrivMult. Every party proves that its modulus is a Paillier-Blum modulus,
+// publishes ring-Pedersen parameters over it together with a proof that they are well formed,
+// and then proves to every other party, with the parameters of that party, that its modulus has no small factors.
+// Parties whose proofs fail are reported in a sync.RoundError.
+// Moduli shorter than PaillierMinBits are refused before any round is run.
+func SetupPaillier(pid, nProc uint16, server sync.Server, priv *paillier.PrivateKey, pubs []*paillier.PublicKey) ([]*zkpok.RingPedersen, error) {
+	for id, pub := range pubs {
+		if pub.N.BitLen() < PaillierMinBits {
+			return nil, fmt.Errorf("Paillier modulus of pid %v is too short: expected at least %v bits, got %v", id, PaillierMinBits, pub.N.BitLen())
+		}
+	}
+	rps := make([]*zkpok.RingPedersen, nProc)
+	rp, lambda, err := zkpok.NewRingPedersen(priv)
+	if err != nil {
+		return nil, err
+	}
+	rps[pid] = rp
+
+	// Round 1: broadcast the ring-Pedersen parameters with proofs for them and for the modulus
+	rid := server.NextRoundID()
+	toSendBuf := &bytes.Buffer{}
+	if err = rp.Encode(toSendBuf); err != nil {
+		return nil, err
+	}
+	zkprm, err := zkpok.NewZKRingPedersen(setupTranscript(rid, pid), priv, rp, lambda)
+	if err != nil {
+		return nil, err
+	}
+	if err = zkprm.Encode(toSendBuf); err != nil {
+		return nil, err
+	}
+	zkmod, err := zkpok.NewZKPaillierBlum(setupTranscript(rid, pid), priv)
+	if err != nil {
+		return nil, err
+	}
+	if err = zkmod.Encode(toSendBuf); err != nil {
+		return nil, err
+	}
+
+	check := func(id uint16, data []byte) error {
+		buf := bytes.NewBuffer(data)
+		var rp zkpok.RingPedersen
+		if err := rp.Decode(buf); err != nil {
+			return fmt.Errorf("decode: ring-Pedersen parameters %v", err)
+		}
+		if rp.N().Cmp(pubs[id].N) != 0 {
+			return fmt.Errorf("ring-Pedersen parameters over a modulus different from the Paillier one")
+		}
+		var zkprm zkpok.ZKRingPedersen
+		if err := zkprm.Decode(buf); err != nil {
+			return fmt.Errorf("decode: ring-Pedersen proof %v", err)
+		}
+		if err := zkprm.Verify(setupTranscript(rid, id), &rp); err != nil {
+			return fmt.Errorf("Wrong ring-Pedersen proof: %v", err)
+		}
+		var zkmod zkpok.ZKPaillierBlum
+		if err := zkmod.Decode(buf); err != nil {
+			return fmt.Errorf("decode: Paillier-Blum proof %v", err)
+		}
+		if err := zkmod.Verify(setupTranscript(rid, id), pubs[id]); err != nil {
+			return fmt.Errorf("Wrong Paillier-Blum proof: %v", err)
+		}
+		rps[id] = &rp
+		return nil
+	}
+
+	if err = server.Round([][]byte{toSendBuf.Bytes()}, check); err != nil {
+		return nil, err
+	}
+
+	// Round 2: prove to every party that our modulus has no small factors
+	rid = server.NextRoundID()
+	toSend := make([][]byte, nProc)
+	for id := range toSend {
+		if uint16(id) == pid {
+			continue
+		}
+		zkfac, err := zkpok.NewZKNoSmallFactor(setupTranscript(rid, pid), priv, rps[id])
+		if err != nil {
+			return nil, err
+		}
+		buf := &bytes.Buffer{}
+		if err = zkfac.Encode(buf); err != nil {
+			return nil, err
+		}
+		toSend[id] = buf.Bytes()
+	}
+
+	check = func(id uint16, data []byte) error {
+		var zkfac zkpok.ZKNoSmallFactor
+		if err := zkfac.Decode(bytes.NewBuffer(data)); err != nil {
+			return fmt.Errorf("decode: no small factor proof %v", err)
+		}
+		if err := zkfac.Verify(setupTranscript(rid, id), pubs[id], rps[pid]); err != nil {
+			return fmt.Errorf("Wrong no small factor proof: %v", err)
+		}
+		return nil
+	}
+
+	if err = server.Round(toSend, check); err != nil {
+		return nil, err
+	}
+
+	return rps, nil
+}
+
+// setupTranscript returns a transcript binding proofs in SetupPaillier to the round with given id and the prover
+func setupTranscript(roundID int64, pid uint16) *pkg.Transcript {
+	tr := pkg.NewTranscript("ThresholdECDSA")
+	tr.AppendMessage("label", []byte("paillier"))
+	tr.AppendUint64("round", uint64(roundID))
+	tr.AppendUint64("pid", uint64(pid))
+	return tr
+}
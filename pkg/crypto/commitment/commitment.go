@@ -40,6 +40,25 @@ func (e *ElGamalFactory) Create(value, r *big.Int) *ElGamal {
 	}
 }
 
+//FromPoints creates ElGamal Commitment with given components, e.g. to treat a pair of points as a commitment
+func (e *ElGamalFactory) FromPoints(first, second curve.Point) *ElGamal {
+	return &ElGamal{
+		first:  first,
+		second: second,
+		curve:  e.curve,
+	}
+}
+
+//Points returns the components of ElGamal Commitment
+func (c *ElGamal) Points() (curve.Point, curve.Point) {
+	return c.first, c.second
+}
+
+//H returns the point h with respect to which ElGamalFactory creates commitments
+func (e *ElGamalFactory) H() curve.Point {
+	return e.h
+}
+
 //Curve returns group used by ElGamalFactory
 func (e *ElGamalFactory) Curve() curve.Group {
 	return e.curve
@@ -48,6 +48,18 @@ var _ = Describe("Commitment Test", func() {
 		cmpResult := g.Equal(result, commCreator.Create(new(big.Int).Sub(ord, big.NewInt(3)), new(big.Int).Sub(ord, big.NewInt(5))))
 		Expect(cmpResult).To(BeTrue())
 	})
+	It("FromPoints Test", func() {
+		result := commCreator.FromPoints(group.ScalarBaseMult(big.NewInt(5)), group.ScalarBaseMult(big.NewInt(13)))
+		Expect(g.Equal(result, g)).To(BeTrue())
+	})
+	It("Points Test", func() {
+		first, second := g.Points()
+		Expect(group.Equal(first, group.ScalarBaseMult(big.NewInt(5)))).To(BeTrue())
+		Expect(group.Equal(second, group.ScalarBaseMult(big.NewInt(13)))).To(BeTrue())
+	})
+	It("H Test", func() {
+		Expect(group.Equal(commCreator.H(), group.ScalarBaseMult(big.NewInt(2)))).To(BeTrue())
+	})
 	It("Marshal-Unmarshal Test", func() {
 		rw := bytes.Buffer{}
 		err := g.Encode(&rw)
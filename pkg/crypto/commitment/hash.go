@@ -0,0 +1,67 @@
+package commitment
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+//HashRandLen is the length of the randomness opening a HashCommitment
+const HashRandLen = 32
+
+//HashCommitment is a non-malleable commitment H(session, pid, randomness, payload) in the random oracle model.
+//Binding the session and the committer's pid prevents other parties from replaying or copying the commitment.
+type HashCommitment struct {
+	digest []byte
+}
+
+//NewHashCommitment commits to payload of the party pid in the given session.
+//It returns the commitment and the randomness needed to open it.
+func NewHashCommitment(session []byte, pid uint16, payload []byte) (*HashCommitment, []byte, error) {
+	rnd := make([]byte, HashRandLen)
+	if _, err := io.ReadFull(rand.Reader, rnd); err != nil {
+		return nil, nil, err
+	}
+	return &HashCommitment{hashCommit(session, pid, rnd, payload)}, rnd, nil
+}
+
+//Verify checks if HashCommitment opens to payload with the randomness rnd
+func (c *HashCommitment) Verify(session []byte, pid uint16, payload, rnd []byte) error {
+	if len(rnd) != HashRandLen {
+		return fmt.Errorf("wrong length of randomness %v", len(rnd))
+	}
+	if subtle.ConstantTimeCompare(c.digest, hashCommit(session, pid, rnd, payload)) != 1 {
+		return fmt.Errorf("commitment does not match the payload")
+	}
+	return nil
+}
+
+//Encode encodes HashCommitment
+func (c *HashCommitment) Encode(w io.Writer) error {
+	_, err := w.Write(c.digest)
+	return err
+}
+
+//Decode decodes HashCommitment
+func (c *HashCommitment) Decode(r io.Reader) error {
+	c.digest = make([]byte, sha256.Size)
+	if _, err := io.ReadFull(r, c.digest); err != nil {
+		return fmt.Errorf("Decoding HashCommitment: %v", err)
+	}
+	return nil
+}
+
+//hashCommit hashes length-prefixed fields, so that different inputs never collide
+func hashCommit(session []byte, pid uint16, rnd, payload []byte) []byte {
+	h := sha256.New()
+	lenBytes := make([]byte, 4)
+	for _, field := range [][]byte{[]byte("HashCommitment"), session, {byte(pid), byte(pid >> 8)}, rnd, payload} {
+		binary.LittleEndian.PutUint32(lenBytes, uint32(len(field)))
+		h.Write(lenBytes)
+		h.Write(field)
+	}
+	return h.Sum(nil)
+}
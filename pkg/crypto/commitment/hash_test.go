@@ -0,0 +1,66 @@
+package commitment_test
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/commitment"
+)
+
+var _ = Describe("HashCommitment Test", func() {
+	var (
+		session, payload []byte
+		comm             *commitment.HashCommitment
+		rnd              []byte
+		err              error
+	)
+	BeforeEach(func() {
+		session = []byte("session")
+		payload = []byte("payload")
+		comm, rnd, err = commitment.NewHashCommitment(session, 1, payload)
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("Open Test", func() {
+		Expect(comm.Verify(session, 1, payload, rnd)).To(Succeed())
+	})
+	It("Different Payload Test", func() {
+		Expect(comm.Verify(session, 1, []byte("payloaD"), rnd)).NotTo(Succeed())
+	})
+	It("Different Randomness Test", func() {
+		other := append([]byte{}, rnd...)
+		other[0] ^= 1
+		Expect(comm.Verify(session, 1, payload, other)).NotTo(Succeed())
+		Expect(comm.Verify(session, 1, payload, rnd[1:])).NotTo(Succeed())
+	})
+	It("Different Session Test", func() {
+		Expect(comm.Verify([]byte("session2"), 1, payload, rnd)).NotTo(Succeed())
+	})
+	It("Different Pid Test", func() {
+		Expect(comm.Verify(session, 2, payload, rnd)).NotTo(Succeed())
+	})
+	It("Framing Test", func() {
+		Expect(comm.Verify([]byte("sessionp"), 1, []byte("ayload"), rnd)).NotTo(Succeed())
+	})
+	It("Hiding Test", func() {
+		other, _, err := commitment.NewHashCommitment(session, 1, payload)
+		Expect(err).NotTo(HaveOccurred())
+		buf1, buf2 := &bytes.Buffer{}, &bytes.Buffer{}
+		Expect(comm.Encode(buf1)).To(Succeed())
+		Expect(other.Encode(buf2)).To(Succeed())
+		Expect(buf1.Bytes()).NotTo(Equal(buf2.Bytes()))
+	})
+	It("Encode Decode Test", func() {
+		buf := &bytes.Buffer{}
+		Expect(comm.Encode(buf)).To(Succeed())
+		decoded := &commitment.HashCommitment{}
+		Expect(decoded.Decode(buf)).To(Succeed())
+		Expect(decoded.Verify(session, 1, payload, rnd)).To(Succeed())
+	})
+	It("Decode Short Test", func() {
+		buf := &bytes.Buffer{}
+		Expect(comm.Encode(buf)).To(Succeed())
+		decoded := &commitment.HashCommitment{}
+		Expect(decoded.Decode(bytes.NewBuffer(buf.Bytes()[1:]))).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,38 @@
+package pkg_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/curve"
+	"math/big"
+)
+
+var _ = Describe("HashToBigInt", func() {
+	var (
+		order *big.Int
+	)
+	BeforeEach(func() {
+		order = curve.NewSecp256k1Group().Order()
+	})
+
+	It("Should return challenges reduced modulo the group order", func() {
+		for i := 0; i < 1000; i++ {
+			e := pkg.HashToBigInt(big.NewInt(int64(i)).Bytes(), order)
+			Expect(e.Sign()).To(BeNumerically(">=", 0))
+			Expect(e.Cmp(order)).To(Equal(-1))
+		}
+	})
+	It("Should be deterministic", func() {
+		msg := []byte("threshold ecdsa")
+		Expect(pkg.HashToBigInt(msg, order)).To(Equal(pkg.HashToBigInt(msg, order)))
+		Expect(pkg.HashToBigInt(msg, order)).NotTo(Equal(pkg.HashToBigInt([]byte("threshold ecdsA"), order)))
+	})
+	It("Should respect small moduli", func() {
+		q := big.NewInt(1009)
+		for i := 0; i < 1000; i++ {
+			e := pkg.HashToBigInt(big.NewInt(int64(i)).Bytes(), q)
+			Expect(e.Cmp(q)).To(Equal(-1))
+		}
+	})
+})
@@ -0,0 +1,411 @@
+// Package ot implements oblivious transfer: Kappa base OTs over an elliptic curve group in the style of the Simplest OT
+// of Chou and Orlandi, and their extension to many correlated OTs over Z_q in the style of Ishai, Kilian, Nissim and Petrank,
+// with the consistency check of Keller, Orsini and Scholl against a malicious receiver.
+// Bit vectors are stored in byte slices, with bit i being the bit i%8 of the byte i/8.
+package ot
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/curve"
+)
+
+// Kappa is the computational security parameter, i.e. the number of base OTs
+const Kappa = 128
+
+// kappaBytes is the length of a bit vector of length Kappa
+const kappaBytes = Kappa / 8
+
+// BaseSender is the sender in Kappa base OTs, which obtains a pair of keys for each of them
+type BaseSender struct {
+	group curve.Group
+	y     *big.Int
+	s     curve.Point
+}
+
+// NewBaseSender samples the secret of the sender in base OTs
+func NewBaseSender(group curve.Group) (*BaseSender, error) {
+	y, err := rand.Int(rand.Reader, group.Order())
+	if err != nil {
+		return nil, err
+	}
+	return &BaseSender{group, y, group.ScalarBaseMult(y)}, nil
+}
+
+// Message returns the point S = g^y sent to the receiver
+func (bs *BaseSender) Message() curve.Point {
+	return bs.s
+}
+
+// Keys computes the pairs of keys of base OTs given the points R_j sent by the receiver.
+// The receiver knows exactly one key of every pair, chosen by its choice bit.
+func (bs *BaseSender) Keys(rs []curve.Point) ([][2][]byte, error) {
+	if len(rs) != Kappa {
+		return nil, fmt.Errorf("wrong number of base OTs: expected %v, got %v", Kappa, len(rs))
+	}
+	keys := make([][2][]byte, Kappa)
+	negS := bs.group.Neg(bs.s)
+	for j, r := range rs {
+		k0, err := baseKey(bs.group, j, bs.s, r, bs.group.ScalarMult(r, bs.y))
+		if err != nil {
+			return nil, err
+		}
+		k1, err := baseKey(bs.group, j, bs.s, r, bs.group.ScalarMult(bs.group.Add(r, negS), bs.y))
+		if err != nil {
+			return nil, err
+		}
+		keys[j] = [2][]byte{k0, k1}
+	}
+	return keys, nil
+}
+
+// BaseReceive computes the points R_j for Kappa base OTs with the given choice bits and the point S of the sender,
+// and returns them together with the chosen keys.
+func BaseReceive(group curve.Group, s curve.Point, choices []byte) ([]curve.Point, [][]byte, error) {
+	if len(choices) != kappaBytes {
+		return nil, nil, fmt.Errorf("wrong number of choice bits: expected %v, got %v", Kappa, 8*len(choices))
+	}
+	if group.Equal(s, group.Neutral()) {
+		return nil, nil, fmt.Errorf("the point of the sender is neutral")
+	}
+	rs := make([]curve.Point, Kappa)
+	keys := make([][]byte, Kappa)
+	for j := range rs {
+		x, err := rand.Int(rand.Reader, group.Order())
+		if err != nil {
+			return nil, nil, err
+		}
+		rs[j] = group.ScalarBaseMult(x)
+		if bit(choices, j) == 1 {
+			rs[j] = group.Add(rs[j], s)
+		}
+		if keys[j], err = baseKey(group, j, s, rs[j], group.ScalarMult(s, x)); err != nil {
+			return nil, nil, err
+		}
+	}
+	return rs, keys, nil
+}
+
+// baseKey hashes the shared point of the j-th base OT together with its messages
+func baseKey(group curve.Group, j int, s, r, shared curve.Point) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, uint32(j))
+	for _, p := range []curve.Point{s, r, shared} {
+		if err := group.Encode(p, buf); err != nil {
+			return nil, err
+		}
+	}
+	key := sha256.Sum256(buf.Bytes())
+	return key[:], nil
+}
+
+// statSecurity is the statistical security parameter of the consistency check of OT extension
+const statSecurity = 64
+
+// checkOTs is the number of OTs with random choice bits added to every extension,
+// which hide the choice bits of the receiver in the values of the consistency check
+const checkOTs = Kappa + statSecurity
+
+// maxOTs bounds the number of OTs in a message of the receiver, so that decoding it allocates a bounded amount of memory
+const maxOTs = 1 << 16
+
+// ExtSender is the sender of OT extension. It is the receiver in base OTs with random choice bits delta.
+type ExtSender struct {
+	delta []byte
+	seeds [][]byte
+}
+
+// NewExtSender constructs the sender of OT extension from the choice bits and the keys it received in base OTs
+func NewExtSender(delta []byte, seeds [][]byte) *ExtSender {
+	return &ExtSender{delta, seeds}
+}
+
+// ExtReceiver is the receiver of OT extension. It is the sender in base OTs.
+type ExtReceiver struct {
+	seeds [][2][]byte
+}
+
+// NewExtReceiver constructs the receiver of OT extension from the keys it obtained as the sender in base OTs
+func NewExtReceiver(seeds [][2][]byte) *ExtReceiver {
+	return &ExtReceiver{seeds}
+}
+
+// ExtMessage is the message of the receiver of m OTs: the columns u of the extension of the m OTs followed by checkOTs
+// random ones, and the values x and t of the consistency check of Keller, Orsini and Scholl, which show that
+// all columns were computed with the same choice bits.
+type ExtMessage struct {
+	m    int
+	u    [][]byte
+	x, t []byte
+}
+
+// Encode writes the message
+func (em *ExtMessage) Encode(w io.Writer) error {
+	if err := binary.Write(w, binary.LittleEndian, uint32(em.m)); err != nil {
+		return err
+	}
+	for _, v := range append(em.u, em.x, em.t) {
+		if _, err := w.Write(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode reads the message
+func (em *ExtMessage) Decode(r io.Reader) error {
+	var m uint32
+	if err := binary.Read(r, binary.LittleEndian, &m); err != nil {
+		return err
+	}
+	if m == 0 || m > maxOTs {
+		return fmt.Errorf("wrong number of OTs: %v", m)
+	}
+	em.m = int(m)
+	colLen := (em.m + checkOTs + 7) / 8
+	em.u = make([][]byte, Kappa)
+	for j := range em.u {
+		em.u[j] = make([]byte, colLen)
+		if _, err := io.ReadFull(r, em.u[j]); err != nil {
+			return err
+		}
+	}
+	em.x = make([]byte, kappaBytes)
+	if _, err := io.ReadFull(r, em.x); err != nil {
+		return err
+	}
+	em.t = make([]byte, kappaBytes)
+	_, err := io.ReadFull(r, em.t)
+	return err
+}
+
+// Extend computes the message of the receiver of m OTs with the given choice bits, followed by checkOTs random ones.
+// It returns the message, which has to be sent to the sender, and the rows t_i of the receiver in the m OTs,
+// needed to obtain its outputs. The nonce has to be unique for every extension with the same base OTs.
+func (er *ExtReceiver) Extend(nonce, choices []byte, m int) (*ExtMessage, [][]byte, error) {
+	mBytes := (m + 7) / 8
+	if len(choices) != mBytes {
+		return nil, nil, fmt.Errorf("wrong number of choice bits: expected %v, got %v", mBytes, len(choices))
+	}
+	n := m + checkOTs
+	nBytes := (n + 7) / 8
+	padded := make([]byte, nBytes)
+	if _, err := io.ReadFull(rand.Reader, padded); err != nil {
+		return nil, nil, err
+	}
+	for i := 0; i < m; i++ {
+		padded[i/8] &^= 1 << uint(i%8)
+		padded[i/8] |= bit(choices, i) << uint(i%8)
+	}
+
+	t := make([][]byte, Kappa)
+	u := make([][]byte, Kappa)
+	for j := range t {
+		t[j] = prg(er.seeds[j][0], nonce, nBytes)
+		u[j] = prg(er.seeds[j][1], nonce, nBytes)
+		xor(u[j], t[j])
+		xor(u[j], padded)
+	}
+	rows := transpose(t, n)
+
+	chis := challenges(nonce, u, n)
+	var x, tSum gf128
+	for i, row := range rows {
+		if bit(padded, i) == 1 {
+			x = x.add(chis[i])
+		}
+		tSum = tSum.add(gfMul(chis[i], gfFromBytes(row)))
+	}
+	return &ExtMessage{m, u, x.bytes(), tSum.bytes()}, rows[:m], nil
+}
+
+// Extend computes the rows q_i = t_i xor r_i delta of the sender of m OTs given the message of the receiver.
+// It fails if the message does not pass the consistency check, i.e. the receiver has not used the same choice bits
+// in all columns. Then the receiver may have learned some bits of delta, so the base OTs must not be used any more.
+func (es *ExtSender) Extend(nonce []byte, msg *ExtMessage, m int) ([][]byte, error) {
+	if msg.m != m {
+		return nil, fmt.Errorf("wrong number of OTs: expected %v, got %v", m, msg.m)
+	}
+	n := m + checkOTs
+	nBytes := (n + 7) / 8
+	if len(msg.u) != Kappa {
+		return nil, fmt.Errorf("wrong number of columns: expected %v, got %v", Kappa, len(msg.u))
+	}
+	if len(msg.x) != kappaBytes || len(msg.t) != kappaBytes {
+		return nil, fmt.Errorf("wrong length of the values of the consistency check")
+	}
+	q := make([][]byte, Kappa)
+	for j := range q {
+		if len(msg.u[j]) != nBytes {
+			return nil, fmt.Errorf("wrong length of column %v: expected %v, got %v", j, nBytes, len(msg.u[j]))
+		}
+		q[j] = prg(es.seeds[j], nonce, nBytes)
+		if bit(es.delta, j) == 1 {
+			xor(q[j], msg.u[j])
+		}
+	}
+	rows := transpose(q, n)
+
+	// q_i = t_i + x_i delta, so the combination of the rows with the challenges is t + x delta
+	chis := challenges(nonce, msg.u, n)
+	var qSum gf128
+	for i, row := range rows {
+		qSum = qSum.add(gfMul(chis[i], gfFromBytes(row)))
+	}
+	expected := gfFromBytes(msg.t).add(gfMul(gfFromBytes(msg.x), gfFromBytes(es.delta)))
+	if qSum != expected {
+		return nil, fmt.Errorf("the message of the receiver of OT extension fails the consistency check")
+	}
+	return rows[:m], nil
+}
+
+// SendCorrelated computes the outputs of the sender of correlated OTs over Z_q with the given correlations,
+// given the message of the receiver. It returns random pads p_i, which are the outputs of the sender,
+// and corrections, which have to be sent to the receiver, so that it obtains p_i + r_i delta_i.
+func (es *ExtSender) SendCorrelated(nonce []byte, msg *ExtMessage, deltas []*big.Int, q *big.Int) ([]*big.Int, []*big.Int, error) {
+	rows, err := es.Extend(nonce, msg, len(deltas))
+	if err != nil {
+		return nil, nil, err
+	}
+	pads := make([]*big.Int, len(deltas))
+	corrections := make([]*big.Int, len(deltas))
+	for i, row := range rows {
+		pads[i] = hashRow(nonce, i, row, q)
+		xor(row, es.delta)
+		corrections[i] = new(big.Int).Add(pads[i], deltas[i])
+		corrections[i].Sub(corrections[i], hashRow(nonce, i, row, q))
+		corrections[i].Mod(corrections[i], q)
+	}
+	return pads, corrections, nil
+}
+
+// ReceiveCorrelated computes the outputs p_i + r_i delta_i of the receiver of correlated OTs over Z_q,
+// given its rows and choice bits from Extend and the corrections of the sender
+func (er *ExtReceiver) ReceiveCorrelated(nonce []byte, rows [][]byte, choices []byte, corrections []*big.Int, q *big.Int) ([]*big.Int, error) {
+	if len(corrections) != len(rows) {
+		return nil, fmt.Errorf("wrong number of corrections: expected %v, got %v", len(rows), len(corrections))
+	}
+	outputs := make([]*big.Int, len(rows))
+	for i, row := range rows {
+		outputs[i] = hashRow(nonce, i, row, q)
+		if bit(choices, i) == 1 {
+			outputs[i].Add(outputs[i], corrections[i])
+			outputs[i].Mod(outputs[i], q)
+		}
+	}
+	return outputs, nil
+}
+
+// challenges derives the n random challenges of the consistency check from the nonce and the columns of the receiver
+func challenges(nonce []byte, u [][]byte, n int) []gf128 {
+	h := sha256.New()
+	h.Write(nonce)
+	for _, col := range u {
+		h.Write(col)
+	}
+	stream := prg(h.Sum(nil), []byte("KOS"), n*kappaBytes)
+	chis := make([]gf128, n)
+	for i := range chis {
+		chis[i] = gfFromBytes(stream[i*kappaBytes:])
+	}
+	return chis
+}
+
+// gf128 is an element of GF(2^128) = GF(2)[X]/(X^128 + X^7 + X^2 + X + 1).
+// The bit i of a bit vector of length Kappa is the coefficient of X^i.
+type gf128 [2]uint64
+
+func gfFromBytes(v []byte) gf128 {
+	return gf128{binary.LittleEndian.Uint64(v[:8]), binary.LittleEndian.Uint64(v[8:16])}
+}
+
+func (a gf128) bytes() []byte {
+	v := make([]byte, kappaBytes)
+	binary.LittleEndian.PutUint64(v[:8], a[0])
+	binary.LittleEndian.PutUint64(v[8:], a[1])
+	return v
+}
+
+func (a gf128) add(b gf128) gf128 {
+	return gf128{a[0] ^ b[0], a[1] ^ b[1]}
+}
+
+func gfMul(a, b gf128) gf128 {
+	// the carry-less product has degree at most 254
+	var p [4]uint64
+	for i := 0; i < 128; i++ {
+		if (a[i/64]>>uint(i%64))&1 == 0 {
+			continue
+		}
+		w, s := i/64, uint(i%64)
+		p[w] ^= b[0] << s
+		p[w+1] ^= b[1] << s
+		if s > 0 {
+			p[w+1] ^= b[0] >> (64 - s)
+			p[w+2] ^= b[1] >> (64 - s)
+		}
+	}
+	// X^i = X^(i-128) (X^7 + X^2 + X + 1) for i >= 128, from the highest coefficient down
+	for i := 255; i >= 128; i-- {
+		if (p[i/64]>>uint(i%64))&1 == 0 {
+			continue
+		}
+		for _, k := range []int{i, i - 121, i - 126, i - 127, i - 128} {
+			p[k/64] ^= 1 << uint(k%64)
+		}
+	}
+	return gf128{p[0], p[1]}
+}
+
+// hashRow hashes the i-th row of OT extension into Z_q
+func hashRow(nonce []byte, i int, row []byte, q *big.Int) *big.Int {
+	msg := make([]byte, 0, len(nonce)+4+len(row))
+	msg = append(msg, nonce...)
+	msg = append(msg, byte(i), byte(i>>8), byte(i>>16), byte(i>>24))
+	return pkg.HashToBigInt(append(msg, row...), q)
+}
+
+// prg expands the seed and the nonce into n pseudorandom bytes
+func prg(seed, nonce []byte, n int) []byte {
+	out := make([]byte, 0, n+sha256.Size)
+	block := make([]byte, 0, len(seed)+len(nonce)+4)
+	for ctr := uint32(0); len(out) < n; ctr++ {
+		block = append(block[:0], seed...)
+		block = append(block, nonce...)
+		block = append(block, byte(ctr), byte(ctr>>8), byte(ctr>>16), byte(ctr>>24))
+		digest := sha256.Sum256(block)
+		out = append(out, digest[:]...)
+	}
+	return out[:n]
+}
+
+// transpose turns Kappa columns of m bits into m rows of Kappa bits
+func transpose(cols [][]byte, m int) [][]byte {
+	rows := make([][]byte, m)
+	for i := range rows {
+		rows[i] = make([]byte, kappaBytes)
+		for j, col := range cols {
+			rows[i][j/8] |= bit(col, i) << uint(j%8)
+		}
+	}
+	return rows
+}
+
+// xor sets dst to dst xor src
+func xor(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+// bit returns the i-th bit of the bit vector v
+func bit(v []byte, i int) byte {
+	return (v[i/8] >> uint(i%8)) & 1
+}
@@ -0,0 +1,157 @@
+package ot_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/big"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/ot"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/curve"
+)
+
+var _ = Describe("OT", func() {
+	var (
+		group curve.Group
+		delta []byte
+		sKeys [][2][]byte
+		rKeys [][]byte
+		err   error
+	)
+
+	bit := func(v []byte, i int) byte {
+		return (v[i/8] >> uint(i%8)) & 1
+	}
+
+	randBits := func(n int) []byte {
+		v := make([]byte, (n+7)/8)
+		_, err := rand.Read(v)
+		Expect(err).NotTo(HaveOccurred())
+		return v
+	}
+
+	BeforeEach(func() {
+		group = curve.NewSecp256k1Group()
+		sender, err := ot.NewBaseSender(group)
+		Expect(err).NotTo(HaveOccurred())
+		delta = randBits(ot.Kappa)
+		var rs []curve.Point
+		rs, rKeys, err = ot.BaseReceive(group, sender.Message(), delta)
+		Expect(err).NotTo(HaveOccurred())
+		sKeys, err = sender.Keys(rs)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("Base OT", func() {
+		It("Should give the receiver exactly the chosen keys", func() {
+			for j := 0; j < ot.Kappa; j++ {
+				Expect(rKeys[j]).To(Equal(sKeys[j][bit(delta, j)]))
+				Expect(rKeys[j]).NotTo(Equal(sKeys[j][1-bit(delta, j)]))
+			}
+		})
+		It("Should reject a wrong number of points", func() {
+			sender, err := ot.NewBaseSender(group)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = sender.Keys([]curve.Point{group.Gen()})
+			Expect(err).To(HaveOccurred())
+		})
+		It("Should reject the neutral point of the sender", func() {
+			_, _, err = ot.BaseReceive(group, group.Neutral(), delta)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Correlated OT extension", func() {
+		var (
+			q              *big.Int
+			m              int
+			choices, nonce []byte
+			deltas         []*big.Int
+			sender         *ot.ExtSender
+			receiver       *ot.ExtReceiver
+		)
+
+		BeforeEach(func() {
+			q = group.Order()
+			m = q.BitLen()
+			choices = randBits(m)
+			nonce = []byte("nonce")
+			deltas = make([]*big.Int, m)
+			for i := range deltas {
+				deltas[i], err = rand.Int(rand.Reader, q)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			sender = ot.NewExtSender(delta, rKeys)
+			receiver = ot.NewExtReceiver(sKeys)
+		})
+
+		It("Should give the receiver the pads of the sender shifted by the chosen correlations", func() {
+			msg, rows, err := receiver.Extend(nonce, choices, m)
+			Expect(err).NotTo(HaveOccurred())
+			pads, corrections, err := sender.SendCorrelated(nonce, msg, deltas, q)
+			Expect(err).NotTo(HaveOccurred())
+			outputs, err := receiver.ReceiveCorrelated(nonce, rows, choices, corrections, q)
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < m; i++ {
+				expected := new(big.Int).Set(pads[i])
+				if bit(choices, i) == 1 {
+					expected.Add(expected, deltas[i])
+					expected.Mod(expected, q)
+				}
+				Expect(outputs[i]).To(Equal(expected))
+			}
+		})
+		It("Should give the same outputs after encoding and decoding the message", func() {
+			msg, rows, err := receiver.Extend(nonce, choices, m)
+			Expect(err).NotTo(HaveOccurred())
+			var buf bytes.Buffer
+			Expect(msg.Encode(&buf)).To(Succeed())
+			decoded := &ot.ExtMessage{}
+			Expect(decoded.Decode(&buf)).To(Succeed())
+			pads, corrections, err := sender.SendCorrelated(nonce, decoded, deltas, q)
+			Expect(err).NotTo(HaveOccurred())
+			outputs, err := receiver.ReceiveCorrelated(nonce, rows, choices, corrections, q)
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < m; i++ {
+				if bit(choices, i) == 0 {
+					Expect(outputs[i]).To(Equal(pads[i]))
+				}
+			}
+		})
+		It("Should reject a message extended with another nonce", func() {
+			msg, _, err := receiver.Extend(nonce, choices, m)
+			Expect(err).NotTo(HaveOccurred())
+			_, _, err = sender.SendCorrelated([]byte("other"), msg, deltas, q)
+			Expect(err).To(HaveOccurred())
+		})
+		It("Should reject a message with inconsistent choice bits", func() {
+			msg, _, err := receiver.Extend(nonce, choices, m)
+			Expect(err).NotTo(HaveOccurred())
+			var buf bytes.Buffer
+			Expect(msg.Encode(&buf)).To(Succeed())
+			// flip the choice bit of the first OT in one column only
+			data := buf.Bytes()
+			data[4] ^= 1
+			tampered := &ot.ExtMessage{}
+			Expect(tampered.Decode(bytes.NewReader(data))).To(Succeed())
+			_, _, err = sender.SendCorrelated(nonce, tampered, deltas, q)
+			Expect(err).To(HaveOccurred())
+		})
+		It("Should reject a message for a wrong number of OTs", func() {
+			msg, _, err := receiver.Extend(nonce, choices, m)
+			Expect(err).NotTo(HaveOccurred())
+			_, _, err = sender.SendCorrelated(nonce, msg, deltas[:8], q)
+			Expect(err).To(HaveOccurred())
+		})
+		It("Should refuse to decode a truncated message", func() {
+			msg, _, err := receiver.Extend(nonce, choices, m)
+			Expect(err).NotTo(HaveOccurred())
+			var buf bytes.Buffer
+			Expect(msg.Encode(&buf)).To(Succeed())
+			data := buf.Bytes()
+			Expect((&ot.ExtMessage{}).Decode(bytes.NewReader(data[:len(data)-1]))).NotTo(Succeed())
+		})
+	})
+})
@@ -0,0 +1,56 @@
+package pkg
+
+import (
+	"encoding/binary"
+	"math/big"
+)
+
+// Transcript is a Fiat-Shamir transcript in the spirit of Merlin. It is a domain-separated log of labelled
+// messages, and challenges are derived from the whole log, so that they bind the full context of a proof.
+type Transcript struct {
+	state []byte
+}
+
+// NewTranscript creates a transcript with the given domain separator
+func NewTranscript(domain string) *Transcript {
+	t := &Transcript{}
+	t.AppendMessage("dom-sep", []byte(domain))
+	return t
+}
+
+// AppendMessage absorbs a labelled message into the transcript
+func (t *Transcript) AppendMessage(label string, msg []byte) {
+	t.state = appendFramed(t.state, []byte(label))
+	t.state = appendFramed(t.state, msg)
+}
+
+// AppendUint64 absorbs a labelled integer into the transcript
+func (t *Transcript) AppendUint64(label string, x uint64) {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, x)
+	t.AppendMessage(label, buf)
+}
+
+// Challenge derives a labelled challenge modulo q from the transcript.
+// The challenge is absorbed afterwards, so that subsequent challenges depend on it.
+func (t *Transcript) Challenge(label string, q *big.Int) *big.Int {
+	t.state = appendFramed(t.state, []byte(label))
+	e := HashToBigInt(t.state, q)
+	t.state = appendFramed(t.state, e.Bytes())
+	return e
+}
+
+// Clone returns an independent copy of the transcript
+func (t *Transcript) Clone() *Transcript {
+	state := make([]byte, len(t.state))
+	copy(state, t.state)
+	return &Transcript{state}
+}
+
+// appendFramed appends data prefixed with its length, so that different sequences of messages never collide
+func appendFramed(state, data []byte) []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, uint32(len(data)))
+	state = append(state, buf...)
+	return append(state, data...)
+}
@@ -0,0 +1,83 @@
+package pkg_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/curve"
+	"math/big"
+)
+
+var _ = Describe("Transcript", func() {
+	var (
+		order *big.Int
+		tr    *pkg.Transcript
+	)
+	BeforeEach(func() {
+		order = curve.NewSecp256k1Group().Order()
+		tr = pkg.NewTranscript("test")
+		tr.AppendMessage("label", []byte("x"))
+		tr.AppendUint64("pid", 1)
+	})
+
+	It("Should derive the same challenge from the same messages", func() {
+		other := pkg.NewTranscript("test")
+		other.AppendMessage("label", []byte("x"))
+		other.AppendUint64("pid", 1)
+		Expect(tr.Challenge("e", order)).To(Equal(other.Challenge("e", order)))
+	})
+	It("Should derive challenges reduced modulo the group order", func() {
+		for i := uint64(0); i < 100; i++ {
+			tr.AppendUint64("i", i)
+			e := tr.Challenge("e", order)
+			Expect(e.Sign()).To(BeNumerically(">=", 0))
+			Expect(e.Cmp(order)).To(Equal(-1))
+		}
+	})
+	It("Should separate domains", func() {
+		other := pkg.NewTranscript("other")
+		other.AppendMessage("label", []byte("x"))
+		other.AppendUint64("pid", 1)
+		Expect(tr.Challenge("e", order)).NotTo(Equal(other.Challenge("e", order)))
+	})
+	It("Should bind labels and messages", func() {
+		e := tr.Clone().Challenge("e", order)
+
+		other := pkg.NewTranscript("test")
+		other.AppendMessage("label", []byte("y"))
+		other.AppendUint64("pid", 1)
+		Expect(other.Challenge("e", order)).NotTo(Equal(e))
+
+		other = pkg.NewTranscript("test")
+		other.AppendMessage("label", []byte("x"))
+		other.AppendUint64("pid", 2)
+		Expect(other.Challenge("e", order)).NotTo(Equal(e))
+
+		other = pkg.NewTranscript("test")
+		other.AppendMessage("label", []byte("x"))
+		other.AppendUint64("round", 1)
+		Expect(other.Challenge("e", order)).NotTo(Equal(e))
+
+		Expect(tr.Clone().Challenge("f", order)).NotTo(Equal(e))
+	})
+	It("Should not confuse boundaries between messages", func() {
+		t1 := pkg.NewTranscript("test")
+		t1.AppendMessage("a", []byte("bc"))
+		t2 := pkg.NewTranscript("test")
+		t2.AppendMessage("ab", []byte("c"))
+		Expect(t1.Challenge("e", order)).NotTo(Equal(t2.Challenge("e", order)))
+	})
+	It("Should chain challenges", func() {
+		e1 := tr.Challenge("e", order)
+		e2 := tr.Challenge("e", order)
+		Expect(e1).NotTo(Equal(e2))
+	})
+	It("Should clone independently", func() {
+		clone := tr.Clone()
+		clone.AppendMessage("extra", []byte("data"))
+		Expect(tr.Clone().Challenge("e", order)).NotTo(Equal(clone.Challenge("e", order)))
+
+		clone = tr.Clone()
+		Expect(tr.Challenge("e", order)).To(Equal(clone.Challenge("e", order)))
+	})
+})
@@ -0,0 +1,331 @@
+package zkpok
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/binance-chain/tss-lib/crypto/paillier"
+
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto"
+)
+
+const (
+	//paillierChallengeBits is the length of challenges in proofs about Paillier ciphertexts
+	paillierChallengeBits = 128
+	//statSecurity is the statistical security parameter with which the witnesses are masked
+	statSecurity = 80
+)
+
+//PaillierRangeSlack is the number of bits by which proofs about Paillier plaintexts loosen the range of a witness:
+//a proof for a witness in [0, bound) only guarantees that its absolute value is below bound*2^PaillierRangeSlack.
+const PaillierRangeSlack = paillierChallengeBits + statSecurity + 1
+
+//RingPedersen holds parameters (N, h1, h2) of ring-Pedersen commitments h1^x h2^r mod N of the verifier of proofs about Paillier ciphertexts.
+//Its owner knows the factorization of N and lambda such that h2 = h1^lambda, so it cannot be fooled, and the prover learns nothing from them.
+type RingPedersen struct {
+	n, h1, h2 *big.Int
+}
+
+//NewRingPedersen samples ring-Pedersen parameters over the Paillier modulus of priv.
+//It returns them together with lambda such that h2 = h1^lambda.
+func NewRingPedersen(priv *paillier.PrivateKey) (*RingPedersen, *big.Int, error) {
+	n := priv.PublicKey.N
+	r, err := randUnit(n)
+	if err != nil {
+		return nil, nil, err
+	}
+	h1 := new(big.Int).Exp(r, big.NewInt(2), n)
+	lambda, err := rand.Int(rand.Reader, priv.PhiN)
+	if err != nil {
+		return nil, nil, err
+	}
+	h2 := new(big.Int).Exp(h1, lambda, n)
+	return &RingPedersen{n, h1, h2}, lambda, nil
+}
+
+//N returns the modulus of RingPedersen parameters
+func (rp *RingPedersen) N() *big.Int {
+	return rp.n
+}
+
+//commit computes h1^x h2^r mod N
+func (rp *RingPedersen) commit(x, r *big.Int) *big.Int {
+	c := new(big.Int).Exp(rp.h1, x, rp.n)
+	c.Mul(c, new(big.Int).Exp(rp.h2, r, rp.n))
+	return c.Mod(c, rp.n)
+}
+
+//Encode encodes RingPedersen parameters
+func (rp *RingPedersen) Encode(w io.Writer) error {
+	return encodeInts(w, rp.n, rp.h1, rp.h2)
+}
+
+//Decode decodes RingPedersen parameters
+func (rp *RingPedersen) Decode(r io.Reader) error {
+	xs, err := decodeInts(r, 3)
+	if err != nil {
+		return err
+	}
+	rp.n, rp.h1, rp.h2 = xs[0], xs[1], xs[2]
+	if !inUnits(rp.h1, rp.n) || !inUnits(rp.h2, rp.n) || rp.h1.Cmp(big.NewInt(1)) == 0 || rp.h2.Cmp(big.NewInt(1)) == 0 {
+		return fmt.Errorf("malformed ring-Pedersen parameters")
+	}
+	return nil
+}
+
+//ZKPaillierRange implements proof that a Paillier ciphertext c = Enc(m, r) encrypts a plaintext m in a given range.
+//The range is loosened by PaillierRangeSlack bits.
+type ZKPaillierRange struct {
+	z, u, w   *big.Int
+	s, s1, s2 *big.Int
+}
+
+//NewZKPaillierRange creates ZKPaillierRange proof of knowledge of m in [0, bound) and r such that c = Enc(m, r) under pub,
+//for the verifier with ring-Pedersen parameters rp
+func NewZKPaillierRange(tr *pkg.Transcript, pub *paillier.PublicKey, rp *RingPedersen, c, m, r, bound *big.Int) (*ZKPaillierRange, error) {
+	n2 := pub.NSquare()
+	alpha, err := rand.Int(rand.Reader, mask(bound, paillierChallengeBits+statSecurity))
+	if err != nil {
+		return nil, err
+	}
+	beta, err := randUnit(pub.N)
+	if err != nil {
+		return nil, err
+	}
+	rho, err := rand.Int(rand.Reader, mask(rp.n, statSecurity))
+	if err != nil {
+		return nil, err
+	}
+	gamma, err := rand.Int(rand.Reader, mask(rp.n, paillierChallengeBits+statSecurity))
+	if err != nil {
+		return nil, err
+	}
+
+	z := rp.commit(m, rho)
+	u := new(big.Int).Exp(pub.Gamma(), alpha, n2)
+	u.Mul(u, new(big.Int).Exp(beta, pub.N, n2))
+	u.Mod(u, n2)
+	w := rp.commit(alpha, gamma)
+
+	e := paillierChallenge(tr, "ZKPaillierRange", pub, rp, bound, c, z, u, w)
+
+	s := new(big.Int).Exp(r, e, pub.N)
+	s.Mul(s, beta)
+	s.Mod(s, pub.N)
+	s1 := new(big.Int).Mul(e, m)
+	s1.Add(s1, alpha)
+	s2 := new(big.Int).Mul(e, rho)
+	s2.Add(s2, gamma)
+
+	return &ZKPaillierRange{z: z, u: u, w: w, s: s, s1: s1, s2: s2}, nil
+}
+
+//Verify verifies ZKPaillierRange proof
+func (z *ZKPaillierRange) Verify(tr *pkg.Transcript, pub *paillier.PublicKey, rp *RingPedersen, c, bound *big.Int) error {
+	n2 := pub.NSquare()
+	if !inUnits(c, n2) || !inUnits(z.u, n2) || !inUnits(z.s, pub.N) || !inUnits(z.z, rp.n) || !inUnits(z.w, rp.n) {
+		return fmt.Errorf("verification failed: values out of range")
+	}
+	if z.s1.Cmp(mask(bound, PaillierRangeSlack)) >= 0 {
+		return fmt.Errorf("verification failed: plaintext out of range")
+	}
+
+	e := paillierChallenge(tr, "ZKPaillierRange", pub, rp, bound, c, z.z, z.u, z.w)
+
+	// Gamma^s1 s^N = u c^e mod N^2
+	lhs := new(big.Int).Exp(pub.Gamma(), z.s1, n2)
+	lhs.Mul(lhs, new(big.Int).Exp(z.s, pub.N, n2))
+	lhs.Mod(lhs, n2)
+	rhs := new(big.Int).Exp(c, e, n2)
+	rhs.Mul(rhs, z.u)
+	rhs.Mod(rhs, n2)
+	if lhs.Cmp(rhs) != 0 {
+		return fmt.Errorf("verification failed: ciphertext")
+	}
+
+	// h1^s1 h2^s2 = w z^e mod N~
+	rhs.Exp(z.z, e, rp.n)
+	rhs.Mul(rhs, z.w)
+	rhs.Mod(rhs, rp.n)
+	if rp.commit(z.s1, z.s2).Cmp(rhs) != 0 {
+		return fmt.Errorf("verification failed: commitment")
+	}
+	return nil
+}
+
+//Encode encodes ZKPaillierRange proof
+func (z *ZKPaillierRange) Encode(w io.Writer) error {
+	return encodeInts(w, z.z, z.u, z.w, z.s, z.s1, z.s2)
+}
+
+//Decode decodes ZKPaillierRange proof
+func (z *ZKPaillierRange) Decode(r io.Reader) error {
+	xs, err := decodeInts(r, 6)
+	if err != nil {
+		return err
+	}
+	z.z, z.u, z.w, z.s, z.s1, z.s2 = xs[0], xs[1], xs[2], xs[3], xs[4], xs[5]
+	return nil
+}
+
+//ZKPaillierAffine implements proof that a Paillier ciphertext c2 = c1^x Enc(y, r) is obtained from c1 by an affine operation
+//with x and y in given ranges. The ranges are loosened by PaillierRangeSlack bits.
+type ZKPaillierAffine struct {
+	z, zp, t, v, w    *big.Int
+	s, s1, s2, t1, t2 *big.Int
+}
+
+//NewZKPaillierAffine creates ZKPaillierAffine proof of knowledge of x in [0, xBound), y in [0, yBound) and r such that
+//c2 = c1^x Enc(y, r) under pub, for the verifier with ring-Pedersen parameters rp
+func NewZKPaillierAffine(tr *pkg.Transcript, pub *paillier.PublicKey, rp *RingPedersen, c1, c2, x, y, r, xBound, yBound *big.Int) (*ZKPaillierAffine, error) {
+	n2 := pub.NSquare()
+	bounds := []*big.Int{
+		mask(xBound, paillierChallengeBits+statSecurity), // alpha
+		mask(rp.n, statSecurity),                         // rho
+		mask(rp.n, paillierChallengeBits+statSecurity),   // rho'
+		mask(rp.n, statSecurity),                         // sigma
+		mask(yBound, paillierChallengeBits+statSecurity), // gamma
+		mask(rp.n, paillierChallengeBits+statSecurity),   // tau
+	}
+	rnds := make([]*big.Int, len(bounds))
+	for i, bound := range bounds {
+		var err error
+		if rnds[i], err = rand.Int(rand.Reader, bound); err != nil {
+			return nil, err
+		}
+	}
+	alpha, rho, rhop, sigma, gamma, tau := rnds[0], rnds[1], rnds[2], rnds[3], rnds[4], rnds[5]
+	beta, err := randUnit(pub.N)
+	if err != nil {
+		return nil, err
+	}
+
+	z := rp.commit(x, rho)
+	zp := rp.commit(alpha, rhop)
+	t := rp.commit(y, sigma)
+	v := new(big.Int).Exp(c1, alpha, n2)
+	v.Mul(v, new(big.Int).Exp(pub.Gamma(), gamma, n2))
+	v.Mul(v, new(big.Int).Exp(beta, pub.N, n2))
+	v.Mod(v, n2)
+	w := rp.commit(gamma, tau)
+
+	e := paillierChallenge(tr, "ZKPaillierAffine", pub, rp, xBound, yBound, c1, c2, z, zp, t, v, w)
+
+	s := new(big.Int).Exp(r, e, pub.N)
+	s.Mul(s, beta)
+	s.Mod(s, pub.N)
+	affine := func(a, b *big.Int) *big.Int {
+		result := new(big.Int).Mul(e, a)
+		return result.Add(result, b)
+	}
+
+	return &ZKPaillierAffine{
+		z: z, zp: zp, t: t, v: v, w: w,
+		s:  s,
+		s1: affine(x, alpha),
+		s2: affine(rho, rhop),
+		t1: affine(y, gamma),
+		t2: affine(sigma, tau),
+	}, nil
+}
+
+//Verify verifies ZKPaillierAffine proof
+func (z *ZKPaillierAffine) Verify(tr *pkg.Transcript, pub *paillier.PublicKey, rp *RingPedersen, c1, c2, xBound, yBound *big.Int) error {
+	n2 := pub.NSquare()
+	if !inUnits(c1, n2) || !inUnits(c2, n2) || !inUnits(z.v, n2) || !inUnits(z.s, pub.N) {
+		return fmt.Errorf("verification failed: values out of range")
+	}
+	for _, x := range []*big.Int{z.z, z.zp, z.t, z.w} {
+		if !inUnits(x, rp.n) {
+			return fmt.Errorf("verification failed: values out of range")
+		}
+	}
+	if z.s1.Cmp(mask(xBound, PaillierRangeSlack)) >= 0 || z.t1.Cmp(mask(yBound, PaillierRangeSlack)) >= 0 {
+		return fmt.Errorf("verification failed: witness out of range")
+	}
+
+	e := paillierChallenge(tr, "ZKPaillierAffine", pub, rp, xBound, yBound, c1, c2, z.z, z.zp, z.t, z.v, z.w)
+
+	// c1^s1 Gamma^t1 s^N = c2^e v mod N^2
+	lhs := new(big.Int).Exp(c1, z.s1, n2)
+	lhs.Mul(lhs, new(big.Int).Exp(pub.Gamma(), z.t1, n2))
+	lhs.Mul(lhs, new(big.Int).Exp(z.s, pub.N, n2))
+	lhs.Mod(lhs, n2)
+	rhs := new(big.Int).Exp(c2, e, n2)
+	rhs.Mul(rhs, z.v)
+	rhs.Mod(rhs, n2)
+	if lhs.Cmp(rhs) != 0 {
+		return fmt.Errorf("verification failed: ciphertext")
+	}
+
+	// h1^s1 h2^s2 = z^e z' and h1^t1 h2^t2 = t^e w mod N~
+	rhs.Exp(z.z, e, rp.n)
+	rhs.Mul(rhs, z.zp)
+	rhs.Mod(rhs, rp.n)
+	if rp.commit(z.s1, z.s2).Cmp(rhs) != 0 {
+		return fmt.Errorf("verification failed: commitment to x")
+	}
+	rhs.Exp(z.t, e, rp.n)
+	rhs.Mul(rhs, z.w)
+	rhs.Mod(rhs, rp.n)
+	if rp.commit(z.t1, z.t2).Cmp(rhs) != 0 {
+		return fmt.Errorf("verification failed: commitment to y")
+	}
+	return nil
+}
+
+//Encode encodes ZKPaillierAffine proof
+func (z *ZKPaillierAffine) Encode(w io.Writer) error {
+	return encodeInts(w, z.z, z.zp, z.t, z.v, z.w, z.s, z.s1, z.s2, z.t1, z.t2)
+}
+
+//Decode decodes ZKPaillierAffine proof
+func (z *ZKPaillierAffine) Decode(r io.Reader) error {
+	xs, err := decodeInts(r, 10)
+	if err != nil {
+		return err
+	}
+	z.z, z.zp, z.t, z.v, z.w = xs[0], xs[1], xs[2], xs[3], xs[4]
+	z.s, z.s1, z.s2, z.t1, z.t2 = xs[5], xs[6], xs[7], xs[8], xs[9]
+	return nil
+}
+
+//paillierChallenge computes the Fiat-Shamir challenge of the named proof about Paillier ciphertexts.
+//The challenge is derived from a copy of tr with the name, the keys and the given integers absorbed.
+func paillierChallenge(tr *pkg.Transcript, name string, pub *paillier.PublicKey, rp *RingPedersen, xs ...*big.Int) *big.Int {
+	t := tr.Clone()
+	t.AppendMessage("proof", []byte(name))
+	t.AppendMessage("N", pub.N.Bytes())
+	t.AppendMessage("N~", rp.n.Bytes())
+	t.AppendMessage("h1", rp.h1.Bytes())
+	t.AppendMessage("h2", rp.h2.Bytes())
+	for _, x := range xs {
+		t.AppendMessage("int", x.Bytes())
+	}
+	return t.Challenge("e", new(big.Int).Lsh(big.NewInt(1), paillierChallengeBits))
+}
+
+//mask returns x*2^bits
+func mask(x *big.Int, bits uint) *big.Int {
+	return new(big.Int).Lsh(x, bits)
+}
+
+//inUnits checks if x is in (0, n) and coprime to n
+func inUnits(x, n *big.Int) bool {
+	return x.Sign() > 0 && x.Cmp(n) < 0 && new(big.Int).GCD(nil, nil, x, n).Cmp(big.NewInt(1)) == 0
+}
+
+//randUnit samples a uniformly random element of Z*_n
+func randUnit(n *big.Int) (*big.Int, error) {
+	for {
+		x, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return nil, err
+		}
+		if inUnits(x, n) {
+			return x, nil
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package zkpok
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/binance-chain/tss-lib/crypto/paillier"
+
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto"
+)
+
+//paillierKeyRounds is the number of repetitions of proofs about Paillier keys with binary challenges
+const paillierKeyRounds = statSecurity
+
+//ZKRingPedersen implements proof that the parameters h1, h2 of RingPedersen are such that h2 = h1^lambda
+//for lambda known to the owner of the parameters
+type ZKRingPedersen struct {
+	a, z []*big.Int
+}
+
+//NewZKRingPedersen creates ZKRingPedersen proof for the parameters rp over the Paillier modulus of priv and lambda returned by NewRingPedersen
+func NewZKRingPedersen(tr *pkg.Transcript, priv *paillier.PrivateKey, rp *RingPedersen, lambda *big.Int) (*ZKRingPedersen, error) {
+	phi := priv.PhiN
+	rnds := make([]*big.Int, paillierKeyRounds)
+	a := make([]*big.Int, paillierKeyRounds)
+	for i := range a {
+		var err error
+		if rnds[i], err = rand.Int(rand.Reader, phi); err != nil {
+			return nil, err
+		}
+		a[i] = new(big.Int).Exp(rp.h1, rnds[i], rp.n)
+	}
+
+	e := ringPedersenChallenge(tr, rp, a)
+
+	z := make([]*big.Int, paillierKeyRounds)
+	for i := range z {
+		z[i] = new(big.Int).Set(rnds[i])
+		if e.Bit(i) == 1 {
+			z[i].Add(z[i], lambda)
+			z[i].Mod(z[i], phi)
+		}
+	}
+	return &ZKRingPedersen{a, z}, nil
+}
+
+//Verify verifies ZKRingPedersen proof
+func (z *ZKRingPedersen) Verify(tr *pkg.Transcript, rp *RingPedersen) error {
+	if len(z.a) != paillierKeyRounds || len(z.z) != paillierKeyRounds {
+		return fmt.Errorf("verification failed: wrong number of repetitions")
+	}
+	for _, a := range z.a {
+		if !inUnits(a, rp.n) {
+			return fmt.Errorf("verification failed: values out of range")
+		}
+	}
+
+	e := ringPedersenChallenge(tr, rp, z.a)
+
+	// h1^z = a h2^e mod N
+	lhs := new(big.Int)
+	rhs := new(big.Int)
+	for i := range z.a {
+		lhs.Exp(rp.h1, z.z[i], rp.n)
+		rhs.Set(z.a[i])
+		if e.Bit(i) == 1 {
+			rhs.Mul(rhs, rp.h2)
+			rhs.Mod(rhs, rp.n)
+		}
+		if lhs.Cmp(rhs) != 0 {
+			return fmt.Errorf("verification failed: repetition %v", i)
+		}
+	}
+	return nil
+}
+
+//Encode encodes ZKRingPedersen proof
+func (z *ZKRingPedersen) Encode(w io.Writer) error {
+	return encodeInts(w, append(append([]*big.Int{}, z.a...), z.z...)...)
+}
+
+//Decode decodes ZKRingPedersen proof
+func (z *ZKRingPedersen) Decode(r io.Reader) error {
+	xs, err := decodeInts(r, 2*paillierKeyRounds)
+	if err != nil {
+		return err
+	}
+	z.a, z.z = xs[:paillierKeyRounds], xs[paillierKeyRounds:]
+	return nil
+}
+
+//ringPedersenChallenge computes paillierKeyRounds challenge bits of ZKRingPedersen
+func ringPedersenChallenge(tr *pkg.Transcript, rp *RingPedersen, a []*big.Int) *big.Int {
+	t := tr.Clone()
+	t.AppendMessage("proof", []byte("ZKRingPedersen"))
+	t.AppendMessage("N~", rp.n.Bytes())
+	t.AppendMessage("h1", rp.h1.Bytes())
+	t.AppendMessage("h2", rp.h2.Bytes())
+	for _, x := range a {
+		t.AppendMessage("int", x.Bytes())
+	}
+	return t.Challenge("e", new(big.Int).Lsh(big.NewInt(1), paillierKeyRounds))
+}
+
+//ZKPaillierBlum implements proof that a Paillier modulus N is a product of two primes congruent to 3 mod 4
+//and is coprime to its totient, by showing that every challenge has an N-th root and, up to a fixed
+//non-square w and the sign, a fourth root.
+type ZKPaillierBlum struct {
+	w    *big.Int
+	a, b *big.Int
+	x, z []*big.Int
+}
+
+//NewZKPaillierBlum creates ZKPaillierBlum proof for the modulus of priv
+func NewZKPaillierBlum(tr *pkg.Transcript, priv *paillier.PrivateKey) (*ZKPaillierBlum, error) {
+	n := priv.PublicKey.N
+	p, q, err := factor(priv)
+	if err != nil {
+		return nil, err
+	}
+	if p.Bit(0) != 1 || p.Bit(1) != 1 || q.Bit(0) != 1 || q.Bit(1) != 1 {
+		return nil, fmt.Errorf("the factors of the Paillier modulus are not congruent to 3 mod 4")
+	}
+	nInv := new(big.Int).ModInverse(n, priv.PhiN)
+	if nInv == nil {
+		return nil, fmt.Errorf("the Paillier modulus is not coprime to its totient")
+	}
+
+	var w *big.Int
+	for w == nil || big.Jacobi(w, n) != -1 {
+		if w, err = randUnit(n); err != nil {
+			return nil, err
+		}
+	}
+
+	ys, err := blumChallenge(tr, n, w)
+	if err != nil {
+		return nil, err
+	}
+
+	z := &ZKPaillierBlum{w: w, a: new(big.Int), b: new(big.Int), x: make([]*big.Int, paillierKeyRounds), z: make([]*big.Int, paillierKeyRounds)}
+	minusOne := new(big.Int).Sub(n, big.NewInt(1))
+	for i, y := range ys {
+		z.z[i] = new(big.Int).Exp(y, nInv, n)
+
+		// exactly one of y, -y, wy, -wy is a square both mod p and mod q
+		found := false
+		for _, ab := range [][2]uint{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+			yp := new(big.Int).Set(y)
+			if ab[0] == 1 {
+				yp.Mul(yp, minusOne)
+			}
+			if ab[1] == 1 {
+				yp.Mul(yp, w)
+			}
+			yp.Mod(yp, n)
+			if big.Jacobi(yp, p) == 1 && big.Jacobi(yp, q) == 1 {
+				z.x[i] = fourthRoot(yp, p, q, n)
+				z.a.SetBit(z.a, i, ab[0])
+				z.b.SetBit(z.b, i, ab[1])
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no fourth root of the challenge %v", i)
+		}
+	}
+	return z, nil
+}
+
+//Verify verifies ZKPaillierBlum proof for the modulus of pub
+func (z *ZKPaillierBlum) Verify(tr *pkg.Transcript, pub *paillier.PublicKey) error {
+	n := pub.N
+	if n.Bit(0) != 1 || n.ProbablyPrime(20) {
+		return fmt.Errorf("verification failed: the modulus is not an odd composite")
+	}
+	if len(z.x) != paillierKeyRounds || len(z.z) != paillierKeyRounds {
+		return fmt.Errorf("verification failed: wrong number of repetitions")
+	}
+	if !inUnits(z.w, n) || big.Jacobi(z.w, n) != -1 {
+		return fmt.Errorf("verification failed: w is not a non-square with Jacobi symbol -1")
+	}
+
+	ys, err := blumChallenge(tr, n, z.w)
+	if err != nil {
+		return fmt.Errorf("verification failed: %v", err)
+	}
+
+	lhs := new(big.Int)
+	rhs := new(big.Int)
+	four := big.NewInt(4)
+	for i, y := range ys {
+		// z^N = y mod N
+		if lhs.Exp(z.z[i], n, n).Cmp(y) != 0 {
+			return fmt.Errorf("verification failed: N-th root in repetition %v", i)
+		}
+
+		// x^4 = (-1)^a w^b y mod N
+		rhs.Set(y)
+		if z.a.Bit(i) == 1 {
+			rhs.Neg(rhs)
+		}
+		if z.b.Bit(i) == 1 {
+			rhs.Mul(rhs, z.w)
+		}
+		rhs.Mod(rhs, n)
+		if lhs.Exp(z.x[i], four, n).Cmp(rhs) != 0 {
+			return fmt.Errorf("verification failed: fourth root in repetition %v", i)
+		}
+	}
+	return nil
+}
+
+//Encode encodes ZKPaillierBlum proof
+func (z *ZKPaillierBlum) Encode(w io.Writer) error {
+	xs := append([]*big.Int{z.w, z.a, z.b}, z.x...)
+	return encodeInts(w, append(xs, z.z...)...)
+}
+
+//Decode decodes ZKPaillierBlum proof
+func (z *ZKPaillierBlum) Decode(r io.Reader) error {
+	xs, err := decodeInts(r, 3+2*paillierKeyRounds)
+	if err != nil {
+		return err
+	}
+	z.w, z.a, z.b = xs[0], xs[1], xs[2]
+	z.x, z.z = xs[3:3+paillierKeyRounds], xs[3+paillierKeyRounds:]
+	return nil
+}
+
+//blumChallenge derives paillierKeyRounds challenges in Z*_N of ZKPaillierBlum
+func blumChallenge(tr *pkg.Transcript, n, w *big.Int) ([]*big.Int, error) {
+	t := tr.Clone()
+	t.AppendMessage("proof", []byte("ZKPaillierBlum"))
+	t.AppendMessage("N", n.Bytes())
+	t.AppendMessage("w", w.Bytes())
+	ys := make([]*big.Int, paillierKeyRounds)
+	for i := range ys {
+		ys[i] = t.Challenge("y", n)
+		if !inUnits(ys[i], n) {
+			return nil, fmt.Errorf("challenge %v is not a unit", i)
+		}
+	}
+	return ys, nil
+}
+
+//fourthRoot computes the fourth root of y mod N = pq, which is a square of a square both mod p and mod q.
+//Since p = 3 mod 4, the square root of a square mod p that is itself a square is y^((p+1)/4).
+func fourthRoot(y, p, q, n *big.Int) *big.Int {
+	root := func(prime *big.Int) *big.Int {
+		e := new(big.Int).Add(prime, big.NewInt(1))
+		e.Rsh(e, 2)
+		e.Mul(e, e)
+		return new(big.Int).Exp(y, e, prime)
+	}
+	xp, xq := root(p), root(q)
+
+	// CRT: x = xp + p((xq - xp) p^-1 mod q)
+	x := new(big.Int).Sub(xq, xp)
+	x.Mul(x, new(big.Int).ModInverse(p, q))
+	x.Mod(x, q)
+	x.Mul(x, p)
+	x.Add(x, xp)
+	return x.Mod(x, n)
+}
+
+//ZKNoSmallFactor implements proof that a Paillier modulus N = pq has no factors smaller than sqrt(N)/2^PaillierRangeSlack.
+//It shows knowledge of p and q below sqrt(N)*2^PaillierRangeSlack, committed with ring-Pedersen parameters of the verifier,
+//such that N = pq.
+type ZKNoSmallFactor struct {
+	p, q, a, b, t, sigma *big.Int
+	z1, z2, w1, w2, v    *big.Int
+}
+
+//NewZKNoSmallFactor creates ZKNoSmallFactor proof for the modulus of priv, for the verifier with ring-Pedersen parameters rp
+func NewZKNoSmallFactor(tr *pkg.Transcript, priv *paillier.PrivateKey, rp *RingPedersen) (*ZKNoSmallFactor, error) {
+	n0 := priv.PublicKey.N
+	p, q, err := factor(priv)
+	if err != nil {
+		return nil, err
+	}
+	sqrtN0 := new(big.Int).Sqrt(n0)
+	n0rp := new(big.Int).Mul(n0, rp.n)
+	bounds := []*big.Int{
+		mask(sqrtN0, paillierChallengeBits+statSecurity), // alpha
+		mask(sqrtN0, paillierChallengeBits+statSecurity), // beta
+		mask(rp.n, statSecurity),                         // mu
+		mask(rp.n, statSecurity),                         // nu
+		mask(n0rp, statSecurity),                         // sigma
+		mask(n0rp, paillierChallengeBits+statSecurity),   // r
+		mask(rp.n, paillierChallengeBits+statSecurity),   // x
+		mask(rp.n, paillierChallengeBits+statSecurity),   // y
+	}
+	rnds := make([]*big.Int, len(bounds))
+	for i, bound := range bounds {
+		if rnds[i], err = rand.Int(rand.Reader, bound); err != nil {
+			return nil, err
+		}
+	}
+	alpha, beta, mu, nu, sigma, r, x, y := rnds[0], rnds[1], rnds[2], rnds[3], rnds[4], rnds[5], rnds[6], rnds[7]
+	// v = r + e(sigma - nu p) has to be nonnegative, and e nu p is below n0rp*2^paillierChallengeBits
+	r.Add(r, mask(n0rp, paillierChallengeBits))
+
+	commP := rp.commit(p, mu)
+	commQ := rp.commit(q, nu)
+	a := rp.commit(alpha, x)
+	b := rp.commit(beta, y)
+	t := new(big.Int).Exp(commQ, alpha, rp.n)
+	t.Mul(t, new(big.Int).Exp(rp.h2, r, rp.n))
+	t.Mod(t, rp.n)
+
+	e := paillierChallenge(tr, "ZKNoSmallFactor", &priv.PublicKey, rp, commP, commQ, a, b, t, sigma)
+
+	affine := func(x, y *big.Int) *big.Int {
+		result := new(big.Int).Mul(e, x)
+		return result.Add(result, y)
+	}
+	v := new(big.Int).Mul(nu, p)
+	v.Sub(sigma, v)
+	return &ZKNoSmallFactor{
+		p: commP, q: commQ, a: a, b: b, t: t, sigma: sigma,
+		z1: affine(p, alpha),
+		z2: affine(q, beta),
+		w1: affine(mu, x),
+		w2: affine(nu, y),
+		v:  affine(v, r),
+	}, nil
+}
+
+//Verify verifies ZKNoSmallFactor proof for the modulus of pub
+func (z *ZKNoSmallFactor) Verify(tr *pkg.Transcript, pub *paillier.PublicKey, rp *RingPedersen) error {
+	n0 := pub.N
+	for _, x := range []*big.Int{z.p, z.q, z.a, z.b, z.t} {
+		if !inUnits(x, rp.n) {
+			return fmt.Errorf("verification failed: values out of range")
+		}
+	}
+	bound := mask(new(big.Int).Sqrt(n0), PaillierRangeSlack)
+	if z.z1.Cmp(bound) >= 0 || z.z2.Cmp(bound) >= 0 {
+		return fmt.Errorf("verification failed: factors out of range")
+	}
+
+	e := paillierChallenge(tr, "ZKNoSmallFactor", pub, rp, z.p, z.q, z.a, z.b, z.t, z.sigma)
+
+	// h1^z1 h2^w1 = a p^e, h1^z2 h2^w2 = b q^e and q^z1 h2^v = t (h1^N0 h2^sigma)^e mod N~
+	rhs := new(big.Int)
+	check := func(lhs, base, comm *big.Int) bool {
+		rhs.Exp(comm, e, rp.n)
+		rhs.Mul(rhs, base)
+		rhs.Mod(rhs, rp.n)
+		return lhs.Cmp(rhs) == 0
+	}
+	if !check(rp.commit(z.z1, z.w1), z.a, z.p) {
+		return fmt.Errorf("verification failed: commitment to p")
+	}
+	if !check(rp.commit(z.z2, z.w2), z.b, z.q) {
+		return fmt.Errorf("verification failed: commitment to q")
+	}
+	lhs := new(big.Int).Exp(z.q, z.z1, rp.n)
+	lhs.Mul(lhs, new(big.Int).Exp(rp.h2, z.v, rp.n))
+	lhs.Mod(lhs, rp.n)
+	if !check(lhs, z.t, rp.commit(n0, z.sigma)) {
+		return fmt.Errorf("verification failed: product of the factors")
+	}
+	return nil
+}
+
+//Encode encodes ZKNoSmallFactor proof
+func (z *ZKNoSmallFactor) Encode(w io.Writer) error {
+	return encodeInts(w, z.p, z.q, z.a, z.b, z.t, z.sigma, z.z1, z.z2, z.w1, z.w2, z.v)
+}
+
+//Decode decodes ZKNoSmallFactor proof
+func (z *ZKNoSmallFactor) Decode(r io.Reader) error {
+	xs, err := decodeInts(r, 11)
+	if err != nil {
+		return err
+	}
+	z.p, z.q, z.a, z.b, z.t, z.sigma = xs[0], xs[1], xs[2], xs[3], xs[4], xs[5]
+	z.z1, z.z2, z.w1, z.w2, z.v = xs[6], xs[7], xs[8], xs[9], xs[10]
+	return nil
+}
+
+//factor recovers the primes p < q of the Paillier modulus N of priv from N and phi(N) = N - (p + q) + 1
+func factor(priv *paillier.PrivateKey) (*big.Int, *big.Int, error) {
+	n := priv.PublicKey.N
+	sum := new(big.Int).Sub(n, priv.PhiN)
+	sum.Add(sum, big.NewInt(1))
+	// p and q are the roots of x^2 - sum x + N
+	delta := new(big.Int).Mul(sum, sum)
+	delta.Sub(delta, new(big.Int).Lsh(n, 2))
+	if delta.Sign() < 0 {
+		return nil, nil, fmt.Errorf("malformed Paillier private key")
+	}
+	sqrtDelta := new(big.Int).Sqrt(delta)
+	p := new(big.Int).Sub(sum, sqrtDelta)
+	p.Rsh(p, 1)
+	q := new(big.Int).Add(sum, sqrtDelta)
+	q.Rsh(q, 1)
+	if new(big.Int).Mul(p, q).Cmp(n) != 0 {
+		return nil, nil, fmt.Errorf("malformed Paillier private key")
+	}
+	return p, q, nil
+}
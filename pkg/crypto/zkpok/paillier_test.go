@@ -0,0 +1,298 @@
+package zkpok_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/big"
+	"time"
+
+	"github.com/binance-chain/tss-lib/crypto/paillier"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/zkpok"
+)
+
+var _ = Describe("Paillier proofs", func() {
+	var (
+		pub, verifierPub *paillier.PublicKey
+		rp               *zkpok.RingPedersen
+		bound, m, r      *big.Int
+		c                *big.Int
+		tr               *pkg.Transcript
+		err              error
+	)
+
+	BeforeEach(func() {
+		// keys are generated once, as it takes a while
+		if pub == nil {
+			_, pub, err = paillier.GenerateKeyPair(1024, 30*time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			var verifierPriv *paillier.PrivateKey
+			verifierPriv, verifierPub, err = paillier.GenerateKeyPair(1024, 30*time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			rp, _, err = zkpok.NewRingPedersen(verifierPriv)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		bound = new(big.Int).Lsh(big.NewInt(1), 256)
+		m = big.NewInt(1729)
+		c, r, err = pub.EncryptAndReturnRandomness(m)
+		Expect(err).NotTo(HaveOccurred())
+		tr = context("a", 1, 0)
+	})
+
+	Describe("RingPedersen", func() {
+		It("Encode-Decode Test", func() {
+			buf := &bytes.Buffer{}
+			Expect(rp.Encode(buf)).To(Succeed())
+			var decoded zkpok.RingPedersen
+			Expect(decoded.Decode(buf)).To(Succeed())
+			Expect(decoded.N()).To(Equal(verifierPub.N))
+			Expect(&decoded).To(Equal(rp))
+		})
+	})
+
+	Describe("ZKPaillierRange", func() {
+		It("Verify Correct Proof", func() {
+			z, err := zkpok.NewZKPaillierRange(tr, pub, rp, c, m, r, bound)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("a", 1, 0), pub, rp, c, bound)).To(Succeed())
+		})
+		It("Verify Proof for a different ciphertext", func() {
+			z, err := zkpok.NewZKPaillierRange(tr, pub, rp, c, m, r, bound)
+			Expect(err).NotTo(HaveOccurred())
+			c2, err := pub.Encrypt(m)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("a", 1, 0), pub, rp, c2, bound)).NotTo(Succeed())
+		})
+		It("Verify Proof with a wrong witness", func() {
+			z, err := zkpok.NewZKPaillierRange(tr, pub, rp, c, big.NewInt(1730), r, bound)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("a", 1, 0), pub, rp, c, bound)).NotTo(Succeed())
+		})
+		It("Verify Proof for a plaintext far out of range", func() {
+			m = mask(bound, zkpok.PaillierRangeSlack)
+			c, r, err = pub.EncryptAndReturnRandomness(m)
+			Expect(err).NotTo(HaveOccurred())
+			z, err := zkpok.NewZKPaillierRange(tr, pub, rp, c, m, r, bound)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("a", 1, 0), pub, rp, c, bound)).NotTo(Succeed())
+		})
+		It("Should bind the proof to its context", func() {
+			z, err := zkpok.NewZKPaillierRange(tr, pub, rp, c, m, r, bound)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("a", 1, 1), pub, rp, c, bound)).NotTo(Succeed())
+		})
+		It("Encode-Decode Test", func() {
+			z, err := zkpok.NewZKPaillierRange(tr, pub, rp, c, m, r, bound)
+			Expect(err).NotTo(HaveOccurred())
+			buf := &bytes.Buffer{}
+			Expect(z.Encode(buf)).To(Succeed())
+			var decoded zkpok.ZKPaillierRange
+			Expect(decoded.Decode(buf)).To(Succeed())
+			Expect(decoded.Verify(context("a", 1, 0), pub, rp, c, bound)).To(Succeed())
+		})
+	})
+
+	Describe("ZKPaillierAffine", func() {
+		var (
+			x, y, yBound, ry, c2 *big.Int
+		)
+
+		BeforeEach(func() {
+			x = big.NewInt(42)
+			y = big.NewInt(314159)
+			yBound = new(big.Int).Lsh(big.NewInt(1), 512)
+			var encY *big.Int
+			encY, ry, err = pub.EncryptAndReturnRandomness(y)
+			Expect(err).NotTo(HaveOccurred())
+			c2, err = pub.HomoMult(x, c)
+			Expect(err).NotTo(HaveOccurred())
+			c2, err = pub.HomoAdd(c2, encY)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Verify Correct Proof", func() {
+			z, err := zkpok.NewZKPaillierAffine(tr, pub, rp, c, c2, x, y, ry, bound, yBound)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("a", 1, 0), pub, rp, c, c2, bound, yBound)).To(Succeed())
+		})
+		It("Verify Proof for a different ciphertext", func() {
+			z, err := zkpok.NewZKPaillierAffine(tr, pub, rp, c, c2, x, y, ry, bound, yBound)
+			Expect(err).NotTo(HaveOccurred())
+			shifted, err := pub.HomoAdd(c2, c)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("a", 1, 0), pub, rp, c, shifted, bound, yBound)).NotTo(Succeed())
+		})
+		It("Verify Proof with a wrong witness", func() {
+			z, err := zkpok.NewZKPaillierAffine(tr, pub, rp, c, c2, big.NewInt(43), y, ry, bound, yBound)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("a", 1, 0), pub, rp, c, c2, bound, yBound)).NotTo(Succeed())
+		})
+		It("Verify Proof for a multiplier far out of range", func() {
+			x = mask(bound, zkpok.PaillierRangeSlack)
+			c2, err = pub.HomoMult(x, c)
+			Expect(err).NotTo(HaveOccurred())
+			z, err := zkpok.NewZKPaillierAffine(tr, pub, rp, c, c2, x, big.NewInt(0), big.NewInt(1), bound, yBound)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("a", 1, 0), pub, rp, c, c2, bound, yBound)).NotTo(Succeed())
+		})
+		It("Should bind the proof to its context", func() {
+			z, err := zkpok.NewZKPaillierAffine(tr, pub, rp, c, c2, x, y, ry, bound, yBound)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("b", 1, 0), pub, rp, c, c2, bound, yBound)).NotTo(Succeed())
+		})
+		It("Encode-Decode Test", func() {
+			z, err := zkpok.NewZKPaillierAffine(tr, pub, rp, c, c2, x, y, ry, bound, yBound)
+			Expect(err).NotTo(HaveOccurred())
+			buf := &bytes.Buffer{}
+			Expect(z.Encode(buf)).To(Succeed())
+			var decoded zkpok.ZKPaillierAffine
+			Expect(decoded.Decode(buf)).To(Succeed())
+			Expect(decoded.Verify(context("a", 1, 0), pub, rp, c, c2, bound, yBound)).To(Succeed())
+		})
+	})
+})
+
+var _ = Describe("Paillier key proofs", func() {
+	var (
+		priv, smallPriv *paillier.PrivateKey
+		pub, smallPub   *paillier.PublicKey
+		rp              *zkpok.RingPedersen
+		lambda          *big.Int
+		tr              *pkg.Transcript
+		err             error
+	)
+
+	BeforeEach(func() {
+		// keys are generated once, as it takes a while
+		if priv == nil {
+			priv, pub, err = paillier.GenerateKeyPair(1024, 30*time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			rp, lambda, err = zkpok.NewRingPedersen(priv)
+			Expect(err).NotTo(HaveOccurred())
+
+			// a Paillier-Blum modulus of the same length with a 64-bit factor
+			p, q := blumPrime(64), blumPrime(960)
+			pm, qm := new(big.Int).Sub(p, big.NewInt(1)), new(big.Int).Sub(q, big.NewInt(1))
+			phi := new(big.Int).Mul(pm, qm)
+			smallPub = &paillier.PublicKey{N: new(big.Int).Mul(p, q)}
+			smallPriv = &paillier.PrivateKey{PublicKey: *smallPub, LambdaN: new(big.Int).Div(phi, new(big.Int).GCD(nil, nil, pm, qm)), PhiN: phi}
+		}
+		tr = context("paillier", 0, 0)
+	})
+
+	Describe("ZKRingPedersen", func() {
+		It("Verify Correct Proof", func() {
+			z, err := zkpok.NewZKRingPedersen(tr, priv, rp, lambda)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("paillier", 0, 0), rp)).To(Succeed())
+		})
+		It("Verify Proof with a wrong witness", func() {
+			z, err := zkpok.NewZKRingPedersen(tr, priv, rp, new(big.Int).Add(lambda, big.NewInt(1)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("paillier", 0, 0), rp)).NotTo(Succeed())
+		})
+		It("Should bind the proof to its context", func() {
+			z, err := zkpok.NewZKRingPedersen(tr, priv, rp, lambda)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("paillier", 0, 1), rp)).NotTo(Succeed())
+		})
+		It("Encode-Decode Test", func() {
+			z, err := zkpok.NewZKRingPedersen(tr, priv, rp, lambda)
+			Expect(err).NotTo(HaveOccurred())
+			buf := &bytes.Buffer{}
+			Expect(z.Encode(buf)).To(Succeed())
+			var decoded zkpok.ZKRingPedersen
+			Expect(decoded.Decode(buf)).To(Succeed())
+			Expect(decoded.Verify(context("paillier", 0, 0), rp)).To(Succeed())
+		})
+	})
+
+	Describe("ZKPaillierBlum", func() {
+		It("Verify Correct Proof", func() {
+			z, err := zkpok.NewZKPaillierBlum(tr, priv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("paillier", 0, 0), pub)).To(Succeed())
+		})
+		It("Verify Proof for a different modulus", func() {
+			z, err := zkpok.NewZKPaillierBlum(tr, priv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("paillier", 0, 0), smallPub)).NotTo(Succeed())
+		})
+		It("Should refuse to prove for a modulus with a factor not congruent to 3 mod 4", func() {
+			p, q := blumPrime(512), blumPrime(512)
+			p.Add(p, big.NewInt(2))
+			for !p.ProbablyPrime(20) || p.Bit(1) == 1 {
+				p.Add(p, big.NewInt(2))
+			}
+			phi := new(big.Int).Mul(new(big.Int).Sub(p, big.NewInt(1)), new(big.Int).Sub(q, big.NewInt(1)))
+			bad := &paillier.PrivateKey{PublicKey: paillier.PublicKey{N: new(big.Int).Mul(p, q)}, PhiN: phi}
+			_, err := zkpok.NewZKPaillierBlum(tr, bad)
+			Expect(err).To(HaveOccurred())
+		})
+		It("Should bind the proof to its context", func() {
+			z, err := zkpok.NewZKPaillierBlum(tr, priv)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("paillier", 1, 0), pub)).NotTo(Succeed())
+		})
+		It("Encode-Decode Test", func() {
+			z, err := zkpok.NewZKPaillierBlum(tr, priv)
+			Expect(err).NotTo(HaveOccurred())
+			buf := &bytes.Buffer{}
+			Expect(z.Encode(buf)).To(Succeed())
+			var decoded zkpok.ZKPaillierBlum
+			Expect(decoded.Decode(buf)).To(Succeed())
+			Expect(decoded.Verify(context("paillier", 0, 0), pub)).To(Succeed())
+		})
+	})
+
+	Describe("ZKNoSmallFactor", func() {
+		It("Verify Correct Proof", func() {
+			z, err := zkpok.NewZKNoSmallFactor(tr, priv, rp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("paillier", 0, 0), pub, rp)).To(Succeed())
+		})
+		It("Verify Proof for a modulus with a small factor", func() {
+			z, err := zkpok.NewZKNoSmallFactor(tr, smallPriv, rp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("paillier", 0, 0), smallPub, rp)).NotTo(Succeed())
+		})
+		It("Verify Proof for a different modulus", func() {
+			z, err := zkpok.NewZKNoSmallFactor(tr, priv, rp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("paillier", 0, 0), smallPub, rp)).NotTo(Succeed())
+		})
+		It("Should bind the proof to its context", func() {
+			z, err := zkpok.NewZKNoSmallFactor(tr, priv, rp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(context("other", 0, 0), pub, rp)).NotTo(Succeed())
+		})
+		It("Encode-Decode Test", func() {
+			z, err := zkpok.NewZKNoSmallFactor(tr, priv, rp)
+			Expect(err).NotTo(HaveOccurred())
+			buf := &bytes.Buffer{}
+			Expect(z.Encode(buf)).To(Succeed())
+			var decoded zkpok.ZKNoSmallFactor
+			Expect(decoded.Decode(buf)).To(Succeed())
+			Expect(decoded.Verify(context("paillier", 0, 0), pub, rp)).To(Succeed())
+		})
+	})
+})
+
+// blumPrime returns a random prime congruent to 3 mod 4
+func blumPrime(bits int) *big.Int {
+	for {
+		p, err := rand.Prime(rand.Reader, bits)
+		Expect(err).NotTo(HaveOccurred())
+		if p.Bit(1) == 1 {
+			return p
+		}
+	}
+}
+
+// mask returns x*2^bits
+func mask(x *big.Int, bits uint) *big.Int {
+	return new(big.Int).Lsh(x, bits)
+}
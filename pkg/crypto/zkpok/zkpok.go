@@ -1,3 +1,7 @@
+//Package zkpok implements non-interactive zero-knowledge proofs about ElGamal commitments, discrete logarithms
+//and plaintexts of Paillier ciphertexts.
+//Challenges are derived from a copy of a given transcript, so the prover and the verifier have to pass transcripts
+//with the same context absorbed, and a proof created in one context does not verify in another.
 package zkpok
 
 import (
@@ -27,24 +31,21 @@ type ZKEGKnow struct {
 }
 
 //NewZKEGKnow creates ZKEGKnow proof of knowledge of witness (value, r) for commitment c
-func NewZKEGKnow(fct *commitment.ElGamalFactory, comm *commitment.ElGamal, value, rnd *big.Int) (*ZKEGKnow, error) {
+func NewZKEGKnow(tr *pkg.Transcript, fct *commitment.ElGamalFactory, comm *commitment.ElGamal, value, rnd *big.Int) (*ZKEGKnow, error) {
 	order := fct.Curve().Order()
 	sigma, _ := rand.Int(rand.Reader, order)
 	rho, _ := rand.Int(rand.Reader, order)
+	xy := fct.Create(rho, sigma)
 
 	//e is the randomly produced challenge, here hash by Fiat-Shamir heuristic
-	buf := &bytes.Buffer{}
-	if err := comm.Encode(buf); err != nil {
+	e, err := challenge(tr, "ZKEGKnow", fct, comm, xy)
+	if err != nil {
 		return nil, err
 	}
-	e := pkg.HashToBigInt(buf.Bytes())
-	var z1, z2 big.Int
 
-	d := fct.Neutral()
-	d = d.Compose(fct.Create(rho, sigma), d.Exp(comm, e))
+	var z1, z2 big.Int
 	z1.Add(sigma, z1.Mul(e, rnd))
 	z2.Add(rho, z2.Mul(e, value))
-	xy := fct.Create(rho, sigma)
 	z1.Mod(&z1, order)
 	z2.Mod(&z2, order)
 
@@ -56,13 +57,12 @@ func NewZKEGKnow(fct *commitment.ElGamalFactory, comm *commitment.ElGamal, value
 }
 
 //Verify verifies proof z of knowledge of value and r for commitment c
-func (z *ZKEGKnow) Verify(fct *commitment.ElGamalFactory, comm *commitment.ElGamal) error {
-	d := fct.Neutral()
-	buf := &bytes.Buffer{}
-	if err := comm.Encode(buf); err != nil {
+func (z *ZKEGKnow) Verify(tr *pkg.Transcript, fct *commitment.ElGamalFactory, comm *commitment.ElGamal) error {
+	e, err := challenge(tr, "ZKEGKnow", fct, comm, z.xy)
+	if err != nil {
 		return err
 	}
-	e := pkg.HashToBigInt(buf.Bytes())
+	d := fct.Neutral()
 	d = d.Compose(z.xy, d.Exp(comm, e))
 
 	if !comm.Equal(d, fct.Create(z.z2, z.z1)) {
@@ -95,106 +95,264 @@ func (z *ZKEGKnow) Encode(w io.Writer) error {
 
 //Decode decodes ZKEGKnow proof
 func (z *ZKEGKnow) Decode(r io.Reader) error {
-	lenBytes := make([]byte, 8)
-	n, err := r.Read(lenBytes)
+	zs, err := decodeInts(r, 2)
 	if err != nil {
 		return err
 	}
-	if n < 8 {
-		return fmt.Errorf("Too few bytes: expected 8, got %d", n)
-	}
+	z.z1, z.z2 = zs[0], zs[1]
+	z.xy = &commitment.ElGamal{}
+	return z.xy.Decode(r)
+}
 
-	z1Len := binary.BigEndian.Uint32(lenBytes[:4])
-	z2Len := binary.BigEndian.Uint32(lenBytes[4:8])
-	allBytes := make([]byte, z1Len+z2Len)
+//ZKEGRerand implements proof that a comitment c2 is a proper rerandomization of commitment c1,
+//that is c2 = c1^r*ElGamal(0,s) for some r and s known to the prover.
+type ZKEGRerand struct {
+	z1 *big.Int
+	z2 *big.Int
+	xy *commitment.ElGamal
+}
 
-	n, err = r.Read(allBytes)
+//NewZKEGRerand creates ZKEGRerand proof of knowledge of r and s such that c2 = c1^r*ElGamal(0,s)
+func NewZKEGRerand(tr *pkg.Transcript, fct *commitment.ElGamalFactory, c1, c2 *commitment.ElGamal, r, s *big.Int) (*ZKEGRerand, error) {
+	order := fct.Curve().Order()
+	rho, err := rand.Int(rand.Reader, order)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if uint32(n) < z1Len+z2Len {
-		return fmt.Errorf("Too few bytes for payload: expected %d, got %d", z1Len+z2Len, n)
+	sigma, err := rand.Int(rand.Reader, order)
+	if err != nil {
+		return nil, err
 	}
 
-	z.z1 = new(big.Int).SetBytes(allBytes[:z1Len])
-	z.z2 = new(big.Int).SetBytes(allBytes[z1Len : z1Len+z2Len])
-	z.xy = &commitment.ElGamal{}
-	z.xy.Decode(r)
+	xy := fct.Neutral()
+	xy.Compose(xy.Exp(c1, rho), fct.Create(big.NewInt(0), sigma))
 
-	return nil
-}
+	//e is the randomly produced challenge, here hash by Fiat-Shamir heuristic
+	e, err := challenge(tr, "ZKEGRerand", fct, c1, c2, xy)
+	if err != nil {
+		return nil, err
+	}
 
-//ZKEGRerand implements proof that a comitment c2 is a proper rerandomization of commitment c1
-type ZKEGRerand struct {
-	z1 big.Int
-	z2 big.Int
-	xy commitment.ElGamal
-}
+	var z1, z2 big.Int
+	z1.Add(rho, z1.Mul(e, r))
+	z2.Add(sigma, z2.Mul(e, s))
+	z1.Mod(&z1, order)
+	z2.Mod(&z2, order)
 
-//NewZKEGRerand creates ZKEGRerand proof of knowledge
-func NewZKEGRerand(fct *commitment.ElGamalFactory, c1, c2 *commitment.ElGamal, r, s *big.Int) *ZKEGRerand {
-	return &ZKEGRerand{}
+	return &ZKEGRerand{
+		z1: &z1,
+		z2: &z2,
+		xy: xy,
+	}, nil
 }
 
 //Verify verifies ZKEGRerand proof
-func (z *ZKEGRerand) Verify(fct *commitment.ElGamalFactory, c1, c2 *commitment.ElGamal) bool {
-	return true
+func (z *ZKEGRerand) Verify(tr *pkg.Transcript, fct *commitment.ElGamalFactory, c1, c2 *commitment.ElGamal) error {
+	e, err := challenge(tr, "ZKEGRerand", fct, c1, c2, z.xy)
+	if err != nil {
+		return err
+	}
+
+	lhs := fct.Neutral()
+	lhs.Compose(lhs.Exp(c1, z.z1), fct.Create(big.NewInt(0), z.z2))
+	rhs := fct.Neutral()
+	rhs.Compose(z.xy, rhs.Exp(c2, e))
+
+	if !lhs.Equal(lhs, rhs) {
+		return fmt.Errorf("verification failed")
+	}
+	return nil
 }
 
-//Encode encodes  ZKEGRerand proof
-func (z *ZKEGRerand) Encode(w io.Writer) error { return nil }
+//Encode encodes ZKEGRerand proof
+func (z *ZKEGRerand) Encode(w io.Writer) error {
+	if err := encodeInts(w, z.z1, z.z2); err != nil {
+		return err
+	}
+	return z.xy.Encode(w)
+}
 
 //Decode decodes ZKEGRerand proof
-func (z *ZKEGRerand) Decode(r io.Reader) error { return nil }
+func (z *ZKEGRerand) Decode(r io.Reader) error {
+	zs, err := decodeInts(r, 2)
+	if err != nil {
+		return err
+	}
+	z.z1, z.z2 = zs[0], zs[1]
+	z.xy = &commitment.ElGamal{}
+	return z.xy.Decode(r)
+}
 
 //ZKEGExp implements proof that commitment c3 results from commitments c1 and c2.
 //Specicically, if c2 is an ElGamal commitment to y with r as a randomizing element,
-//then ZKEGExp proves that c3 is formed as c1^y*ElGamal(0,r).
+//then ZKEGExp proves that c3 is formed as c1^y*ElGamal(0,t).
 type ZKEGExp struct {
-	z1 big.Int
-	z2 big.Int
-	xy commitment.ElGamal
-	w  curve.Point
+	z1 *big.Int
+	z2 *big.Int
+	z3 *big.Int
+	xy *commitment.ElGamal
+	w  *commitment.ElGamal
 }
 
-//NewZKEGExp creates ZKEGExp proof of knowledge
-func NewZKEGExp(fct *commitment.ElGamalFactory, c1, c2, c3 *commitment.ElGamal, t, r, y *big.Int) *ZKEGExp {
-	return &ZKEGExp{}
+//NewZKEGExp creates ZKEGExp proof of knowledge of y, r and t such that c2 = ElGamal(y,r) and c3 = c1^y*ElGamal(0,t)
+func NewZKEGExp(tr *pkg.Transcript, fct *commitment.ElGamalFactory, c1, c2, c3 *commitment.ElGamal, t, r, y *big.Int) (*ZKEGExp, error) {
+	order := fct.Curve().Order()
+	nonces := make([]*big.Int, 3)
+	for i := range nonces {
+		var err error
+		if nonces[i], err = rand.Int(rand.Reader, order); err != nil {
+			return nil, err
+		}
+	}
+	alpha, rho, tau := nonces[0], nonces[1], nonces[2]
+
+	xy := fct.Create(alpha, rho)
+	w := fct.Neutral()
+	w.Compose(w.Exp(c1, alpha), fct.Create(big.NewInt(0), tau))
+
+	//e is the randomly produced challenge, here hash by Fiat-Shamir heuristic
+	e, err := challenge(tr, "ZKEGExp", fct, c1, c2, c3, xy, w)
+	if err != nil {
+		return nil, err
+	}
+
+	var z1, z2, z3 big.Int
+	z1.Add(alpha, z1.Mul(e, y))
+	z2.Add(rho, z2.Mul(e, r))
+	z3.Add(tau, z3.Mul(e, t))
+	z1.Mod(&z1, order)
+	z2.Mod(&z2, order)
+	z3.Mod(&z3, order)
+
+	return &ZKEGExp{
+		z1: &z1,
+		z2: &z2,
+		z3: &z3,
+		xy: xy,
+		w:  w,
+	}, nil
 }
 
 //Verify verifies ZKEGExp proof
-func (z *ZKEGExp) Verify(fct *commitment.ElGamalFactory, c1, c2, c3 *commitment.ElGamal) bool {
-	return true
+func (z *ZKEGExp) Verify(tr *pkg.Transcript, fct *commitment.ElGamalFactory, c1, c2, c3 *commitment.ElGamal) error {
+	e, err := challenge(tr, "ZKEGExp", fct, c1, c2, c3, z.xy, z.w)
+	if err != nil {
+		return err
+	}
+
+	// c2 is a commitment to y
+	rhs := fct.Neutral()
+	rhs.Compose(z.xy, rhs.Exp(c2, e))
+	if !rhs.Equal(fct.Create(z.z1, z.z2), rhs) {
+		return fmt.Errorf("verification failed")
+	}
+
+	// c3 is c1 raised to the same y
+	lhs := fct.Neutral()
+	lhs.Compose(lhs.Exp(c1, z.z1), fct.Create(big.NewInt(0), z.z3))
+	rhs.Compose(z.w, rhs.Exp(c3, e))
+	if !lhs.Equal(lhs, rhs) {
+		return fmt.Errorf("verification failed")
+	}
+
+	return nil
 }
 
 //Encode encodes ZKEGExp proof
-func (z *ZKEGExp) Encode(w io.Writer) error { return nil }
+func (z *ZKEGExp) Encode(w io.Writer) error {
+	if err := encodeInts(w, z.z1, z.z2, z.z3); err != nil {
+		return err
+	}
+	if err := z.xy.Encode(w); err != nil {
+		return err
+	}
+	return z.w.Encode(w)
+}
 
 //Decode decodes ZKEGExp proof
-func (z *ZKEGExp) Decode(r io.Reader) error { return nil }
+func (z *ZKEGExp) Decode(r io.Reader) error {
+	zs, err := decodeInts(r, 3)
+	if err != nil {
+		return err
+	}
+	z.z1, z.z2, z.z3 = zs[0], zs[1], zs[2]
+	z.xy = &commitment.ElGamal{}
+	if err := z.xy.Decode(r); err != nil {
+		return err
+	}
+	z.w = &commitment.ElGamal{}
+	return z.w.Decode(r)
+}
 
 //ZKEGReveal implements proof that reveiled value is the same that was committed via ElGamal
 type ZKEGReveal struct {
-	z1 big.Int
-	z2 big.Int
-	xy commitment.ElGamal
+	z  *big.Int
+	xy *commitment.ElGamal
 }
 
-//NewZKEGReveal creates ZKEGReveal proof of knowledge
-func NewZKEGReveal(fct *commitment.ElGamalFactory, c *commitment.ElGamal, x, r *big.Int) *ZKEGReveal {
-	return &ZKEGReveal{}
+//NewZKEGReveal creates ZKEGReveal proof of knowledge of r such that c = ElGamal(x,r)
+func NewZKEGReveal(tr *pkg.Transcript, fct *commitment.ElGamalFactory, c *commitment.ElGamal, x, r *big.Int) (*ZKEGReveal, error) {
+	order := fct.Curve().Order()
+	rho, err := rand.Int(rand.Reader, order)
+	if err != nil {
+		return nil, err
+	}
+	xy := fct.Create(big.NewInt(0), rho)
+
+	//e is the randomly produced challenge, here hash by Fiat-Shamir heuristic
+	e, err := challenge(tr, "ZKEGReveal", fct, c, fct.Create(x, big.NewInt(0)), xy)
+	if err != nil {
+		return nil, err
+	}
+
+	var z big.Int
+	z.Add(rho, z.Mul(e, r))
+	z.Mod(&z, order)
+
+	return &ZKEGReveal{
+		z:  &z,
+		xy: xy,
+	}, nil
 }
 
 //Verify verifies ZKEGReveal proof
-func (z *ZKEGReveal) Verify(fct *commitment.ElGamalFactory, c *commitment.ElGamal, x *big.Int) bool {
-	return true
+func (z *ZKEGReveal) Verify(tr *pkg.Transcript, fct *commitment.ElGamalFactory, c *commitment.ElGamal, x *big.Int) error {
+	order := fct.Curve().Order()
+	e, err := challenge(tr, "ZKEGReveal", fct, c, fct.Create(x, big.NewInt(0)), z.xy)
+	if err != nil {
+		return err
+	}
+
+	var ex big.Int
+	ex.Mul(e, x)
+	ex.Mod(&ex, order)
+	rhs := fct.Neutral()
+	rhs.Compose(z.xy, rhs.Exp(c, e))
+
+	if !rhs.Equal(fct.Create(&ex, z.z), rhs) {
+		return fmt.Errorf("verification failed")
+	}
+	return nil
 }
 
 //Encode encodes ZKEGReveal proof
-func (z *ZKEGReveal) Encode(w io.Writer) error { return nil }
+func (z *ZKEGReveal) Encode(w io.Writer) error {
+	if err := encodeInts(w, z.z); err != nil {
+		return err
+	}
+	return z.xy.Encode(w)
+}
 
 //Decode decodes ZKEGReveal proof
-func (z *ZKEGReveal) Decode(r io.Reader) error { return nil }
+func (z *ZKEGReveal) Decode(r io.Reader) error {
+	zs, err := decodeInts(r, 1)
+	if err != nil {
+		return err
+	}
+	z.z = zs[0]
+	z.xy = &commitment.ElGamal{}
+	return z.xy.Decode(r)
+}
 
 //ZKEGRefresh implements proof that a comitment c2 is a proper refreshment of commitment c2
 type ZKEGRefresh struct {
@@ -204,20 +362,18 @@ type ZKEGRefresh struct {
 }
 
 //NewZKEGRefresh creates ZKEGRefresh proof of knowledge
-func NewZKEGRefresh(fct *commitment.ElGamalFactory, c1, c2 *commitment.ElGamal, r *big.Int) (*ZKEGRefresh, error) {
+func NewZKEGRefresh(tr *pkg.Transcript, fct *commitment.ElGamalFactory, c1, c2 *commitment.ElGamal, r *big.Int) (*ZKEGRefresh, error) {
 	g := fct.Curve()
 	sigma, _ := rand.Int(rand.Reader, g.Order())
 	tau, _ := rand.Int(rand.Reader, g.Order())
+	xy := fct.Neutral()
+	xy.Compose(xy.Exp(c1, tau), fct.Create(big.NewInt(0), sigma))
 
 	//e is the randomly produced challenge, here hash by Fiat-Shamir heuristic
-	buf := &bytes.Buffer{}
-	if err := c1.Encode(buf); err != nil {
-		return nil, err
-	}
-	if err := c2.Encode(buf); err != nil {
+	e, err := challenge(tr, "ZKEGRefresh", fct, c1, c2, xy)
+	if err != nil {
 		return nil, err
 	}
-	e := pkg.HashToBigInt(buf.Bytes())
 
 	var z1 big.Int
 	var z2 big.Int
@@ -225,8 +381,6 @@ func NewZKEGRefresh(fct *commitment.ElGamalFactory, c1, c2 *commitment.ElGamal,
 	z2.Add(tau, e)
 	z1.Mod(&z1, fct.Curve().Order())
 	z2.Mod(&z2, fct.Curve().Order())
-	xy := fct.Neutral()
-	xy.Compose(xy.Exp(c1, tau), fct.Create(big.NewInt(0), sigma))
 
 	return &ZKEGRefresh{
 		z1: &z1,
@@ -236,15 +390,11 @@ func NewZKEGRefresh(fct *commitment.ElGamalFactory, c1, c2 *commitment.ElGamal,
 }
 
 //Verify verifies ZKEGRefresh proof
-func (z *ZKEGRefresh) Verify(fct *commitment.ElGamalFactory, c1, c2 *commitment.ElGamal) error {
-	buf := &bytes.Buffer{}
-	if err := c1.Encode(buf); err != nil {
-		return err
-	}
-	if err := c2.Encode(buf); err != nil {
+func (z *ZKEGRefresh) Verify(tr *pkg.Transcript, fct *commitment.ElGamalFactory, c1, c2 *commitment.ElGamal) error {
+	e, err := challenge(tr, "ZKEGRefresh", fct, c1, c2, z.xy)
+	if err != nil {
 		return err
 	}
-	e := pkg.HashToBigInt(buf.Bytes())
 
 	d := fct.Neutral()
 	dtmp := fct.Neutral()
@@ -280,50 +430,77 @@ func (z *ZKEGRefresh) Encode(w io.Writer) error {
 
 //Decode decodes ZKEGRefresh proof
 func (z *ZKEGRefresh) Decode(r io.Reader) error {
-	lenBytes := make([]byte, 8)
-	n, err := r.Read(lenBytes)
-	if err != nil {
-		return err
-	}
-	if n < 8 {
-		return fmt.Errorf("Too few bytes: expected 8, got %d", n)
-	}
-
-	z1Len := binary.BigEndian.Uint32(lenBytes[:4])
-	z2Len := binary.BigEndian.Uint32(lenBytes[4:8])
-	allBytes := make([]byte, z1Len+z2Len)
-
-	n, err = r.Read(allBytes)
+	zs, err := decodeInts(r, 2)
 	if err != nil {
 		return err
 	}
-	if uint32(n) < z1Len+z2Len {
-		return fmt.Errorf("Too few bytes for payload: expected %d, got %d", z1Len+z2Len, n)
-	}
-	z.z1 = new(big.Int).SetBytes(allBytes[:z1Len])
-	z.z2 = new(big.Int).SetBytes(allBytes[z1Len : z1Len+z2Len])
+	z.z1, z.z2 = zs[0], zs[1]
 	z.xy = &commitment.ElGamal{}
-	z.xy.Decode(r)
-	return nil
+	return z.xy.Decode(r)
 }
 
 // ZKDLog implements proof of knowledge of discrete logarithm
 type ZKDLog struct {
-	z big.Int
+	z *big.Int
 	w curve.Point
 }
 
-//NewZKDLog creates ZKDLog proof of knowledge
-func NewZKDLog(y *curve.Point, x *big.Int) *ZKDLog { return &ZKDLog{} }
+//NewZKDLog creates ZKDLog proof of knowledge of x such that y = g^x
+func NewZKDLog(tr *pkg.Transcript, group curve.Group, y curve.Point, x *big.Int) (*ZKDLog, error) {
+	order := group.Order()
+	rho, err := rand.Int(rand.Reader, order)
+	if err != nil {
+		return nil, err
+	}
+	w := group.ScalarBaseMult(rho)
+
+	//e is the randomly produced challenge, here hash by Fiat-Shamir heuristic
+	e, err := pointChallenge(tr, "ZKDLog", group, y, w)
+	if err != nil {
+		return nil, err
+	}
+
+	var z big.Int
+	z.Add(rho, z.Mul(e, x))
+	z.Mod(&z, order)
+
+	return &ZKDLog{
+		z: &z,
+		w: w,
+	}, nil
+}
 
 //Verify verifies ZKDLog proof
-func (z *ZKDLog) Verify(y *curve.Point) bool { return true }
+func (z *ZKDLog) Verify(tr *pkg.Transcript, group curve.Group, y curve.Point) error {
+	e, err := pointChallenge(tr, "ZKDLog", group, y, z.w)
+	if err != nil {
+		return err
+	}
+
+	if !group.Equal(group.ScalarBaseMult(z.z), group.Add(z.w, group.ScalarMult(y, e))) {
+		return fmt.Errorf("verification failed")
+	}
+	return nil
+}
 
 //Encode encodes ZKDLog proof
-func (z *ZKDLog) Encode(w io.Writer) error { return nil }
+func (z *ZKDLog) Encode(w io.Writer) error {
+	if err := encodeInts(w, z.z); err != nil {
+		return err
+	}
+	return curve.NewSecp256k1Group().Encode(z.w, w)
+}
 
 //Decode decodes ZKDLog proof
-func (z *ZKDLog) Decode(r io.Reader) error { return nil }
+func (z *ZKDLog) Decode(r io.Reader) error {
+	zs, err := decodeInts(r, 1)
+	if err != nil {
+		return err
+	}
+	z.z = zs[0]
+	z.w, err = curve.NewSecp256k1Group().Decode(r)
+	return err
+}
 
 // NoopZKproof is a trivial proof that always returns true
 type NoopZKproof struct{}
@@ -336,3 +513,76 @@ func (NoopZKproof) Encode(w io.Writer) error { return nil }
 
 // Decode implements a method needed for decoding
 func (*NoopZKproof) Decode(r io.Reader) error { return nil }
+
+//maxIntLen bounds the length of encoded integers, so that malformed proofs cannot force huge allocations
+const maxIntLen = 1 << 10
+
+//challenge computes the Fiat-Shamir challenge of the named proof for a statement and a first message given as ElGamal commitments.
+//The challenge is derived from a copy of tr with the name, the key of the factory and the commitments absorbed.
+func challenge(tr *pkg.Transcript, name string, fct *commitment.ElGamalFactory, comms ...*commitment.ElGamal) (*big.Int, error) {
+	t := tr.Clone()
+	t.AppendMessage("proof", []byte(name))
+	buf := &bytes.Buffer{}
+	if err := fct.Curve().Encode(fct.H(), buf); err != nil {
+		return nil, err
+	}
+	t.AppendMessage("h", buf.Bytes())
+	for _, c := range comms {
+		buf.Reset()
+		if err := c.Encode(buf); err != nil {
+			return nil, err
+		}
+		t.AppendMessage("comm", buf.Bytes())
+	}
+	return t.Challenge("e", fct.Curve().Order()), nil
+}
+
+//pointChallenge computes the Fiat-Shamir challenge of the named proof for a statement and a first message given as group elements.
+//The challenge is derived from a copy of tr with the name and the points absorbed.
+func pointChallenge(tr *pkg.Transcript, name string, group curve.Group, points ...curve.Point) (*big.Int, error) {
+	t := tr.Clone()
+	t.AppendMessage("proof", []byte(name))
+	buf := &bytes.Buffer{}
+	for _, p := range points {
+		buf.Reset()
+		if err := group.Encode(p, buf); err != nil {
+			return nil, err
+		}
+		t.AppendMessage("point", buf.Bytes())
+	}
+	return t.Challenge("e", group.Order()), nil
+}
+
+//encodeInts writes lengths of given integers followed by their big-endian bytes
+func encodeInts(w io.Writer, xs ...*big.Int) error {
+	buf := make([]byte, 4*len(xs))
+	for i, x := range xs {
+		xBytes := x.Bytes()
+		binary.BigEndian.PutUint32(buf[4*i:4*(i+1)], uint32(len(xBytes)))
+		buf = append(buf, xBytes...)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+//decodeInts reads n integers written by encodeInts
+func decodeInts(r io.Reader, n int) ([]*big.Int, error) {
+	lenBytes := make([]byte, 4*n)
+	if _, err := io.ReadFull(r, lenBytes); err != nil {
+		return nil, fmt.Errorf("Too few bytes: expected %d: %v", 4*n, err)
+	}
+
+	xs := make([]*big.Int, n)
+	for i := range xs {
+		xLen := binary.BigEndian.Uint32(lenBytes[4*i : 4*(i+1)])
+		if xLen > maxIntLen {
+			return nil, fmt.Errorf("Integer too long: %d bytes", xLen)
+		}
+		xBytes := make([]byte, xLen)
+		if _, err := io.ReadFull(r, xBytes); err != nil {
+			return nil, fmt.Errorf("Too few bytes for payload: expected %d: %v", xLen, err)
+		}
+		xs[i] = new(big.Int).SetBytes(xBytes)
+	}
+	return xs, nil
+}
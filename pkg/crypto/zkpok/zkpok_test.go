@@ -2,14 +2,25 @@ package zkpok_test
 
 import (
 	"bytes"
+	"encoding/binary"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/commitment"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/zkpok"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/curve"
 	"math/big"
 )
 
+// context returns a transcript binding proofs to a secret, a round and a prover, as arith does
+func context(label string, roundID, pid uint64) *pkg.Transcript {
+	tr := pkg.NewTranscript("test")
+	tr.AppendMessage("label", []byte(label))
+	tr.AppendUint64("round", roundID)
+	tr.AppendUint64("pid", pid)
+	return tr
+}
+
 var _ = Describe("ZKEGKnow", func() {
 	var (
 		fct        *commitment.ElGamalFactory
@@ -23,6 +34,7 @@ var _ = Describe("ZKEGKnow", func() {
 		r1         *big.Int
 		r2         *big.Int
 		rRefresh   *big.Int
+		tr         *pkg.Transcript
 		err        error
 	)
 	BeforeEach(func() {
@@ -39,6 +51,7 @@ var _ = Describe("ZKEGKnow", func() {
 		c2 = fct.Create(value2, r2)
 		cRefreshed = fct.Neutral()
 		cRefreshed.Compose(c1, fct.Create(big.NewInt(0), rRefresh))
+		tr = context("x", 1, 0)
 
 	})
 
@@ -47,21 +60,21 @@ var _ = Describe("ZKEGKnow", func() {
 			z1 *zkpok.ZKEGKnow
 		)
 		It("Verify Correct Proof", func() {
-			z1, err := zkpok.NewZKEGKnow(fct, c1, value, r1)
+			z1, err := zkpok.NewZKEGKnow(tr, fct, c1, value, r1)
 			Expect(err).NotTo(HaveOccurred())
 
-			err = z1.Verify(fct, c1)
+			err = z1.Verify(tr, fct, c1)
 			Expect(err).NotTo(HaveOccurred())
 		})
 		It("Verify incorrect Proof", func() {
-			z1, err = zkpok.NewZKEGKnow(fct, c1, value, r1)
+			z1, err = zkpok.NewZKEGKnow(tr, fct, c1, value, r1)
 			Expect(err).NotTo(HaveOccurred())
 
-			err = z1.Verify(fct, c2)
+			err = z1.Verify(tr, fct, c2)
 			Expect(err).To(HaveOccurred())
 		})
 		It("Encode-Decode Test", func() {
-			z1, err = zkpok.NewZKEGKnow(fct, c1, value, r1)
+			z1, err = zkpok.NewZKEGKnow(tr, fct, c1, value, r1)
 			Expect(err).NotTo(HaveOccurred())
 
 			buf := &bytes.Buffer{}
@@ -72,12 +85,25 @@ var _ = Describe("ZKEGKnow", func() {
 			err = z2.Decode(buf)
 			Expect(err).NotTo(HaveOccurred())
 
-			err = z2.Verify(fct, c1)
+			err = z2.Verify(tr, fct, c1)
 			Expect(err).NotTo(HaveOccurred())
 
-			err := z2.Verify(fct, c2)
+			err := z2.Verify(tr, fct, c2)
 			Expect(err).To(HaveOccurred())
 		})
+		It("Should refuse to decode malformed proofs", func() {
+			z1, err = zkpok.NewZKEGKnow(tr, fct, c1, value, r1)
+			Expect(err).NotTo(HaveOccurred())
+			buf := &bytes.Buffer{}
+			Expect(z1.Encode(buf)).To(Succeed())
+			encoded := buf.Bytes()
+
+			z2 := &zkpok.ZKEGKnow{}
+			Expect(z2.Decode(bytes.NewReader(encoded[:len(encoded)-1]))).NotTo(Succeed())
+			tooLong := append([]byte{}, encoded...)
+			binary.BigEndian.PutUint32(tooLong[:4], 1<<31)
+			Expect(z2.Decode(bytes.NewReader(tooLong))).NotTo(Succeed())
+		})
 	})
 
 	Describe("ZKEGRefresh", func() {
@@ -85,21 +111,21 @@ var _ = Describe("ZKEGKnow", func() {
 			z1 *zkpok.ZKEGRefresh
 		)
 		It("Verify Correct Proof", func() {
-			z1, err = zkpok.NewZKEGRefresh(fct, c1, cRefreshed, rRefresh)
+			z1, err = zkpok.NewZKEGRefresh(tr, fct, c1, cRefreshed, rRefresh)
 			Expect(err).NotTo(HaveOccurred())
 
-			err = z1.Verify(fct, c1, cRefreshed)
+			err = z1.Verify(tr, fct, c1, cRefreshed)
 			Expect(err).NotTo(HaveOccurred())
 		})
 		It("Verify incorrect Proof", func() {
-			z1, err := zkpok.NewZKEGRefresh(fct, c1, cRefreshed, rRefresh)
+			z1, err := zkpok.NewZKEGRefresh(tr, fct, c1, cRefreshed, rRefresh)
 			Expect(err).NotTo(HaveOccurred())
 
-			err = z1.Verify(fct, c1, c2)
+			err = z1.Verify(tr, fct, c1, c2)
 			Expect(err).To(HaveOccurred())
 		})
 		It("Encode-Decode Test", func() {
-			z1, err := zkpok.NewZKEGRefresh(fct, c1, cRefreshed, rRefresh)
+			z1, err := zkpok.NewZKEGRefresh(tr, fct, c1, cRefreshed, rRefresh)
 			Expect(err).NotTo(HaveOccurred())
 
 			buf := &bytes.Buffer{}
@@ -110,11 +136,330 @@ var _ = Describe("ZKEGKnow", func() {
 			err = z2.Decode(buf)
 			Expect(err).NotTo(HaveOccurred())
 
-			err = z2.Verify(fct, c1, cRefreshed)
+			err = z2.Verify(tr, fct, c1, cRefreshed)
 			Expect(err).NotTo(HaveOccurred())
 
-			err = z2.Verify(fct, c2, cRefreshed)
+			err = z2.Verify(tr, fct, c2, cRefreshed)
 			Expect(err).To(HaveOccurred())
 		})
+		It("Should refuse to decode malformed proofs", func() {
+			z1, err := zkpok.NewZKEGRefresh(tr, fct, c1, cRefreshed, rRefresh)
+			Expect(err).NotTo(HaveOccurred())
+			buf := &bytes.Buffer{}
+			Expect(z1.Encode(buf)).To(Succeed())
+			encoded := buf.Bytes()
+
+			z2 := &zkpok.ZKEGRefresh{}
+			Expect(z2.Decode(bytes.NewReader(encoded[:len(encoded)-1]))).NotTo(Succeed())
+			tooLong := append([]byte{}, encoded...)
+			binary.BigEndian.PutUint32(tooLong[4:8], 1<<31)
+			Expect(z2.Decode(bytes.NewReader(tooLong))).NotTo(Succeed())
+		})
+	})
+
+	// tamper flips the last byte of the first of nInts integers in an encoded proof
+	tamper := func(encoded []byte, nInts int) []byte {
+		tampered := make([]byte, len(encoded))
+		copy(tampered, encoded)
+		tampered[4*nInts+int(binary.BigEndian.Uint32(tampered[:4]))-1] ^= 1
+		return tampered
+	}
+
+	Describe("ZKEGRerand", func() {
+		var (
+			s  *big.Int
+			c3 *commitment.ElGamal
+		)
+		BeforeEach(func() {
+			s = big.NewInt(19)
+			c3 = fct.Neutral()
+			c3.Compose(c3.Exp(c1, r2), fct.Create(big.NewInt(0), s))
+		})
+		It("Verify Correct Proof", func() {
+			z, err := zkpok.NewZKEGRerand(tr, fct, c1, c3, r2, s)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(z.Verify(tr, fct, c1, c3)).To(Succeed())
+		})
+		It("Verify incorrect Proof", func() {
+			z, err := zkpok.NewZKEGRerand(tr, fct, c1, c3, r2, s)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(z.Verify(tr, fct, c2, c3)).NotTo(Succeed())
+			Expect(z.Verify(tr, fct, c1, c2)).NotTo(Succeed())
+		})
+		It("Verify Proof with a wrong witness", func() {
+			z, err := zkpok.NewZKEGRerand(tr, fct, c1, c3, r1, s)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(z.Verify(tr, fct, c1, c3)).NotTo(Succeed())
+		})
+		It("Encode-Decode Test", func() {
+			z1, err := zkpok.NewZKEGRerand(tr, fct, c1, c3, r2, s)
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := &bytes.Buffer{}
+			Expect(z1.Encode(buf)).To(Succeed())
+			encoded := buf.Bytes()
+
+			z2 := &zkpok.ZKEGRerand{}
+			Expect(z2.Decode(bytes.NewBuffer(encoded))).To(Succeed())
+			Expect(z2.Verify(tr, fct, c1, c3)).To(Succeed())
+			Expect(z2.Verify(tr, fct, c2, c3)).NotTo(Succeed())
+
+			z3 := &zkpok.ZKEGRerand{}
+			Expect(z3.Decode(bytes.NewBuffer(tamper(encoded, 2)))).To(Succeed())
+			Expect(z3.Verify(tr, fct, c1, c3)).NotTo(Succeed())
+
+			z4 := &zkpok.ZKEGRerand{}
+			Expect(z4.Decode(bytes.NewBuffer(encoded[:len(encoded)-1]))).NotTo(Succeed())
+		})
+	})
+
+	Describe("ZKEGExp", func() {
+		var (
+			t  *big.Int
+			c3 *commitment.ElGamal
+		)
+		BeforeEach(func() {
+			t = big.NewInt(23)
+			c3 = fct.Neutral()
+			c3.Compose(c3.Exp(c1, value2), fct.Create(big.NewInt(0), t))
+		})
+		It("Verify Correct Proof", func() {
+			z, err := zkpok.NewZKEGExp(tr, fct, c1, c2, c3, t, r2, value2)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(z.Verify(tr, fct, c1, c2, c3)).To(Succeed())
+		})
+		It("Verify incorrect Proof", func() {
+			z, err := zkpok.NewZKEGExp(tr, fct, c1, c2, c3, t, r2, value2)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(z.Verify(tr, fct, c2, c2, c3)).NotTo(Succeed())
+			Expect(z.Verify(tr, fct, c1, c1, c3)).NotTo(Succeed())
+			Expect(z.Verify(tr, fct, c1, c2, c1)).NotTo(Succeed())
+		})
+		It("Verify Proof for an exponent different from the committed one", func() {
+			c4 := fct.Neutral()
+			c4.Compose(c4.Exp(c1, value), fct.Create(big.NewInt(0), t))
+
+			z, err := zkpok.NewZKEGExp(tr, fct, c1, c2, c4, t, r2, value)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(tr, fct, c1, c2, c4)).NotTo(Succeed())
+
+			z, err = zkpok.NewZKEGExp(tr, fct, c1, c2, c4, t, r2, value2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(tr, fct, c1, c2, c4)).NotTo(Succeed())
+		})
+		It("Encode-Decode Test", func() {
+			z1, err := zkpok.NewZKEGExp(tr, fct, c1, c2, c3, t, r2, value2)
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := &bytes.Buffer{}
+			Expect(z1.Encode(buf)).To(Succeed())
+			encoded := buf.Bytes()
+
+			z2 := &zkpok.ZKEGExp{}
+			Expect(z2.Decode(bytes.NewBuffer(encoded))).To(Succeed())
+			Expect(z2.Verify(tr, fct, c1, c2, c3)).To(Succeed())
+			Expect(z2.Verify(tr, fct, c2, c2, c3)).NotTo(Succeed())
+
+			z3 := &zkpok.ZKEGExp{}
+			Expect(z3.Decode(bytes.NewBuffer(tamper(encoded, 3)))).To(Succeed())
+			Expect(z3.Verify(tr, fct, c1, c2, c3)).NotTo(Succeed())
+
+			z4 := &zkpok.ZKEGExp{}
+			Expect(z4.Decode(bytes.NewBuffer(encoded[:len(encoded)-1]))).NotTo(Succeed())
+		})
+	})
+
+	Describe("ZKEGReveal", func() {
+		It("Verify Correct Proof", func() {
+			z, err := zkpok.NewZKEGReveal(tr, fct, c1, value, r1)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(z.Verify(tr, fct, c1, value)).To(Succeed())
+		})
+		It("Verify incorrect Proof", func() {
+			z, err := zkpok.NewZKEGReveal(tr, fct, c1, value, r1)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(z.Verify(tr, fct, c1, value2)).NotTo(Succeed())
+			Expect(z.Verify(tr, fct, c2, value)).NotTo(Succeed())
+		})
+		It("Verify Proof of a value different from the committed one", func() {
+			z, err := zkpok.NewZKEGReveal(tr, fct, c1, value2, r1)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(z.Verify(tr, fct, c1, value2)).NotTo(Succeed())
+		})
+		It("Encode-Decode Test", func() {
+			z1, err := zkpok.NewZKEGReveal(tr, fct, c1, value, r1)
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := &bytes.Buffer{}
+			Expect(z1.Encode(buf)).To(Succeed())
+			encoded := buf.Bytes()
+
+			z2 := &zkpok.ZKEGReveal{}
+			Expect(z2.Decode(bytes.NewBuffer(encoded))).To(Succeed())
+			Expect(z2.Verify(tr, fct, c1, value)).To(Succeed())
+			Expect(z2.Verify(tr, fct, c1, value2)).NotTo(Succeed())
+
+			z3 := &zkpok.ZKEGReveal{}
+			Expect(z3.Decode(bytes.NewBuffer(tamper(encoded, 1)))).To(Succeed())
+			Expect(z3.Verify(tr, fct, c1, value)).NotTo(Succeed())
+
+			z4 := &zkpok.ZKEGReveal{}
+			Expect(z4.Decode(bytes.NewBuffer(encoded[:len(encoded)-1]))).NotTo(Succeed())
+		})
+	})
+
+	Describe("ZKDLog", func() {
+		var (
+			y curve.Point
+		)
+		BeforeEach(func() {
+			y = g.ScalarBaseMult(value)
+		})
+		It("Verify Correct Proof", func() {
+			z, err := zkpok.NewZKDLog(tr, g, y, value)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(z.Verify(tr, g, y)).To(Succeed())
+		})
+		It("Verify incorrect Proof", func() {
+			z, err := zkpok.NewZKDLog(tr, g, y, value)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(z.Verify(tr, g, h)).NotTo(Succeed())
+		})
+		It("Verify Proof with a wrong witness", func() {
+			z, err := zkpok.NewZKDLog(tr, g, y, value2)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(z.Verify(tr, g, y)).NotTo(Succeed())
+		})
+		It("Verify Proof simulated without the witness", func() {
+			// a forger picks the response first and solves for the first message
+			// using a challenge that does not depend on it
+			z := big.NewInt(31337)
+			buf := &bytes.Buffer{}
+			Expect(g.Encode(y, buf)).To(Succeed())
+			e := pkg.HashToBigInt(buf.Bytes(), g.Order())
+			w := g.Add(g.ScalarBaseMult(z), g.Neg(g.ScalarMult(y, e)))
+
+			buf.Reset()
+			lenBytes := make([]byte, 4)
+			binary.BigEndian.PutUint32(lenBytes, uint32(len(z.Bytes())))
+			buf.Write(lenBytes)
+			buf.Write(z.Bytes())
+			Expect(g.Encode(w, buf)).To(Succeed())
+
+			forged := &zkpok.ZKDLog{}
+			Expect(forged.Decode(buf)).To(Succeed())
+			Expect(forged.Verify(tr, g, y)).NotTo(Succeed())
+		})
+		It("Encode-Decode Test", func() {
+			z1, err := zkpok.NewZKDLog(tr, g, y, value)
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := &bytes.Buffer{}
+			Expect(z1.Encode(buf)).To(Succeed())
+			encoded := buf.Bytes()
+
+			z2 := &zkpok.ZKDLog{}
+			Expect(z2.Decode(bytes.NewBuffer(encoded))).To(Succeed())
+			Expect(z2.Verify(tr, g, y)).To(Succeed())
+			Expect(z2.Verify(tr, g, h)).NotTo(Succeed())
+
+			z3 := &zkpok.ZKDLog{}
+			Expect(z3.Decode(bytes.NewBuffer(tamper(encoded, 1)))).To(Succeed())
+			Expect(z3.Verify(tr, g, y)).NotTo(Succeed())
+
+			z4 := &zkpok.ZKDLog{}
+			Expect(z4.Decode(bytes.NewBuffer(encoded[:len(encoded)-1]))).NotTo(Succeed())
+		})
+	})
+
+	Describe("Transcripts", func() {
+		var (
+			others []*pkg.Transcript
+		)
+		BeforeEach(func() {
+			others = []*pkg.Transcript{context("y", 1, 0), context("x", 2, 0), context("x", 1, 1), pkg.NewTranscript("test")}
+		})
+
+		// expectBound checks that a proof verifies in its own context only
+		expectBound := func(verify func(*pkg.Transcript) error) {
+			Expect(verify(tr)).To(Succeed())
+			Expect(verify(context("x", 1, 0))).To(Succeed())
+			for _, other := range others {
+				Expect(verify(other)).NotTo(Succeed())
+			}
+			Expect(verify(tr)).To(Succeed())
+		}
+
+		It("Should bind ZKEGKnow to its context", func() {
+			z, err := zkpok.NewZKEGKnow(tr, fct, c1, value, r1)
+			Expect(err).NotTo(HaveOccurred())
+			expectBound(func(t *pkg.Transcript) error { return z.Verify(t, fct, c1) })
+		})
+		It("Should bind ZKEGKnow to the key of the factory", func() {
+			z, err := zkpok.NewZKEGKnow(tr, fct, c1, value, r1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(z.Verify(tr, commitment.NewElGamalFactory(g.Gen()), c1)).NotTo(Succeed())
+		})
+		It("Should bind ZKEGRefresh to its context", func() {
+			z, err := zkpok.NewZKEGRefresh(tr, fct, c1, cRefreshed, rRefresh)
+			Expect(err).NotTo(HaveOccurred())
+			expectBound(func(t *pkg.Transcript) error { return z.Verify(t, fct, c1, cRefreshed) })
+		})
+		It("Should bind ZKEGRerand to its context", func() {
+			c3 := fct.Neutral()
+			c3.Compose(c3.Exp(c1, r2), fct.Create(big.NewInt(0), r1))
+			z, err := zkpok.NewZKEGRerand(tr, fct, c1, c3, r2, r1)
+			Expect(err).NotTo(HaveOccurred())
+			expectBound(func(t *pkg.Transcript) error { return z.Verify(t, fct, c1, c3) })
+		})
+		It("Should bind ZKEGExp to its context", func() {
+			c3 := fct.Neutral()
+			c3.Compose(c3.Exp(c1, value2), fct.Create(big.NewInt(0), r1))
+			z, err := zkpok.NewZKEGExp(tr, fct, c1, c2, c3, r1, r2, value2)
+			Expect(err).NotTo(HaveOccurred())
+			expectBound(func(t *pkg.Transcript) error { return z.Verify(t, fct, c1, c2, c3) })
+		})
+		It("Should bind ZKEGReveal to its context", func() {
+			z, err := zkpok.NewZKEGReveal(tr, fct, c1, value, r1)
+			Expect(err).NotTo(HaveOccurred())
+			expectBound(func(t *pkg.Transcript) error { return z.Verify(t, fct, c1, value) })
+		})
+		It("Should bind ZKDLog to its context", func() {
+			y := g.ScalarBaseMult(value)
+			z, err := zkpok.NewZKDLog(tr, g, y, value)
+			Expect(err).NotTo(HaveOccurred())
+			expectBound(func(t *pkg.Transcript) error { return z.Verify(t, g, y) })
+		})
+		It("Should reject ZKEGKnow simulated with a challenge independent of the first message", func() {
+			// the forger picks the responses first and solves for the first message
+			e := context("x", 1, 0).Challenge("e", g.Order())
+			z1, z2 := big.NewInt(31337), big.NewInt(1729)
+			xy := fct.Neutral()
+			xy.Compose(fct.Create(z2, z1), xy.Inverse(xy.Exp(c1, e)))
+
+			buf := &bytes.Buffer{}
+			lenBytes := make([]byte, 8)
+			binary.BigEndian.PutUint32(lenBytes[:4], uint32(len(z1.Bytes())))
+			binary.BigEndian.PutUint32(lenBytes[4:], uint32(len(z2.Bytes())))
+			buf.Write(lenBytes)
+			buf.Write(z1.Bytes())
+			buf.Write(z2.Bytes())
+			Expect(xy.Encode(buf)).To(Succeed())
+
+			forged := &zkpok.ZKEGKnow{}
+			Expect(forged.Decode(buf)).To(Succeed())
+			Expect(forged.Verify(tr, fct, c1)).NotTo(Succeed())
+		})
 	})
 })
@@ -19,6 +19,7 @@ type Group interface {
 	ScalarMult(Point, *big.Int) Point
 	ScalarBaseMult(*big.Int) Point
 	Equal(Point, Point) bool
+	Coordinates(Point) (*big.Int, *big.Int)
 	Encode(Point, io.Writer) error
 	Decode(io.Reader) (Point, error)
 }
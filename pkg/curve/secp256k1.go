@@ -72,6 +72,9 @@ func (g sGroup) ScalarMult(a Point, scale *big.Int) Point {
 	if len(scale.Bytes()) > 32 {
 		scale.Mod(scale, g.Order())
 	}
+	if a.(sPoint).x == nil && a.(sPoint).y == nil {
+		return g.Neutral()
+	}
 	resultX, resultY := g.curve.ScalarMult(a.(sPoint).x, a.(sPoint).y, scale.Bytes())
 	return sPoint{resultX, resultY}
 }
@@ -96,6 +99,15 @@ func (g sGroup) Equal(a Point, b Point) bool {
 	return (as.x.Cmp(bs.x) == 0) && (as.y.Cmp(bs.y) == 0)
 }
 
+// Coordinates returns affine coordinates of the point, which are nil for the neutral element
+func (g sGroup) Coordinates(a Point) (*big.Int, *big.Int) {
+	as := a.(sPoint)
+	if as.x == nil && as.y == nil {
+		return nil, nil
+	}
+	return new(big.Int).Set(as.x), new(big.Int).Set(as.y)
+}
+
 func (g sGroup) Encode(a Point, w io.Writer) error {
 	buf := make([]byte, 4)
 	as := a.(sPoint)
@@ -138,6 +150,10 @@ func (g sGroup) Decode(r io.Reader) (Point, error) {
 	}
 
 	lenY := binary.BigEndian.Uint32(lenBytes[4:8])
+	maxLen := uint32((g.curve.BitSize + 7) / 8)
+	if lenX > maxLen || lenY > maxLen {
+		return nil, fmt.Errorf("Too many bytes for coordinates: expected at most %d, got %d and %d", maxLen, lenX, lenY)
+	}
 	xyBytes := make([]byte, lenX+lenY)
 	n, err = r.Read(xyBytes)
 	if err != nil {
@@ -148,6 +164,9 @@ func (g sGroup) Decode(r io.Reader) (Point, error) {
 	}
 	x := new(big.Int).SetBytes(xyBytes[:lenX])
 	y := new(big.Int).SetBytes(xyBytes[lenX:])
+	if x.Cmp(g.curve.P) >= 0 || y.Cmp(g.curve.P) >= 0 || !g.curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("The decoded point is not on the curve")
+	}
 
 	return sPoint{x, y}, nil
 }
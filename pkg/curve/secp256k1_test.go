@@ -53,6 +53,11 @@ var _ = Describe("Secp256k1 Test", func() {
 			Expect(secp256k1.Equal(a, scalarMultResult)).To(BeTrue())
 		})
 
+		It("Test of ScalarMult of Neutral", func() {
+			a := secp256k1.ScalarMult(secp256k1.Neutral(), big.NewInt(2))
+			Expect(secp256k1.Equal(a, secp256k1.Neutral())).To(BeTrue())
+		})
+
 		It("Test of Marshal", func() {
 			r, _ := rand.Int(rand.Reader, secp256k1.Order())
 			a := secp256k1.ScalarBaseMult(r)
@@ -67,6 +72,20 @@ var _ = Describe("Secp256k1 Test", func() {
 			Expect(secp256k1.Equal(a, b)).To(BeTrue())
 		})
 
+		It("Test of Marshal of a point outside the curve", func() {
+			r, _ := rand.Int(rand.Reader, secp256k1.Order())
+			a := secp256k1.ScalarBaseMult(r)
+
+			rw := bytes.Buffer{}
+			err := secp256k1.Encode(a, &rw)
+			Expect(err).NotTo(HaveOccurred())
+			data := rw.Bytes()
+			data[len(data)-1] ^= 1
+
+			_, err = secp256k1.Decode(bytes.NewReader(data))
+			Expect(err).To(HaveOccurred())
+		})
+
 		It("Test of Neg", func() {
 			a := secp256k1.Neg(secp256k1.Gen())
 			b := secp256k1.ScalarBaseMult(big.NewInt(1).Sub(secp256k1.Order(), big.NewInt(1)))
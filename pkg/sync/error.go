@@ -14,7 +14,7 @@ func (re *RoundError) Error() string {
 	return re.msg
 }
 
-// Missing is a collection of parties that did not send a correct proof
+// Missing is a collection of parties that sent no data in the round, or sent data that did not pass the check
 func (re *RoundError) Missing() []uint16 {
 	return re.missing
 }
@@ -22,3 +22,23 @@ func (re *RoundError) Missing() []uint16 {
 func wrap(err error) *RoundError {
 	return newRoundError(err.Error(), nil)
 }
+
+// TimeoutError describes a round that has failed because the data of some parties has not arrived
+// before the round timeout passed or the context of the round was done
+type TimeoutError struct {
+	RoundError
+}
+
+func newTimeoutError(msg string, unresponsive []uint16) *TimeoutError {
+	return &TimeoutError{RoundError{msg, unresponsive}}
+}
+
+// Timeout reports that the error is a timeout, like the errors of the net package
+func (te *TimeoutError) Timeout() bool {
+	return true
+}
+
+// Unresponsive is a collection of parties whose data has not arrived in time
+func (te *TimeoutError) Unresponsive() []uint16 {
+	return te.missing
+}
@@ -0,0 +1,248 @@
+package sync
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+
+	"gitlab.com/alephledger/core-go/pkg/network"
+)
+
+// KeySize is the length of the private and public keys of identities
+const KeySize = curve25519.PointSize
+
+// handshakeLabel separates the keys derived in handshakes from any other use of the identity keys
+const handshakeLabel = "ThresholdECDSA_sync_handshake"
+
+// Identity is the static X25519 key pair of a party, which authenticates it in the handshakes with the others
+type Identity struct {
+	priv, pub []byte
+}
+
+// NewIdentity generates a random identity
+func NewIdentity() (*Identity, error) {
+	priv := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, priv); err != nil {
+		return nil, err
+	}
+	return IdentityFromPrivate(priv)
+}
+
+// IdentityFromPrivate returns the identity with the given private key
+func IdentityFromPrivate(priv []byte) (*Identity, error) {
+	if len(priv) != KeySize {
+		return nil, fmt.Errorf("wrong length of the private key: expected %v, got %v", KeySize, len(priv))
+	}
+	pub, err := curve25519.X25519(priv, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{append([]byte{}, priv...), pub}, nil
+}
+
+// Private returns the private key of the identity
+func (id *Identity) Private() []byte {
+	return append([]byte{}, id.priv...)
+}
+
+// Public returns the public key of the identity, which the other parties have to know
+func (id *Identity) Public() []byte {
+	return append([]byte{}, id.pub...)
+}
+
+// channel seals and opens the frames sent over a connection in one direction.
+// Nonces are consecutive numbers, so frames that are dropped, replayed or reordered fail to open.
+// A channel may be used by one goroutine at a time.
+type channel struct {
+	aead  cipher.AEAD
+	nonce uint64
+}
+
+func newChannel(key []byte) (*channel, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &channel{aead: aead}, nil
+}
+
+// nextNonce returns the nonce of the next frame
+func (ch *channel) nextNonce() []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(nonce, ch.nonce)
+	ch.nonce++
+	return nonce
+}
+
+func (ch *channel) seal(data []byte) []byte {
+	return ch.aead.Seal(nil, ch.nextNonce(), data, nil)
+}
+
+func (ch *channel) open(data []byte) ([]byte, error) {
+	return ch.aead.Open(nil, ch.nextNonce(), data, nil)
+}
+
+// The handshake follows the KK pattern of Noise, as both parties know the static keys of each other:
+//
+//  1. the initiator sends its pid and an ephemeral key,
+//  2. the responder sends an ephemeral key and a confirmation sealed with the key from the responder to the initiator,
+//  3. the initiator sends a confirmation sealed with the key from the initiator to the responder.
+//
+// Both keys are derived from all four Diffie-Hellman values of the static and the ephemeral keys and bound to
+// the pids and the keys of the handshake, so only the holders of the static keys of the claimed pids agree on them,
+// and data sealed with them stays confidential even if the static keys leak later.
+// Confirmations are empty messages sealed with the nonce 0, so frames are sealed starting with the nonce 1.
+
+// initiate runs the handshake as the initiator over the connection dialed to pid
+// and returns the channel sealing the frames sent to it
+func (s *server) initiate(conn network.Connection, pid uint16) (*channel, error) {
+	ephemeral, err := NewIdentity()
+	if err != nil {
+		return nil, err
+	}
+	msg := make([]byte, 2, 2+KeySize)
+	binary.LittleEndian.PutUint16(msg, s.pid)
+	if err = writeHandshake(conn, append(msg, ephemeral.pub...)); err != nil {
+		return nil, err
+	}
+
+	reply := make([]byte, KeySize+chacha20poly1305.Overhead)
+	if err = readHandshake(conn, reply); err != nil {
+		return nil, err
+	}
+	toPeer, fromPeer, err := s.deriveKeys(pid, true, ephemeral, reply[:KeySize])
+	if err != nil {
+		return nil, err
+	}
+	if _, err = fromPeer.open(reply[KeySize:]); err != nil {
+		return nil, fmt.Errorf("handshake with %v: wrong confirmation: %v", pid, err)
+	}
+	if err = writeHandshake(conn, toPeer.seal(nil)); err != nil {
+		return nil, err
+	}
+	return toPeer, nil
+}
+
+// respond runs the handshake as the responder over an incoming connection
+// and returns the pid of the authenticated initiator together with the channel opening the frames sent by it
+func (s *server) respond(conn network.Connection) (uint16, *channel, error) {
+	msg := make([]byte, 2+KeySize)
+	if err := readHandshake(conn, msg); err != nil {
+		return 0, nil, err
+	}
+	pid := binary.LittleEndian.Uint16(msg[:2])
+	if pid >= s.nProc || pid == s.pid {
+		return 0, nil, fmt.Errorf("handshake: wrong pid %v", pid)
+	}
+
+	ephemeral, err := NewIdentity()
+	if err != nil {
+		return 0, nil, err
+	}
+	toPeer, fromPeer, err := s.deriveKeys(pid, false, ephemeral, msg[2:])
+	if err != nil {
+		return 0, nil, err
+	}
+	if err = writeHandshake(conn, append(ephemeral.Public(), toPeer.seal(nil)...)); err != nil {
+		return 0, nil, err
+	}
+
+	confirmation := make([]byte, chacha20poly1305.Overhead)
+	if err = readHandshake(conn, confirmation); err != nil {
+		return 0, nil, err
+	}
+	if _, err = fromPeer.open(confirmation); err != nil {
+		return 0, nil, fmt.Errorf("handshake with %v: wrong confirmation: %v", pid, err)
+	}
+	return pid, fromPeer, nil
+}
+
+// deriveKeys derives the keys of the handshake with pid, in which we are the initiator or the responder,
+// from our keys and the keys of pid. It returns the channels from us to pid and from pid to us.
+func (s *server) deriveKeys(pid uint16, initiator bool, ephemeral *Identity, remoteEphemeral []byte) (*channel, *channel, error) {
+	remoteStatic := s.peers[pid]
+	ee, err := curve25519.X25519(ephemeral.priv, remoteEphemeral)
+	if err != nil {
+		return nil, nil, err
+	}
+	// es and se combine the ephemeral key of the initiator with the static key of the responder and vice versa
+	es, err := curve25519.X25519(ephemeral.priv, remoteStatic)
+	if err != nil {
+		return nil, nil, err
+	}
+	se, err := curve25519.X25519(s.identity.priv, remoteEphemeral)
+	if err != nil {
+		return nil, nil, err
+	}
+	ss, err := curve25519.X25519(s.identity.priv, remoteStatic)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the hash of the handshake lists the pids and the keys of the initiator first
+	hash := sha256.New()
+	hash.Write([]byte(handshakeLabel))
+	pids := make([]byte, 4)
+	keys := [][]byte{s.identity.pub, remoteStatic, ephemeral.pub, remoteEphemeral}
+	if initiator {
+		binary.LittleEndian.PutUint16(pids[:2], s.pid)
+		binary.LittleEndian.PutUint16(pids[2:], pid)
+	} else {
+		binary.LittleEndian.PutUint16(pids[:2], pid)
+		binary.LittleEndian.PutUint16(pids[2:], s.pid)
+		keys = [][]byte{remoteStatic, s.identity.pub, remoteEphemeral, ephemeral.pub}
+		es, se = se, es
+	}
+	hash.Write(pids)
+	hash.Write(bytes.Join(keys, nil))
+
+	secrets := bytes.Join([][]byte{ee, es, se, ss}, nil)
+	kdf := hkdf.New(sha256.New, secrets, hash.Sum(nil), []byte(handshakeLabel))
+	// the first key seals data from the initiator to the responder, the second one from the responder to the initiator
+	derived := make([]byte, 2*chacha20poly1305.KeySize)
+	if _, err = io.ReadFull(kdf, derived); err != nil {
+		return nil, nil, err
+	}
+	toKey, fromKey := derived[:chacha20poly1305.KeySize], derived[chacha20poly1305.KeySize:]
+	if !initiator {
+		toKey, fromKey = fromKey, toKey
+	}
+	toPeer, err := newChannel(toKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	fromPeer, err := newChannel(fromKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return toPeer, fromPeer, nil
+}
+
+// writeHandshake writes a message of the handshake to the connection
+func writeHandshake(conn network.Connection, msg []byte) error {
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+	return conn.Flush()
+}
+
+// readHandshake reads a message of the handshake from the connection. Unlike reading frames, timeouts are errors,
+// as a party sends the messages of the handshake right away.
+func readHandshake(conn network.Connection, buf []byte) error {
+	for nRead := 0; nRead < len(buf); {
+		n, err := conn.Read(buf[nRead:])
+		nRead += n
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package sync_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	stdsync "sync"
+	"time"
+
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"gitlab.com/alephledger/core-go/pkg/network"
+	"gitlab.com/alephledger/core-go/pkg/tests"
+)
+
+// wire keeps all data written over the connections of a network, and may tamper with it
+type wire struct {
+	mx     stdsync.Mutex
+	data   []byte
+	tamper bool
+}
+
+func (w *wire) contains(data []byte) bool {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	return bytes.Contains(w.data, data)
+}
+
+func (w *wire) setTamper(tamper bool) {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	w.tamper = tamper
+}
+
+type wiredServer struct {
+	network.Server
+	wire *wire
+}
+
+func (ws *wiredServer) Dial(pid uint16) (network.Connection, error) {
+	conn, err := ws.Server.Dial(pid)
+	if err != nil {
+		return nil, err
+	}
+	return &wiredConn{conn, ws.wire}, nil
+}
+
+func (ws *wiredServer) Listen() (network.Connection, error) {
+	conn, err := ws.Server.Listen()
+	if err != nil {
+		return nil, err
+	}
+	return &wiredConn{conn, ws.wire}, nil
+}
+
+type wiredConn struct {
+	network.Connection
+	wire *wire
+}
+
+// Write records the data and flips its last bit if the wire tampers with data
+func (wc *wiredConn) Write(data []byte) (int, error) {
+	wc.wire.mx.Lock()
+	wc.wire.data = append(wc.wire.data, data...)
+	if wc.wire.tamper && len(data) > 0 {
+		data = append([]byte{}, data...)
+		data[len(data)-1] ^= 1
+	}
+	wc.wire.mx.Unlock()
+	return wc.Connection.Write(data)
+}
+
+var _ = Describe("Secure Sync Server", func() {
+
+	var (
+		nProc        uint16
+		roundTimeout time.Duration
+		netservs     []network.Server
+		wired        []network.Server
+		w            *wire
+		identities   []*sync.Identity
+		peers        [][]byte
+		syncservs    []sync.Server
+		errors       []error
+		wg           stdsync.WaitGroup
+		secret       [][]byte
+	)
+
+	BeforeEach(func() {
+		nProc = 2
+		roundTimeout = 300 * time.Millisecond
+		netservs = tests.NewNetwork(int(nProc), time.Millisecond*100)
+		w = &wire{}
+		wired = make([]network.Server, nProc)
+		identities = make([]*sync.Identity, nProc)
+		peers = make([][]byte, nProc)
+		secret = make([][]byte, nProc)
+		for i := uint16(0); i < nProc; i++ {
+			wired[i] = &wiredServer{netservs[i], w}
+			var err error
+			identities[i], err = sync.NewIdentity()
+			Expect(err).NotTo(HaveOccurred())
+			peers[i] = identities[i].Public()
+			secret[i] = []byte(fmt.Sprintf("the secret data of pid %v", i))
+		}
+		syncservs = make([]sync.Server, nProc)
+		errors = make([]error, nProc)
+		wg = stdsync.WaitGroup{}
+	})
+
+	AfterEach(func() {
+		for _, s := range syncservs {
+			if s != nil {
+				s.Stop()
+			}
+		}
+		tests.CloseNetwork(netservs)
+	})
+
+	newSecureServer := func(pid uint16) sync.Server {
+		s, err := sync.NewSecureServer(pid, nProc, roundTimeout, wired[pid], identities[pid], peers)
+		Expect(err).NotTo(HaveOccurred())
+		return s
+	}
+
+	// round runs a round in which every party sends its secret data and checks the data of the others
+	round := func() {
+		wg.Add(int(nProc))
+		for i := uint16(0); i < nProc; i++ {
+			go func(i uint16) {
+				defer wg.Done()
+				errors[i] = syncservs[i].Round([][]byte{secret[i]}, func(pid uint16, data []byte) error {
+					if !bytes.Equal(data, secret[pid]) {
+						return fmt.Errorf("received wrong data from %v", pid)
+					}
+					return nil
+				})
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	Context("All parties know the identities of each other", func() {
+
+		JustBeforeEach(func() {
+			for i := uint16(0); i < nProc; i++ {
+				syncservs[i] = newSecureServer(i)
+				syncservs[i].Start()
+			}
+		})
+
+		It("Should run rounds and send no data in the clear", func() {
+			round()
+			round()
+
+			for i := uint16(0); i < nProc; i++ {
+				Expect(errors[i]).NotTo(HaveOccurred())
+				Expect(w.contains(secret[i])).To(BeFalse())
+			}
+		})
+
+		It("Should fail a round whose data is tampered with on the wire", func() {
+			round()
+			for i := uint16(0); i < nProc; i++ {
+				Expect(errors[i]).NotTo(HaveOccurred())
+			}
+
+			w.setTamper(true)
+			round()
+
+			for i := uint16(0); i < nProc; i++ {
+				rErr, ok := errors[i].(*sync.RoundError)
+				Expect(ok).To(BeTrue())
+				Expect(rErr.Missing()).To(Equal([]uint16{1 - i}))
+			}
+		})
+	})
+
+	Context("The parties have no identities", func() {
+
+		It("Should send data in the clear", func() {
+			for i := uint16(0); i < nProc; i++ {
+				syncservs[i] = sync.NewServer(i, nProc, roundTimeout, wired[i])
+				syncservs[i].Start()
+			}
+			round()
+
+			for i := uint16(0); i < nProc; i++ {
+				Expect(errors[i]).NotTo(HaveOccurred())
+				Expect(w.contains(secret[i])).To(BeTrue())
+			}
+		})
+	})
+
+	Context("The second party sends malformed frames", func() {
+
+		// sendRaw connects to the first party as the second one with no identities and sends the data over the connection
+		sendRaw := func(data []byte) {
+			conn, err := netservs[1].Dial(0)
+			Expect(err).NotTo(HaveOccurred())
+			msg := make([]byte, 2)
+			binary.LittleEndian.PutUint16(msg, 1)
+			_, err = conn.Write(append(msg, data...))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conn.Flush()).To(Succeed())
+		}
+
+		// roundOfFirst runs a round of the first party only
+		roundOfFirst := func() error {
+			return syncservs[0].Round([][]byte{secret[0]}, func(uint16, []byte) error { return nil })
+		}
+
+		BeforeEach(func() {
+			syncservs[0] = sync.NewServer(0, nProc, roundTimeout, wired[0])
+			syncservs[0].Start()
+		})
+
+		It("Should drop the connection of a frame longer than the maximum without allocating it", func() {
+			frameLen := make([]byte, 8)
+			binary.LittleEndian.PutUint64(frameLen, 1<<40)
+			sendRaw(frameLen)
+
+			err := roundOfFirst()
+			rErr, ok := err.(*sync.RoundError)
+			Expect(ok).To(BeTrue())
+			Expect(rErr.Missing()).To(Equal([]uint16{1}))
+			Expect(err).To(MatchError(ContainSubstring("longer than")))
+		})
+
+		It("Should drop the connection of a frame claiming to come from another party", func() {
+			frame := make([]byte, 8+18)
+			binary.LittleEndian.PutUint64(frame[:8], 18)
+			binary.LittleEndian.PutUint16(frame[8:10], 5)
+			sendRaw(frame)
+
+			err := roundOfFirst()
+			rErr, ok := err.(*sync.RoundError)
+			Expect(ok).To(BeTrue())
+			Expect(rErr.Missing()).To(Equal([]uint16{1}))
+			Expect(err).To(MatchError(ContainSubstring("claims to come from 5")))
+		})
+	})
+
+	Context("Someone impersonates the second party", func() {
+
+		It("Should drop the connection of the impersonator and connect to the second party", func() {
+			syncservs[0] = newSecureServer(0)
+			syncservs[0].Start()
+
+			impersonator, err := sync.NewIdentity()
+			Expect(err).NotTo(HaveOccurred())
+			conn, err := netservs[1].Dial(0)
+			Expect(err).NotTo(HaveOccurred())
+			msg := make([]byte, 2)
+			binary.LittleEndian.PutUint16(msg, 1)
+			_, err = conn.Write(append(msg, impersonator.Public()...))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conn.Flush()).To(Succeed())
+			reply := make([]byte, sync.KeySize+16)
+			_, err = conn.Read(reply)
+			Expect(err).NotTo(HaveOccurred())
+			// the impersonator cannot confirm the keys, as it does not know the identity of the second party
+			_, err = conn.Write(make([]byte, 16))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(conn.Flush()).To(Succeed())
+			_, err = conn.Read(reply)
+			Expect(err).To(HaveOccurred())
+
+			syncservs[1] = newSecureServer(1)
+			syncservs[1].Start()
+			round()
+
+			for i := uint16(0); i < nProc; i++ {
+				Expect(errors[i]).NotTo(HaveOccurred())
+			}
+		})
+	})
+
+	Describe("Constructing a server", func() {
+
+		It("Should refuse an identity that does not match the public key of the party", func() {
+			_, err := sync.NewSecureServer(0, nProc, roundTimeout, wired[0], identities[1], peers)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should refuse public keys of a wrong length", func() {
+			peers[1] = peers[1][1:]
+			_, err := sync.NewSecureServer(0, nProc, roundTimeout, wired[0], identities[0], peers)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
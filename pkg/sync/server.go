@@ -1,11 +1,19 @@
-// Package sync in it current form works only for one round going on at a time
+// Package sync implements rounds of communication among a fixed set of parties.
+// A round is driven by messages: it completes as soon as the data of all parties, or of a quorum of them,
+// for its id arrives, or fails when the round timeout passes, so the parties need no common clock.
+// Rounds are run in sessions multiplexed over the same connections, each with its own round counter,
+// so that several protocol instances may run concurrently. Rounds of one session have to be run one at a time,
+// and a round started while another one of the same session is running fails.
+// Rounds of a server bound to a context also fail as soon as the context is done, so that a hung protocol can be cancelled.
+// A server constructed with NewSecureServer authenticates the parties with their identity keys and encrypts all data,
+// while one constructed with NewServer trusts the pids sent by whoever connects and sends data in the clear.
 package sync
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
-
-	"os"
 	"strings"
 	"sync"
 	"time"
@@ -17,36 +25,145 @@ import (
 type Server interface {
 	Start()
 	Stop()
+	// Round sends the data to the other parties and waits for their data, checking it with the given function.
+	// The same data is sent to all parties if there is one element, and the pid-th element to party pid otherwise,
+	// in which case nothing is sent to the parties whose element is nil.
 	Round([][]byte, func(uint16, []byte) error) error
+	// QuorumRound runs a round like Round, but completes as soon as the data of quorum parties, counting this one,
+	// has arrived and passed the check. It returns the parties whose data has not passed the check by then.
+	// It fails with a RoundError only if the quorum cannot be reached.
+	QuorumRound([][]byte, func(uint16, []byte) error, uint16) ([]uint16, error)
+	NextRoundID() int64
+	// SessionID returns the id of the session in which the server runs rounds
+	SessionID() uint64
+	// Session returns a server running rounds of the session with the given id over the same connections.
+	// Its Start does nothing, as the connections are managed by the server it comes from, and its Stop closes the session:
+	// the data kept for it is dropped, later data sent for it is ignored, and its rounds fail.
+	Session(id uint64) Server
+	// WithContext returns a server running rounds of the same session, which fail with a TimeoutError as soon as ctx is done.
+	// The context replaces the one the server is bound to, if any, and sessions of the returned server are bound to it as well.
+	// As for Session, Start of the returned server does nothing and Stop closes the session.
+	WithContext(ctx context.Context) Server
+}
+
+// maxFrameLen is the maximal length of a frame, sealed or not. A party sending a longer one is disconnected,
+// so that it cannot make us allocate arbitrary amounts of memory.
+const maxFrameLen = 1 << 24
+
+// headerLen is the length of the header of data sent in a round: the pid of the sender, the session id and the round id
+const headerLen = 2 + 8 + 8
+
+// maxRoundsAhead is how many rounds past the last finished round of its session data may be sent for to be kept.
+// Parties run ahead of us only by rounds completed without our data, so data for rounds further ahead is dropped.
+const maxRoundsAhead = 64
+
+// maxPendingSessions is the maximal number of sessions not yet run here for which the data of one party is kept.
+// Data of a party for further such sessions is dropped, so a party sending data for sessions that are never run here
+// takes a bounded amount of memory, and only ever disturbs its own sessions.
+const maxPendingSessions = 64
+
+// msgKey identifies the data sent by a party in a round of a session
+type msgKey struct {
+	sid uint64
+	rid int64
+	pid uint16
 }
 
 type server struct {
 	pid, nProc              uint16
-	startTime               time.Time
-	roundDuration           time.Duration
-	roundID                 int64
+	roundTimeout            time.Duration
 	net                     network.Server
 	inDataConn, outDataConn []network.Connection
-	prevRoundEnd            time.Time
-	startWG                 sync.WaitGroup
+	// identity and peers are the identity of this party and the public keys of the identities of all parties,
+	// and inChannel and outChannel secure the connections with them. They are nil for a server with no identity.
+	identity              *Identity
+	peers                 [][]byte
+	inChannel, outChannel []*channel
+	startWG               sync.WaitGroup
+	// writeMx guards the outgoing connections, as rounds of different sessions write to them concurrently
+	writeMx []sync.Mutex
+	// mx guards the fields below
+	mx       sync.Mutex
+	stopped  bool
+	sessions map[uint64]*session
+	// mailbox keeps the data read from the connections until the rounds it was sent for take it.
+	// buffered counts the frames of every party in it by sessions, and pending counts for every party
+	// the sessions not yet run here it has frames in the mailbox for.
+	mailbox  map[msgKey][]byte
+	buffered map[uint64][]int
+	pending  []int
+	// readErr keeps the errors that stopped reading from the connections
+	readErr []error
+	// received is signaled whenever data is put in the mailbox or reading from a connection stops
+	received *sync.Cond
+	*session
+}
+
+// session runs rounds of one session over the connections of the server
+type session struct {
+	*server
+	id      uint64
+	roundID int64
+	// finished is the id of the last finished round, running tells whether a round is being run,
+	// and closed whether the session has been closed, all guarded by mx of the server
+	finished int64
+	running  bool
+	closed   bool
+}
+
+// boundSession runs rounds of a session which fail as soon as its context is done
+type boundSession struct {
+	*session
+	ctx context.Context
 }
 
-// NewServer construcs a SyncServer object
-func NewServer(pid, nProc uint16, startTime time.Time, roundDuration time.Duration, net network.Server) Server {
+// NewServer construcs a SyncServer object running rounds of the session 0.
+// A round fails if the data of some party does not arrive within roundTimeout from its start.
+func NewServer(pid, nProc uint16, roundTimeout time.Duration, net network.Server) Server {
 	s := &server{
-		pid:           pid,
-		nProc:         nProc,
-		startTime:     startTime,
-		roundDuration: roundDuration,
-		roundID:       -1,
-		net:           net,
+		pid:          pid,
+		nProc:        nProc,
+		roundTimeout: roundTimeout,
+		net:          net,
+		writeMx:      make([]sync.Mutex, nProc),
+		sessions:     map[uint64]*session{},
+		mailbox:      map[msgKey][]byte{},
+		buffered:     map[uint64][]int{},
+		pending:      make([]int, nProc),
+		readErr:      make([]error, nProc),
 	}
+	s.received = sync.NewCond(&s.mx)
 	s.inDataConn = make([]network.Connection, nProc)
 	s.outDataConn = make([]network.Connection, nProc)
+	s.inChannel = make([]*channel, nProc)
+	s.outChannel = make([]*channel, nProc)
+	s.session = s.getSession(0)
 
 	return s
 }
 
+// NewSecureServer constructs a server like NewServer, which runs a handshake with every other party over its connections.
+// The handshake authenticates both parties with their identities, whose public keys are given in peers, indexed by pids,
+// and establishes keys that encrypt and authenticate all data sent over the connection.
+// Connections whose handshake fails are dropped.
+func NewSecureServer(pid, nProc uint16, roundTimeout time.Duration, net network.Server, identity *Identity, peers [][]byte) (Server, error) {
+	if len(peers) != int(nProc) {
+		return nil, fmt.Errorf("got public keys of %v parties for a committee of %v", len(peers), nProc)
+	}
+	for id, pub := range peers {
+		if len(pub) != KeySize {
+			return nil, fmt.Errorf("wrong length of the public key of pid %v: expected %v, got %v", id, KeySize, len(pub))
+		}
+	}
+	if !bytes.Equal(peers[pid], identity.pub) {
+		return nil, fmt.Errorf("the public key of pid %v does not match the identity", pid)
+	}
+	s := NewServer(pid, nProc, roundTimeout, net).(*server)
+	s.identity = identity
+	s.peers = peers
+	return s, nil
+}
+
 func (s *server) Start() {
 	s.startWG.Add(2*int(s.nProc) - 2)
 	go func() {
@@ -62,17 +179,17 @@ func (s *server) Start() {
 						continue
 					}
 
-					buf := make([]byte, 2)
-					_, err = conn.Read(buf)
+					pid, ch, err := s.accept(conn)
 					if err != nil {
-						panic(err.Error())
+						conn.Close()
+						continue
 					}
-
-					pid := binary.LittleEndian.Uint16(buf)
-					if s.inDataConn[pid] != nil {
-						panic(fmt.Sprintf("Connection with %d already established (my pid:%v)!", pid, s.pid))
+					// a party connects to us once, so a second connection claiming the same pid is dropped
+					if !s.setInDataConn(pid, conn, ch) {
+						conn.Close()
+						continue
 					}
-					s.inDataConn[pid] = conn
+					go s.read(pid)
 					return
 				}
 			}()
@@ -91,15 +208,12 @@ func (s *server) Start() {
 					if err != nil {
 						continue
 					}
-					buf := make([]byte, 2)
-					binary.LittleEndian.PutUint16(buf, s.pid)
-					if _, err = conn.Write(buf); err != nil {
-						panic(fmt.Sprintf("succesfully dialed %v but then %v", pid, err))
-					}
-					if err = conn.Flush(); err != nil {
-						panic(fmt.Sprintf("succesfully written %v but then %v", pid, err))
+					ch, err := s.connect(conn, pid)
+					if err != nil {
+						conn.Close()
+						continue
 					}
-					s.outDataConn[pid] = conn
+					s.outDataConn[pid], s.outChannel[pid] = conn, ch
 					return
 				}
 			}(pid)
@@ -107,8 +221,50 @@ func (s *server) Start() {
 	}()
 }
 
+// accept learns the pid of the party that connected to us, running the handshake with it if we have an identity.
+// It returns the channel opening the frames sent over the connection, nil if there is no identity.
+func (s *server) accept(conn network.Connection) (uint16, *channel, error) {
+	if s.identity != nil {
+		return s.respond(conn)
+	}
+	buf := make([]byte, 2)
+	if err := readHandshake(conn, buf); err != nil {
+		return 0, nil, err
+	}
+	pid := binary.LittleEndian.Uint16(buf)
+	if pid >= s.nProc || pid == s.pid {
+		return 0, nil, fmt.Errorf("wrong pid %v", pid)
+	}
+	return pid, nil, nil
+}
+
+// setInDataConn sets the incoming connection with pid unless it has been set already, and tells whether it did
+func (s *server) setInDataConn(pid uint16, conn network.Connection, ch *channel) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.inDataConn[pid] != nil {
+		return false
+	}
+	s.inDataConn[pid], s.inChannel[pid] = conn, ch
+	return true
+}
+
+// connect tells our pid to the party we connected to, running the handshake with it if we have an identity.
+// It returns the channel sealing the frames sent over the connection, nil if there is no identity.
+func (s *server) connect(conn network.Connection, pid uint16) (*channel, error) {
+	if s.identity != nil {
+		return s.initiate(conn, pid)
+	}
+	buf := make([]byte, 2)
+	binary.LittleEndian.PutUint16(buf, s.pid)
+	return nil, writeHandshake(conn, buf)
+}
+
 func (s *server) Stop() {
 	s.startWG.Wait()
+	s.mx.Lock()
+	s.stopped = true
+	s.mx.Unlock()
 	for pid := uint16(0); pid < s.nProc; pid++ {
 		if pid == s.pid {
 			continue
@@ -118,123 +274,227 @@ func (s *server) Stop() {
 	}
 }
 
-func (s *server) Round(toSend [][]byte, check func(uint16, []byte) error) error {
-	s.startWG.Wait()
-	defer func() { s.prevRoundEnd = time.Now() }()
-
-	s.roundID++
-	if s.roundID == 0 {
-		// TODO: temporary solution for scheduling the start, rewrite this ugly sleep
-		d := time.Until(s.startTime)
-		if d < 0 {
-			return wrap(fmt.Errorf("the start time has passed %v ago", d))
+func (s *server) Session(id uint64) Server {
+	return s.getSession(id)
+}
+
+// getSession returns the session with the given id, creating it if needed
+func (s *server) getSession(id uint64) *session {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	ss, ok := s.sessions[id]
+	if !ok {
+		ss = &session{server: s, id: id, roundID: -1, finished: -1}
+		s.sessions[id] = ss
+		// the data already kept for the session no longer counts as pending
+		for pid, n := range s.buffered[id] {
+			if n > 0 {
+				s.pending[pid]--
+			}
 		}
-		time.Sleep(d)
+	}
+	return ss
+}
+
+func (ss *session) WithContext(ctx context.Context) Server {
+	return &boundSession{ss, ctx}
+}
 
-	} else {
-		// TODO: This is rather dirty hack for ensuring that rounds dont interlace
-		if time.Since(s.prevRoundEnd) < time.Millisecond {
-			time.Sleep(time.Millisecond)
+// Start does nothing, as the connections are managed by the server
+func (ss *session) Start() {}
+
+// Stop closes the session: it drops the data kept for the session, later data sent for it is ignored
+// and its rounds fail. The connections are managed by the server.
+func (ss *session) Stop() {
+	ss.mx.Lock()
+	defer ss.mx.Unlock()
+	ss.closed = true
+	for key := range ss.mailbox {
+		if key.sid == ss.id {
+			delete(ss.mailbox, key)
 		}
 	}
+	delete(ss.buffered, ss.id)
+}
+
+// NextRoundID returns the id of the round run by the next call to Round
+func (ss *session) NextRoundID() int64 {
+	return ss.roundID + 1
+}
+
+// SessionID returns the id of the session
+func (ss *session) SessionID() uint64 {
+	return ss.id
+}
+
+func (ss *session) Round(toSend [][]byte, check func(uint16, []byte) error) error {
+	_, err := ss.round(context.Background(), toSend, check, ss.nProc)
+	return err
+}
+
+func (ss *session) QuorumRound(toSend [][]byte, check func(uint16, []byte) error, quorum uint16) ([]uint16, error) {
+	return ss.round(context.Background(), toSend, check, quorum)
+}
+
+func (bs *boundSession) Round(toSend [][]byte, check func(uint16, []byte) error) error {
+	_, err := bs.round(bs.ctx, toSend, check, bs.nProc)
+	return err
+}
 
-	endRound := time.Now().Add(s.roundDuration)
+func (bs *boundSession) QuorumRound(toSend [][]byte, check func(uint16, []byte) error, quorum uint16) ([]uint16, error) {
+	return bs.round(bs.ctx, toSend, check, quorum)
+}
+
+func (bs *boundSession) Session(id uint64) Server {
+	return bs.getSession(id).WithContext(bs.ctx)
+}
+
+func (bs *boundSession) WithContext(ctx context.Context) Server {
+	return bs.session.WithContext(ctx)
+}
+
+// round runs a round which completes as soon as the data of quorum parties, counting this one, has passed check.
+// It returns the parties whose data has not passed check by then. The round fails if ctx is done before.
+func (ss *session) round(ctx context.Context, toSend [][]byte, check func(uint16, []byte) error, quorum uint16) ([]uint16, error) {
+	ss.startWG.Wait()
+	if err := ss.begin(); err != nil {
+		return nil, wrap(err)
+	}
+	defer ss.finish()
+
+	if quorum > ss.nProc {
+		return nil, wrap(fmt.Errorf("the quorum of %v parties is bigger than the committee of %v", quorum, ss.nProc))
+	}
+	deadline := time.Now().Add(ss.roundTimeout)
 	var wg sync.WaitGroup
 	var errSend error
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		errSend = s.sendToAll(toSend)
+		errSend = ss.sendToAll(toSend)
 	}()
 
-	data, missing, err := s.receiveFromAll(endRound)
-	if err != nil {
-		return wrap(err)
-	}
-
-	if len(missing) > 0 {
-		return newRoundError("Missing data from some parties", missing)
-	}
+	passed, wrong, timedOut, errors := ss.receiveFromAll(ctx, check, quorum, deadline)
 
 	wg.Wait()
 
 	if errSend != nil {
-		return wrap(errSend)
+		return nil, wrap(errSend)
 	}
 
-	errors := []error{}
-	wrong := []uint16{}
-	for pid := uint16(0); pid < s.nProc; pid++ {
-		if pid == s.pid {
+	nPassed := uint16(1)
+	laggards := []uint16{}
+	for pid := uint16(0); pid < ss.nProc; pid++ {
+		if pid == ss.pid {
 			continue
 		}
-		err = check(pid, data[pid])
-		if err != nil {
-			errors = append(errors, err)
-			wrong = append(wrong, pid)
+		if passed[pid] {
+			nPassed++
+		} else {
+			laggards = append(laggards, pid)
 		}
 	}
-
-	if len(wrong) > 0 {
-		return newRoundError(fmt.Errorf("rid:%v: Data sent by the parties %v is wrong with errors %v", s.roundID, wrong, errors).Error(), wrong)
+	if nPassed >= quorum {
+		return laggards, nil
 	}
 
-	// TODO: better timeout handling
-	d := time.Until(endRound)
-	if d > time.Second {
-		fmt.Fprintf(os.Stderr, "rid:%v: Round: receiving took too long %v\n", s.roundID, d)
+	// the data of the parties that did send it has been checked even if some parties are missing,
+	// so that the caller may proceed without them
+	missing, wrongPids := []uint16{}, []uint16{}
+	recvErrors, checkErrors := []error{}, []error{}
+	anyTimedOut := false
+	for _, pid := range laggards {
+		if wrong[pid] {
+			wrongPids = append(wrongPids, pid)
+			checkErrors = append(checkErrors, errors[pid])
+		} else {
+			missing = append(missing, pid)
+			recvErrors = append(recvErrors, errors[pid])
+			anyTimedOut = anyTimedOut || timedOut[pid]
+		}
+	}
+	if len(wrongPids) == 0 && anyTimedOut {
+		msg := fmt.Sprintf("sid:%v rid:%v: No data in time from the parties %v: %v", ss.id, ss.roundID, missing, recvErrors)
+		return nil, newTimeoutError(msg, missing)
 	}
+	var b strings.Builder
+	if len(missing) > 0 {
+		fmt.Fprintf(&b, "sid:%v rid:%v: Missing data from the parties %v: %v", ss.id, ss.roundID, missing, recvErrors)
+	}
+	if len(wrongPids) > 0 {
+		fmt.Fprintf(&b, "sid:%v rid:%v: Data sent by the parties %v is wrong with errors %v", ss.id, ss.roundID, wrongPids, checkErrors)
+	}
+	return nil, newRoundError(b.String(), mergeSorted(missing, wrongPids))
+}
 
+// begin starts the next round of the session. It fails if another round of the session is being run,
+// as the rounds would take each other's data.
+func (ss *session) begin() error {
+	ss.mx.Lock()
+	defer ss.mx.Unlock()
+	if ss.closed {
+		return fmt.Errorf("sid:%v: the session is closed", ss.id)
+	}
+	if ss.running {
+		return fmt.Errorf("sid:%v: a round of the session is already running", ss.id)
+	}
+	ss.running = true
+	ss.roundID++
 	return nil
 }
 
-func (s *server) sendToAll(toSend [][]byte) error {
+// finish marks the current round as finished and drops the data received for it,
+// so that data arriving late for this or earlier rounds is not kept
+func (ss *session) finish() {
+	ss.mx.Lock()
+	defer ss.mx.Unlock()
+	ss.running = false
+	ss.finished = ss.roundID
+	for pid := uint16(0); pid < ss.nProc; pid++ {
+		ss.takeFromMailbox(msgKey{ss.id, ss.roundID, pid})
+	}
+}
+
+// sendToAll sends toSend[0] to all parties if toSend has one element, and toSend[pid] to every party pid otherwise.
+// Nothing is sent to the parties whose element is nil.
+func (ss *session) sendToAll(toSend [][]byte) error {
 	var data []byte
 	// Check if we send the same data to all parties
 	if len(toSend) == 1 {
-		data = make([]byte, 10+len(toSend[0]))
-		binary.LittleEndian.PutUint16(data[:2], s.pid)
-		binary.LittleEndian.PutUint64(data[2:10], uint64(s.roundID))
-		copy(data[10:], toSend[0])
+		data = ss.frame(toSend[0])
 	}
 	wg := sync.WaitGroup{}
-	wg.Add(int(s.nProc) - 1)
-	errors := make([]error, s.nProc)
-	for pid := uint16(0); pid < s.nProc; pid++ {
-		if pid == s.pid {
+	wg.Add(int(ss.nProc) - 1)
+	errors := make([]error, ss.nProc)
+	for pid := uint16(0); pid < ss.nProc; pid++ {
+		if pid == ss.pid {
+			continue
+		}
+		if data == nil && toSend[pid] == nil {
+			wg.Done()
 			continue
 		}
 		go func(pid uint16) {
 			defer wg.Done()
-			var d []byte
-			if data == nil {
-				d = make([]byte, 10+len(toSend[pid]))
-				binary.LittleEndian.PutUint16(d[:2], s.pid)
-				binary.LittleEndian.PutUint64(d[2:10], uint64(s.roundID))
-				copy(d[10:], toSend[pid])
-			} else {
-				d = data
+			d := data
+			if d == nil {
+				d = ss.frame(toSend[pid])
 			}
-			conn := s.outDataConn[pid]
-			dataLen := make([]byte, 8)
-			binary.LittleEndian.PutUint64(dataLen, uint64(len(d)))
-			_, err := conn.Write(dataLen)
-			if err != nil {
-				errors[pid] = err
+			// rounds of other sessions may write to the same connection, so the whole frame is written at once,
+			// and it is sealed under the same lock, as frames have to be written in the order of their nonces
+			ss.writeMx[pid].Lock()
+			defer ss.writeMx[pid].Unlock()
+			d = ss.seal(pid, d)
+			if len(d)-8 > maxFrameLen {
+				errors[pid] = fmt.Errorf("the frame of %v bytes is longer than %v", len(d)-8, maxFrameLen)
 				return
 			}
-			err = conn.Flush()
-			if err != nil {
+			conn := ss.outDataConn[pid]
+			if _, err := conn.Write(d); err != nil {
 				errors[pid] = err
 				return
 			}
-			_, err = conn.Write(d)
-			if err != nil {
-				errors[pid] = err
-				return
-			}
-			err = conn.Flush()
-			if err != nil {
+			if err := conn.Flush(); err != nil {
 				errors[pid] = err
 				return
 			}
@@ -244,8 +504,8 @@ func (s *server) sendToAll(toSend [][]byte) error {
 	wg.Wait()
 
 	var b strings.Builder
-	for pid := uint16(0); pid < s.nProc; pid++ {
-		if pid == s.pid {
+	for pid := uint16(0); pid < ss.nProc; pid++ {
+		if pid == ss.pid {
 			continue
 		}
 		if errors[pid] != nil {
@@ -254,88 +514,257 @@ func (s *server) sendToAll(toSend [][]byte) error {
 	}
 
 	if b.Len() > 0 {
-		return fmt.Errorf("rid:%v: %v", s.roundID, b.String())
+		return fmt.Errorf("sid:%v rid:%v: %v", ss.id, ss.roundID, b.String())
 	}
 
 	return nil
 }
 
-func (s *server) receiveFromAll(endRound time.Time) ([][]byte, []uint16, error) {
-	data := make([][]byte, s.nProc)
-	missing := []uint16{}
+// frame prepends the data with its length and the header identifying the current round
+func (ss *session) frame(data []byte) []byte {
+	d := make([]byte, 8+headerLen+len(data))
+	binary.LittleEndian.PutUint64(d[:8], uint64(headerLen+len(data)))
+	binary.LittleEndian.PutUint16(d[8:10], ss.pid)
+	binary.LittleEndian.PutUint64(d[10:18], ss.id)
+	binary.LittleEndian.PutUint64(d[18:26], uint64(ss.roundID))
+	copy(d[26:], data)
+	return d
+}
 
-	wg := sync.WaitGroup{}
-	wg.Add(int(s.nProc) - 1)
-	errors := make([]error, s.nProc)
-	for pid := uint16(0); pid < s.nProc; pid++ {
-		if pid == s.pid {
-			continue
+// seal encrypts the frame sent to pid if the connection with it is secured, keeping it prefixed with its length
+func (s *server) seal(pid uint16, frame []byte) []byte {
+	ch := s.outChannel[pid]
+	if ch == nil {
+		return frame
+	}
+	sealed := ch.seal(frame[8:])
+	d := make([]byte, 8, 8+len(sealed))
+	binary.LittleEndian.PutUint64(d, uint64(len(sealed)))
+	return append(d, sealed...)
+}
+
+// receiveFromAll passes the data of the other parties for the current round to check as soon as it arrives,
+// until the data of quorum parties, counting this one, has passed check, no more data may arrive,
+// the deadline passes or ctx is done. It returns whose data passed check, whose was wrong, whose did not arrive in time,
+// and the errors of checking or receiving the data of the others.
+func (ss *session) receiveFromAll(ctx context.Context, check func(uint16, []byte) error, quorum uint16, deadline time.Time) ([]bool, []bool, []bool, []error) {
+	passed := make([]bool, ss.nProc)
+	wrong := make([]bool, ss.nProc)
+	timedOut := make([]bool, ss.nProc)
+	errors := make([]error, ss.nProc)
+	nPassed := uint16(1)
+
+	// wake up the loop below when the deadline passes or ctx is done
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		case <-stop:
+			return
 		}
-		go func(pid uint16) {
-			defer wg.Done()
+		ss.mx.Lock()
+		defer ss.mx.Unlock()
+		ss.received.Broadcast()
+	}()
 
-			dataLen := make([]byte, 8)
-			if n, err := s.inDataConn[pid].Read(dataLen); err != nil {
-				errors[pid] = fmt.Errorf("receiveFromAll dataLen err: %v, %v", n, err)
-				return
+	ss.mx.Lock()
+	defer ss.mx.Unlock()
+	for nPassed < quorum {
+		arrived := make([][]byte, ss.nProc)
+		nArrived, waiting := 0, false
+		for pid := uint16(0); pid < ss.nProc; pid++ {
+			if pid == ss.pid || passed[pid] || errors[pid] != nil {
+				continue
 			}
-			l := int(binary.LittleEndian.Uint64(dataLen))
-			buf := make([]byte, l)
-			nRead := 0
-			for {
-				n, err := s.inDataConn[pid].Read(buf[nRead:])
-				if err != nil {
-					errors[pid] = fmt.Errorf("receiveFromAll buf err: %v", err)
-					return
-				}
-				nRead += n
-				if nRead == l {
-					break
-				}
-
+			if data, ok := ss.takeFromMailbox(msgKey{ss.id, ss.roundID, pid}); ok {
+				arrived[pid] = data
+				nArrived++
+			} else if ss.readErr[pid] != nil {
+				errors[pid] = ss.readErr[pid]
+			} else {
+				waiting = true
 			}
+		}
 
-			if len(buf) < 10 {
-				errors[pid] = fmt.Errorf("rid:%v: received too short data from %v", s.roundID, pid)
-				return
-			}
-			id := binary.LittleEndian.Uint16(buf[:2])
-			if id != pid {
-				panic(fmt.Sprintf("some party uses wrong outDataConn: Expected %v, got %v", pid, id))
+		if nArrived > 0 {
+			// check may take a while, so data arriving meanwhile is put in the mailbox
+			ss.mx.Unlock()
+			for pid, data := range arrived {
+				if data == nil {
+					continue
+				}
+				if err := check(uint16(pid), data); err != nil {
+					errors[pid], wrong[pid] = err, true
+				} else {
+					passed[pid] = true
+					nPassed++
+				}
 			}
-			roundID := binary.LittleEndian.Uint64(buf[2:10])
-			if int64(roundID) != s.roundID {
-				errors[pid] = fmt.Errorf("received data for wrong round from pid:%v. Expected %d, got %d", pid, s.roundID, roundID)
-				return
+			ss.mx.Lock()
+			continue
+		}
+		if !waiting {
+			break
+		}
+		var errTimeout error
+		if ctx.Err() != nil {
+			errTimeout = ctx.Err()
+		} else if !time.Now().Before(deadline) {
+			errTimeout = fmt.Errorf("no data within the round timeout %v", ss.roundTimeout)
+		}
+		if errTimeout != nil {
+			for pid := uint16(0); pid < ss.nProc; pid++ {
+				if pid != ss.pid && !passed[pid] && errors[pid] == nil {
+					errors[pid], timedOut[pid] = errTimeout, true
+				}
 			}
+			break
+		}
+		ss.received.Wait()
+	}
 
-			data[pid] = buf[10:]
-		}(pid)
+	return passed, wrong, timedOut, errors
+}
+
+// read puts the data read from the connection with pid in the mailbox until reading fails.
+// Then the connection is closed, as the frames read from it can no longer be told apart.
+func (s *server) read(pid uint16) {
+	for {
+		key, data, err := s.readFrame(pid)
+		s.mx.Lock()
+		if err != nil {
+			s.readErr[pid] = err
+		} else {
+			s.putToMailbox(key, data)
+		}
+		s.received.Broadcast()
+		s.mx.Unlock()
+		if err != nil {
+			s.inDataConn[pid].Close()
+			return
+		}
 	}
+}
 
-	wg.Wait()
+// readFrame reads from the connection with pid the data sent for a round
+func (s *server) readFrame(pid uint16) (msgKey, []byte, error) {
+	dataLen := make([]byte, 8)
+	if err := s.readFull(s.inDataConn[pid], dataLen); err != nil {
+		return msgKey{}, nil, fmt.Errorf("receiveFromAll dataLen err: %v", err)
+	}
+	frameLen := binary.LittleEndian.Uint64(dataLen)
+	if frameLen > maxFrameLen {
+		return msgKey{}, nil, fmt.Errorf("frame of %v bytes from %v is longer than %v", frameLen, pid, maxFrameLen)
+	}
+	buf := make([]byte, int(frameLen))
+	if err := s.readFull(s.inDataConn[pid], buf); err != nil {
+		return msgKey{}, nil, fmt.Errorf("receiveFromAll buf err: %v", err)
+	}
+	if ch := s.inChannel[pid]; ch != nil {
+		var err error
+		if buf, err = ch.open(buf); err != nil {
+			return msgKey{}, nil, fmt.Errorf("data from %v fails to open: %v", pid, err)
+		}
+	}
 
-	// TODO: better timeout handling
-	d := time.Until(endRound)
-	if d > time.Second {
-		fmt.Fprintf(os.Stderr, "rid:%v: Round: receiving took too long %v\n", s.roundID, d)
+	if len(buf) < headerLen {
+		return msgKey{}, nil, fmt.Errorf("received too short data from %v", pid)
+	}
+	id := binary.LittleEndian.Uint16(buf[:2])
+	if id != pid {
+		return msgKey{}, nil, fmt.Errorf("data read from the connection with %v claims to come from %v", pid, id)
 	}
+	sid := binary.LittleEndian.Uint64(buf[2:10])
+	rid := int64(binary.LittleEndian.Uint64(buf[10:18]))
+	return msgKey{sid, rid, pid}, buf[headerLen:], nil
+}
 
-	var b strings.Builder
-	for pid := uint16(0); pid < s.nProc; pid++ {
-		if pid == s.pid {
-			continue
+// putToMailbox keeps the data until its round takes it. Data for closed sessions, for finished rounds and for rounds
+// more than maxRoundsAhead past the last finished one is dropped, so at most maxRoundsAhead frames of a party
+// are kept for a session. Data of a party for a session not yet run here is dropped if it already has data
+// for maxPendingSessions such sessions in the mailbox. It has to be called with mx locked.
+func (s *server) putToMailbox(key msgKey, data []byte) {
+	finished := int64(-1)
+	ss, known := s.sessions[key.sid]
+	if known {
+		if ss.closed {
+			return
 		}
-		if errors[pid] != nil {
-			fmt.Fprintf(&b, "[receiveFromAll] pid: %d, error: %v\n", pid, errors[pid])
-			// TODO: not all erros should be treated as missing
-			missing = append(missing, pid)
+		finished = ss.finished
+	}
+	if key.rid <= finished || key.rid > finished+maxRoundsAhead {
+		return
+	}
+	if _, ok := s.mailbox[key]; ok {
+		s.mailbox[key] = data
+		return
+	}
+	buffered := s.buffered[key.sid]
+	if buffered == nil {
+		buffered = make([]int, s.nProc)
+		s.buffered[key.sid] = buffered
+	}
+	if !known && buffered[key.pid] == 0 {
+		if s.pending[key.pid] >= maxPendingSessions {
+			return
 		}
+		s.pending[key.pid]++
 	}
+	buffered[key.pid]++
+	s.mailbox[key] = data
+}
 
-	if b.Len() > 0 {
-		return nil, missing, fmt.Errorf("rid:%v: %v", s.roundID, b.String())
+// takeFromMailbox removes the data with the given key from the mailbox and returns it, if there is any.
+// It has to be called with mx locked.
+func (s *server) takeFromMailbox(key msgKey) ([]byte, bool) {
+	data, ok := s.mailbox[key]
+	if ok {
+		delete(s.mailbox, key)
+		s.buffered[key.sid][key.pid]--
+	}
+	return data, ok
+}
+
+// readFull reads from the connection until buf is full. Timeouts of reads are not errors,
+// as no data is sent over a connection while the parties compute, unless the server is stopped.
+func (s *server) readFull(conn network.Connection, buf []byte) error {
+	for nRead := 0; nRead < len(buf); {
+		n, err := conn.Read(buf[nRead:])
+		nRead += n
+		if err != nil && (!isTimeout(err) || s.isStopped()) {
+			return err
+		}
 	}
+	return nil
+}
+
+// isTimeout checks whether the error is a timeout, like the errors of the net package
+func isTimeout(err error) bool {
+	tErr, ok := err.(interface{ Timeout() bool })
+	return ok && tErr.Timeout()
+}
+
+// isStopped checks whether the server has been stopped
+func (s *server) isStopped() bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.stopped
+}
 
-	return data, nil, nil
+// mergeSorted merges two sorted lists of pids
+func mergeSorted(a, b []uint16) []uint16 {
+	result := make([]uint16, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if a[0] < b[0] {
+			result, a = append(result, a[0]), a[1:]
+		} else {
+			result, b = append(result, b[0]), b[1:]
+		}
+	}
+	result = append(result, a...)
+	return append(result, b...)
 }
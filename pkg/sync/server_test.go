@@ -2,6 +2,7 @@ package sync_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	stdsync "sync"
@@ -19,26 +20,24 @@ import (
 var _ = Describe("Sync Server", func() {
 
 	var (
-		nProc     uint16
-		netservs  []network.Server
-		syncservs []sync.Server
-		allData   [][][]byte
-		errors    []error
-		wg        stdsync.WaitGroup
-		roundTime time.Duration
+		nProc        uint16
+		netservs     []network.Server
+		syncservs    []sync.Server
+		allData      [][][]byte
+		errors       []error
+		wg           stdsync.WaitGroup
+		roundTimeout time.Duration
 
 		toSend [][]byte
 		check  []func(uint16, []byte) error
-		start  time.Time
 	)
 
 	JustBeforeEach(func() {
 		wg = stdsync.WaitGroup{}
 		netservs = tests.NewNetwork(int(nProc), time.Millisecond*100)
 		syncservs = make([]sync.Server, int(nProc))
-		start = time.Now().Add(50 * time.Millisecond)
 		for i := uint16(0); i < nProc; i++ {
-			syncservs[i] = sync.NewServer(i, nProc, start, roundTime, netservs[i])
+			syncservs[i] = sync.NewServer(i, nProc, roundTimeout, netservs[i])
 			syncservs[i].Start()
 		}
 	})
@@ -61,7 +60,7 @@ var _ = Describe("Sync Server", func() {
 			alice = 0
 			bob = 1
 			nProc = 2
-			roundTime = 300 * time.Millisecond
+			roundTimeout = 300 * time.Millisecond
 			toSend = make([][]byte, nProc)
 			check = make([]func(uint16, []byte) error, nProc)
 			allData = make([][][]byte, nProc)
@@ -113,6 +112,379 @@ var _ = Describe("Sync Server", func() {
 					Expect(allData[alice]).To(Equal([][]byte{nil, bobData}))
 					Expect(allData[bob]).To(Equal([][]byte{aliceData, nil}))
 				})
+
+				It("Should finish when bob starts the round later than alice", func() {
+					wg.Add(int(nProc))
+					go func() {
+						defer wg.Done()
+						errors[alice] = syncservs[alice].Round([][]byte{toSend[alice]}, check[alice])
+					}()
+					go func() {
+						defer wg.Done()
+						time.Sleep(roundTimeout / 2)
+						errors[bob] = syncservs[bob].Round([][]byte{toSend[bob]}, check[bob])
+					}()
+					wg.Wait()
+
+					Expect(errors[alice]).NotTo(HaveOccurred())
+					Expect(errors[bob]).NotTo(HaveOccurred())
+				})
+
+				It("Should refuse a round of alice started while another one of the same session is running", func() {
+					second := make(chan error)
+					wg.Add(int(nProc))
+					go func() {
+						defer wg.Done()
+						errors[alice] = syncservs[alice].Round([][]byte{toSend[alice]}, check[alice])
+					}()
+					go func() {
+						defer wg.Done()
+						// bob starts late, so the first round of alice is still running
+						time.Sleep(roundTimeout / 2)
+						second <- syncservs[alice].Round([][]byte{toSend[alice]}, check[alice])
+						errors[bob] = syncservs[bob].Round([][]byte{toSend[bob]}, check[bob])
+					}()
+					Expect(<-second).To(MatchError(ContainSubstring("already running")))
+					wg.Wait()
+
+					Expect(errors[alice]).NotTo(HaveOccurred())
+					Expect(errors[bob]).NotTo(HaveOccurred())
+				})
+			})
+		})
+	})
+
+	Describe("Three parties", func() {
+
+		BeforeEach(func() {
+			nProc = 3
+			roundTimeout = 300 * time.Millisecond
+			toSend = make([][]byte, nProc)
+			check = make([]func(uint16, []byte) error, nProc)
+			allData = make([][][]byte, nProc)
+			errors = make([]error, nProc)
+		})
+
+		Describe("One round", func() {
+
+			Context("The third party is offline", func() {
+
+				BeforeEach(func() {
+					for i := uint16(0); i < nProc; i++ {
+						toSend[i] = []byte{byte(i)}
+						allData[i] = make([][]byte, nProc)
+					}
+					for i := uint16(0); i < nProc; i++ {
+						check[i] = func(id uint16) func(uint16, []byte) error {
+							return func(pid uint16, data []byte) error {
+								allData[id][pid] = data
+								return nil
+							}
+						}(i)
+					}
+				})
+
+				It("Should report it as unresponsive after the round timeout and deliver the data of the others", func() {
+					begin := time.Now()
+					wg.Add(2)
+					for i := uint16(0); i < 2; i++ {
+						go func(i uint16) {
+							defer wg.Done()
+							errors[i] = syncservs[i].Round([][]byte{toSend[i]}, check[i])
+						}(i)
+					}
+					wg.Wait()
+
+					Expect(time.Since(begin)).To(BeNumerically("<", 2*roundTimeout))
+					for i := uint16(0); i < 2; i++ {
+						Expect(errors[i]).To(HaveOccurred())
+						tErr, ok := errors[i].(*sync.TimeoutError)
+						Expect(ok).To(BeTrue())
+						Expect(tErr.Timeout()).To(BeTrue())
+						Expect(tErr.Unresponsive()).To(Equal([]uint16{2}))
+					}
+					Expect(allData[0]).To(Equal([][]byte{nil, toSend[1], nil}))
+					Expect(allData[1]).To(Equal([][]byte{toSend[0], nil, nil}))
+				})
+
+				It("Should fail as soon as the context is cancelled and report it as unresponsive", func() {
+					ctx, cancel := context.WithCancel(context.Background())
+					time.AfterFunc(roundTimeout/4, cancel)
+					begin := time.Now()
+					wg.Add(2)
+					for i := uint16(0); i < 2; i++ {
+						go func(i uint16) {
+							defer wg.Done()
+							errors[i] = syncservs[i].WithContext(ctx).Round([][]byte{toSend[i]}, check[i])
+						}(i)
+					}
+					wg.Wait()
+
+					Expect(time.Since(begin)).To(BeNumerically("<", roundTimeout/2))
+					for i := uint16(0); i < 2; i++ {
+						tErr, ok := errors[i].(*sync.TimeoutError)
+						Expect(ok).To(BeTrue())
+						Expect(tErr.Unresponsive()).To(Equal([]uint16{2}))
+						Expect(tErr.Error()).To(ContainSubstring(context.Canceled.Error()))
+					}
+					Expect(allData[0]).To(Equal([][]byte{nil, toSend[1], nil}))
+					Expect(allData[1]).To(Equal([][]byte{toSend[0], nil, nil}))
+				})
+
+				It("Should run later rounds of the session with no context after a cancelled one", func() {
+					ctx, cancel := context.WithCancel(context.Background())
+					cancel()
+					wg.Add(2)
+					for i := uint16(0); i < 2; i++ {
+						go func(i uint16) {
+							defer wg.Done()
+							errors[i] = syncservs[i].WithContext(ctx).Round([][]byte{toSend[i]}, check[i])
+						}(i)
+					}
+					wg.Wait()
+					for i := uint16(0); i < 2; i++ {
+						_, ok := errors[i].(*sync.TimeoutError)
+						Expect(ok).To(BeTrue())
+						Expect(syncservs[i].NextRoundID()).To(Equal(int64(1)))
+					}
+
+					quorum := make([]error, 2)
+					wg.Add(2)
+					for i := uint16(0); i < 2; i++ {
+						go func(i uint16) {
+							defer wg.Done()
+							_, quorum[i] = syncservs[i].QuorumRound([][]byte{toSend[i]}, check[i], 2)
+						}(i)
+					}
+					wg.Wait()
+					for i := uint16(0); i < 2; i++ {
+						Expect(quorum[i]).NotTo(HaveOccurred())
+					}
+				})
+			})
+
+			Context("The first party sends wrong data and the third party is offline", func() {
+
+				BeforeEach(func() {
+					for i := uint16(0); i < nProc; i++ {
+						toSend[i] = []byte{byte(i)}
+					}
+					check[0] = func(pid uint16, data []byte) error {
+						return nil
+					}
+					check[1] = func(pid uint16, data []byte) error {
+						return fmt.Errorf("wrong data from %v", pid)
+					}
+				})
+
+				It("Should report both of them", func() {
+					wg.Add(2)
+					for i := uint16(0); i < 2; i++ {
+						go func(i uint16) {
+							defer wg.Done()
+							errors[i] = syncservs[i].Round([][]byte{toSend[i]}, check[i])
+						}(i)
+					}
+					wg.Wait()
+
+					rErr, ok := errors[1].(*sync.RoundError)
+					Expect(ok).To(BeTrue())
+					Expect(rErr.Missing()).To(Equal([]uint16{0, 2}))
+				})
+			})
+		})
+
+		Describe("One quorum round", func() {
+
+			BeforeEach(func() {
+				for i := uint16(0); i < nProc; i++ {
+					toSend[i] = []byte{byte(i)}
+					check[i] = func(pid uint16, data []byte) error {
+						if !bytes.Equal(data, []byte{byte(pid)}) {
+							return fmt.Errorf("wrong data from %v", pid)
+						}
+						return nil
+					}
+				}
+			})
+
+			quorumRound := func(quorum uint16) [][]uint16 {
+				laggards := make([][]uint16, 2)
+				wg.Add(2)
+				for i := uint16(0); i < 2; i++ {
+					go func(i uint16) {
+						defer wg.Done()
+						laggards[i], errors[i] = syncservs[i].QuorumRound([][]byte{toSend[i]}, check[i], quorum)
+					}(i)
+				}
+				wg.Wait()
+				return laggards
+			}
+
+			Context("The third party is offline", func() {
+
+				It("Should finish without waiting for it and report it as a laggard", func() {
+					begin := time.Now()
+					laggards := quorumRound(2)
+
+					Expect(time.Since(begin)).To(BeNumerically("<", roundTimeout))
+					for i := uint16(0); i < 2; i++ {
+						Expect(errors[i]).NotTo(HaveOccurred())
+						Expect(laggards[i]).To(Equal([]uint16{2}))
+					}
+				})
+
+				It("Should report it as unresponsive if its data is needed", func() {
+					quorumRound(3)
+
+					for i := uint16(0); i < 2; i++ {
+						tErr, ok := errors[i].(*sync.TimeoutError)
+						Expect(ok).To(BeTrue())
+						Expect(tErr.Unresponsive()).To(Equal([]uint16{2}))
+					}
+				})
+			})
+
+			Context("The first party sends wrong data and the third party is offline", func() {
+
+				BeforeEach(func() {
+					toSend[0] = []byte{3}
+				})
+
+				It("Should report both of them if the quorum is not reached", func() {
+					quorumRound(2)
+
+					rErr, ok := errors[1].(*sync.RoundError)
+					Expect(ok).To(BeTrue())
+					Expect(rErr.Missing()).To(Equal([]uint16{0, 2}))
+				})
+			})
+		})
+
+		Describe("Rounds run ahead by one party", func() {
+
+			It("Should keep the data of a bounded number of rounds ahead and drop the rest", func() {
+				const nRounds = 70
+				ahead := syncservs[0].Session(7)
+				for r := 0; r < nRounds; r++ {
+					_, err := ahead.QuorumRound([][]byte{{byte(r)}}, nil, 1)
+					Expect(err).NotTo(HaveOccurred())
+				}
+				time.Sleep(100 * time.Millisecond)
+
+				behind := syncservs[1].Session(7)
+				r := 0
+				var err error
+				for ; r < nRounds && err == nil; r++ {
+					_, err = behind.QuorumRound([][]byte{{byte(r)}}, func(pid uint16, data []byte) error {
+						if pid != 0 {
+							return fmt.Errorf("unexpected data from %v", pid)
+						}
+						if !bytes.Equal(data, []byte{byte(r)}) {
+							return fmt.Errorf("received wrong bytes %v from %v", data, pid)
+						}
+						return nil
+					}, 2)
+				}
+				tErr, ok := err.(*sync.TimeoutError)
+				Expect(ok).To(BeTrue())
+				Expect(tErr.Unresponsive()).To(ContainElement(uint16(0)))
+				Expect(r).To(BeNumerically(">", 60))
+				Expect(r).To(BeNumerically("<", nRounds))
+			})
+		})
+
+		Describe("Sessions not run by one party", func() {
+
+			It("Should keep the data of a bounded number of them and of the sessions it runs", func() {
+				const nSessions = 100
+				running := syncservs[1].Session(7)
+				for sid := uint64(100); sid < 100+nSessions; sid++ {
+					_, err := syncservs[0].Session(sid).QuorumRound([][]byte{{byte(sid)}}, nil, 1)
+					Expect(err).NotTo(HaveOccurred())
+				}
+				time.Sleep(100 * time.Millisecond)
+
+				receive := func(session sync.Server, b byte) error {
+					_, err := session.QuorumRound([][]byte{{b}}, func(pid uint16, data []byte) error {
+						if pid != 0 {
+							return fmt.Errorf("unexpected data from %v", pid)
+						}
+						if !bytes.Equal(data, []byte{b}) {
+							return fmt.Errorf("received wrong bytes %v from %v", data, pid)
+						}
+						return nil
+					}, 2)
+					return err
+				}
+				Expect(receive(syncservs[1].Session(100), 100)).NotTo(HaveOccurred())
+				_, ok := receive(syncservs[1].Session(100+nSessions-1), 100+nSessions-1).(*sync.TimeoutError)
+				Expect(ok).To(BeTrue())
+
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, errors[0] = syncservs[0].Session(7).QuorumRound([][]byte{{7}}, nil, 1)
+				}()
+				Expect(receive(running, 7)).NotTo(HaveOccurred())
+				wg.Wait()
+				Expect(errors[0]).NotTo(HaveOccurred())
+			})
+		})
+
+		Describe("A closed session", func() {
+
+			It("Should refuse to run rounds and ignore the data sent for it", func() {
+				session := syncservs[1].Session(7)
+				_, err := syncservs[0].Session(7).QuorumRound([][]byte{{7}}, nil, 1)
+				Expect(err).NotTo(HaveOccurred())
+				time.Sleep(100 * time.Millisecond)
+
+				session.Stop()
+				_, err = session.QuorumRound([][]byte{{7}}, nil, 1)
+				Expect(err).To(HaveOccurred())
+				Expect(syncservs[1].Session(7).Round([][]byte{{7}}, nil)).To(HaveOccurred())
+				_, err = syncservs[0].Session(7).QuorumRound([][]byte{{7}}, nil, 1)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		Describe("Two sessions", func() {
+
+			It("Should deliver the data of every round to its session", func() {
+				const nRounds = 3
+				errs := make([]error, 2*nProc)
+				nextRounds := make([]int64, 2*nProc)
+				wg.Add(2 * int(nProc))
+				for i := uint16(0); i < nProc; i++ {
+					for sid := uint64(1); sid <= 2; sid++ {
+						go func(i uint16, sid uint64) {
+							defer wg.Done()
+							k := 2*int(i) + int(sid) - 1
+							session := syncservs[i].Session(sid)
+							for r := 0; r < nRounds; r++ {
+								errs[k] = session.Round([][]byte{{byte(sid), byte(r), byte(i)}}, func(pid uint16, data []byte) error {
+									if !bytes.Equal(data, []byte{byte(sid), byte(r), byte(pid)}) {
+										return fmt.Errorf("received wrong bytes %v from %v", data, pid)
+									}
+									return nil
+								})
+								if errs[k] != nil {
+									return
+								}
+							}
+							nextRounds[k] = session.NextRoundID()
+						}(i, sid)
+					}
+				}
+				wg.Wait()
+
+				for k := range errs {
+					Expect(errs[k]).NotTo(HaveOccurred())
+					Expect(nextRounds[k]).To(Equal(int64(nRounds)))
+				}
+				Expect(syncservs[0].NextRoundID()).To(Equal(int64(0)))
+				Expect(syncservs[0].Session(1).SessionID()).To(Equal(uint64(1)))
 			})
 		})
 	})
@@ -121,7 +493,7 @@ var _ = Describe("Sync Server", func() {
 
 		BeforeEach(func() {
 			nProc = 10
-			roundTime = 300 * time.Millisecond
+			roundTimeout = 300 * time.Millisecond
 			toSend = make([][]byte, nProc)
 			check = make([]func(uint16, []byte) error, nProc)
 			allData = make([][][]byte, nProc)
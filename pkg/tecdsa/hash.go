@@ -0,0 +1,30 @@
+package tecdsa
+
+import (
+	"crypto/sha256"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Hash computes a digest of a message
+type Hash func(message []byte) []byte
+
+var (
+	// SHA256 is the hash function used by the standard ECDSA over secp256k1
+	SHA256 Hash = func(message []byte) []byte {
+		digest := sha256.Sum256(message)
+		return digest[:]
+	}
+	// Keccak256 is the hash function used by Ethereum
+	Keccak256 Hash = func(message []byte) []byte {
+		h := sha3.NewLegacyKeccak256()
+		h.Write(message)
+		return h.Sum(nil)
+	}
+	// DoubleSHA256 is the hash function used by Bitcoin
+	DoubleSHA256 Hash = func(message []byte) []byte {
+		digest := sha256.Sum256(message)
+		digest = sha256.Sum256(digest[:])
+		return digest[:]
+	}
+)
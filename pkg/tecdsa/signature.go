@@ -0,0 +1,164 @@
+package tecdsa
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/curve"
+)
+
+const (
+	// CompactSignatureLen is the length of a signature encoded as r||s
+	CompactSignatureLen = 64
+	// RecoverableSignatureLen is the length of a signature encoded as r||s||v
+	RecoverableSignatureLen = 65
+)
+
+// Signature implements a complete signature
+type Signature struct {
+	r, s *big.Int
+	v    byte
+}
+
+// R returns the r component of the signature
+func (sig *Signature) R() *big.Int {
+	return new(big.Int).Set(sig.r)
+}
+
+// S returns the s component of the signature
+func (sig *Signature) S() *big.Int {
+	return new(big.Int).Set(sig.s)
+}
+
+// V returns the recovery id of the signature, i.e. the parity of y(R) plus 2 if x(R) is not smaller than the group order
+func (sig *Signature) V() byte {
+	return sig.v
+}
+
+// Verify checks if the signature is a valid ECDSA signature of the digest under the public key pub.
+// As in the standard ECDSA, both s and -s are accepted.
+func (sig *Signature) Verify(pub curve.Point, digest []byte) error {
+	group := curve.NewSecp256k1Group()
+	order := group.Order()
+	if err := checkRange(sig.r, sig.s, order); err != nil {
+		return err
+	}
+
+	w := new(big.Int).ModInverse(sig.s, order)
+	u1 := hashToInt(digest, order)
+	u1.Mul(u1, w)
+	u1.Mod(u1, order)
+	u2 := w.Mul(sig.r, w)
+	u2.Mod(u2, order)
+
+	x, _ := group.Coordinates(group.Add(group.ScalarBaseMult(u1), group.ScalarMult(pub, u2)))
+	if x == nil {
+		return fmt.Errorf("verification failed: neutral element")
+	}
+	if x.Mod(x, order).Cmp(sig.r) != 0 {
+		return fmt.Errorf("verification failed")
+	}
+
+	return nil
+}
+
+type derSignature struct {
+	R, S *big.Int
+}
+
+// EncodeDER encodes the signature as an ASN.1 DER sequence of r and s
+func (sig *Signature) EncodeDER() ([]byte, error) {
+	return asn1.Marshal(derSignature{sig.r, sig.s})
+}
+
+// DecodeDER decodes the signature from an ASN.1 DER sequence of r and s. The recovery id is set to 0.
+func (sig *Signature) DecodeDER(data []byte) error {
+	var der derSignature
+	rest, err := asn1.Unmarshal(data, &der)
+	if err != nil {
+		return fmt.Errorf("decoding DER signature: %v", err)
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("decoding DER signature: %d trailing bytes", len(rest))
+	}
+	if err := checkRange(der.R, der.S, curve.NewSecp256k1Group().Order()); err != nil {
+		return err
+	}
+	sig.r, sig.s, sig.v = der.R, der.S, 0
+
+	return nil
+}
+
+// EncodeCompact encodes the signature as 32 bytes of r followed by 32 bytes of s
+func (sig *Signature) EncodeCompact() []byte {
+	data := make([]byte, CompactSignatureLen)
+	rBytes, sBytes := sig.r.Bytes(), sig.s.Bytes()
+	copy(data[32-len(rBytes):32], rBytes)
+	copy(data[64-len(sBytes):64], sBytes)
+
+	return data
+}
+
+// DecodeCompact decodes the signature from 32 bytes of r followed by 32 bytes of s. The recovery id is set to 0.
+func (sig *Signature) DecodeCompact(data []byte) error {
+	if len(data) != CompactSignatureLen {
+		return fmt.Errorf("wrong length of a compact signature: expected %d, got %d", CompactSignatureLen, len(data))
+	}
+	r := new(big.Int).SetBytes(data[:32])
+	s := new(big.Int).SetBytes(data[32:])
+	if err := checkRange(r, s, curve.NewSecp256k1Group().Order()); err != nil {
+		return err
+	}
+	sig.r, sig.s, sig.v = r, s, 0
+
+	return nil
+}
+
+// EncodeRecoverable encodes the signature as r||s||v, the format accepted by go-ethereum's Ecrecover
+func (sig *Signature) EncodeRecoverable() []byte {
+	return append(sig.EncodeCompact(), sig.v)
+}
+
+// DecodeRecoverable decodes the signature from r||s||v, where v is a recovery id between 0 and 3
+func (sig *Signature) DecodeRecoverable(data []byte) error {
+	if len(data) != RecoverableSignatureLen {
+		return fmt.Errorf("wrong length of a recoverable signature: expected %d, got %d", RecoverableSignatureLen, len(data))
+	}
+	v := data[CompactSignatureLen]
+	if v > 3 {
+		return fmt.Errorf("wrong recovery id %d", v)
+	}
+	if err := sig.DecodeCompact(data[:CompactSignatureLen]); err != nil {
+		return err
+	}
+	sig.v = v
+
+	return nil
+}
+
+func checkRange(r, s, order *big.Int) error {
+	if r.Sign() <= 0 || r.Cmp(order) >= 0 {
+		return fmt.Errorf("r is out of range")
+	}
+	if s.Sign() <= 0 || s.Cmp(order) >= 0 {
+		return fmt.Errorf("s is out of range")
+	}
+	return nil
+}
+
+// hashToInt converts a digest to an integer as in SEC1, i.e. it takes the leftmost bits of the digest up to the bit length of the order
+func hashToInt(digest []byte, order *big.Int) *big.Int {
+	orderBits := order.BitLen()
+	orderBytes := (orderBits + 7) / 8
+	if len(digest) > orderBytes {
+		digest = digest[:orderBytes]
+	}
+
+	z := new(big.Int).SetBytes(digest)
+	if excess := len(digest)*8 - orderBits; excess > 0 {
+		z.Rsh(z, uint(excess))
+	}
+
+	return z
+}
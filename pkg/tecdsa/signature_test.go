@@ -0,0 +1,132 @@
+package tecdsa_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/curve"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/tecdsa"
+
+	"github.com/ethereum/go-ethereum/crypto/secp256k1"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Signature Test", func() {
+
+	var (
+		group  curve.Group
+		pub    curve.Point
+		digest []byte
+		sig    *tecdsa.Signature
+	)
+
+	BeforeEach(func() {
+		group = curve.NewSecp256k1Group()
+		d, err := rand.Int(rand.Reader, group.Order())
+		Expect(err).NotTo(HaveOccurred())
+		pub = group.ScalarBaseMult(d)
+		x, y := group.Coordinates(pub)
+		priv := &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: secp256k1.S256(), X: x, Y: y}, D: d}
+
+		hash := sha256.Sum256([]byte("message"))
+		digest = hash[:]
+		r, s, err := ecdsa.Sign(rand.Reader, priv, digest)
+		Expect(err).NotTo(HaveOccurred())
+
+		compact := make([]byte, tecdsa.CompactSignatureLen)
+		copy(compact[32-len(r.Bytes()):32], r.Bytes())
+		copy(compact[64-len(s.Bytes()):], s.Bytes())
+		sig = &tecdsa.Signature{}
+		Expect(sig.DecodeCompact(compact)).To(Succeed())
+	})
+
+	Describe("Verification", func() {
+
+		It("Should accept a correct signature", func() {
+			Expect(sig.Verify(pub, digest)).To(Succeed())
+		})
+
+		It("Should reject a signature of another digest", func() {
+			other := sha256.Sum256([]byte("other message"))
+			Expect(sig.Verify(pub, other[:])).NotTo(Succeed())
+		})
+
+		It("Should reject a signature under another key", func() {
+			Expect(sig.Verify(group.Add(pub, group.Gen()), digest)).NotTo(Succeed())
+		})
+	})
+
+	Describe("Encodings", func() {
+
+		It("Should round-trip through DER", func() {
+			data, err := sig.EncodeDER()
+			Expect(err).NotTo(HaveOccurred())
+			decoded := &tecdsa.Signature{}
+			Expect(decoded.DecodeDER(data)).To(Succeed())
+			Expect(decoded.R()).To(Equal(sig.R()))
+			Expect(decoded.S()).To(Equal(sig.S()))
+			Expect(decoded.Verify(pub, digest)).To(Succeed())
+		})
+
+		It("Should round-trip through the compact encoding", func() {
+			decoded := &tecdsa.Signature{}
+			Expect(decoded.DecodeCompact(sig.EncodeCompact())).To(Succeed())
+			Expect(decoded.R()).To(Equal(sig.R()))
+			Expect(decoded.S()).To(Equal(sig.S()))
+		})
+
+		It("Should round-trip through the recoverable encoding", func() {
+			data := sig.EncodeRecoverable()
+			Expect(data).To(HaveLen(tecdsa.RecoverableSignatureLen))
+			data[tecdsa.CompactSignatureLen] = 1
+			decoded := &tecdsa.Signature{}
+			Expect(decoded.DecodeRecoverable(data)).To(Succeed())
+			Expect(decoded.R()).To(Equal(sig.R()))
+			Expect(decoded.S()).To(Equal(sig.S()))
+			Expect(decoded.V()).To(Equal(byte(1)))
+			Expect(decoded.EncodeRecoverable()).To(Equal(data))
+		})
+
+		It("Should reject malformed DER", func() {
+			data, err := sig.EncodeDER()
+			Expect(err).NotTo(HaveOccurred())
+			decoded := &tecdsa.Signature{}
+			Expect(decoded.DecodeDER(append(data, 0))).NotTo(Succeed())
+			Expect(decoded.DecodeDER(data[:len(data)-1])).NotTo(Succeed())
+			Expect(decoded.DecodeDER(nil)).NotTo(Succeed())
+			data[0] = 0x31
+			Expect(decoded.DecodeDER(data)).NotTo(Succeed())
+		})
+
+		It("Should reject DER with values out of range", func() {
+			decoded := &tecdsa.Signature{}
+			zero := []byte{0x30, 0x06, 0x02, 0x01, 0x00, 0x02, 0x01, 0x01}
+			Expect(decoded.DecodeDER(zero)).NotTo(Succeed())
+			negative := []byte{0x30, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0xff}
+			Expect(decoded.DecodeDER(negative)).NotTo(Succeed())
+		})
+
+		It("Should reject malformed compact encodings", func() {
+			decoded := &tecdsa.Signature{}
+			data := sig.EncodeCompact()
+			Expect(decoded.DecodeCompact(data[:63])).NotTo(Succeed())
+			Expect(decoded.DecodeCompact(append(data, 0))).NotTo(Succeed())
+			Expect(decoded.DecodeCompact(make([]byte, tecdsa.CompactSignatureLen))).NotTo(Succeed())
+
+			order := group.Order().Bytes()
+			copy(data[32:], order)
+			Expect(decoded.DecodeCompact(data)).NotTo(Succeed())
+		})
+
+		It("Should reject malformed recoverable encodings", func() {
+			decoded := &tecdsa.Signature{}
+			data := sig.EncodeRecoverable()
+			Expect(decoded.DecodeRecoverable(data[:64])).NotTo(Succeed())
+			data[tecdsa.CompactSignatureLen] = 4
+			Expect(decoded.DecodeRecoverable(data)).NotTo(Succeed())
+		})
+	})
+})
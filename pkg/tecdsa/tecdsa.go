@@ -1,124 +1,223 @@
 package tecdsa
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"math/big"
+	stdsync "sync"
+
+	"github.com/binance-chain/tss-lib/crypto/paillier"
 
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/arith"
-	crypto "gitlab.com/alephledger/threshold-ecdsa/pkg/crypto"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/crypto/commitment"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/curve"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/sync"
 )
 
-// Signature implements a complete signature
-type Signature struct {
-	r, s *big.Int
-}
-
 type presig struct {
-	k, rho, eta, tau *arith.TDSecret
-	t                uint16
+	k, kInv, eta *arith.TDSecret
 }
 
 // Protocol implements the tECDSA protocol
 type Protocol struct {
-	pid, nProc uint16
-	key, egKey *arith.DKey
-	egf        *commitment.ElGamalFactory
-	presig     []*presig
-	network    sync.Server
-	group      curve.Group
+	pid, nProc, t uint16
+	x             *arith.TDSecret
+	key, egKey    *arith.TDKey
+	egf           *commitment.ElGamalFactory
+	network       sync.Server
+	group         curve.Group
+	mta           arith.MtA
+	// presigs keeps the presignatures by the ids of the sessions in which they were generated, guarded by mx
+	presigs map[uint64]*presig
+	mx      stdsync.Mutex
+}
+
+// Backend sets up the MtA backend used in multiplications during presigning
+type Backend func(pid, nProc uint16, network sync.Server, group curve.Group) (arith.MtA, error)
+
+// PaillierBackend returns the Backend based on Paillier encryption with the given keys of all parties.
+// Paillier keys of other parties take part in multiplications, so it refuses to proceed unless they are well formed.
+func PaillierBackend(priv *paillier.PrivateKey, pubs []*paillier.PublicKey) Backend {
+	return func(pid, nProc uint16, network sync.Server, _ curve.Group) (arith.MtA, error) {
+		rps, err := arith.SetupPaillier(pid, nProc, network, priv, pubs)
+		if err != nil {
+			return nil, err
+		}
+		return arith.NewPaillierMtA(pid, nProc, priv, pubs, rps), nil
+	}
+}
+
+// OTBackend is the Backend based on oblivious transfer extension
+func OTBackend(pid, nProc uint16, network sync.Server, group curve.Group) (arith.MtA, error) {
+	return arith.NewOTMtA(pid, nProc, network, group)
 }
 
 // Init constructs a new instance of tECDSA protocol and
-// generates a private key for signing and a secret for commitments
-func Init(pid, nProc uint16, network sync.Server) (*Protocol, error) {
-	p := &Protocol{pid: pid, nProc: nProc, network: network}
+// generates a secret for commitments and a private key for signing, both shared with threshold t.
+// Multiplications are run with the MtA set up by backend.
+func Init(pid, nProc, t uint16, network sync.Server, backend Backend) (*Protocol, error) {
+	return InitContext(context.Background(), pid, nProc, t, network, backend)
+}
+
+// InitContext runs Init, which fails with a sync.TimeoutError naming the unresponsive parties as soon as ctx is done
+func InitContext(ctx context.Context, pid, nProc, t uint16, network sync.Server, backend Backend) (*Protocol, error) {
+	p := &Protocol{pid: pid, nProc: nProc, t: t, network: network, presigs: map[uint64]*presig{}}
+	all := make([]uint16, nProc)
+	for i := range all {
+		all[i] = uint16(i)
+	}
+	server := network.WithContext(ctx)
 
-	var err error
 	p.group = curve.NewSecp256k1Group()
-	p.key, err = arith.GenExpReveal(pid, "x", p.network, p.nProc, p.group)
+	// the key for commitments is a threshold key, so that a quorum of parties can check products without the others.
+	// Its secret is generated with commitments under an auxiliary key.
+	auxKey, err := arith.GenExpReveal(pid, "aux", server, p.nProc, p.group)
 	if err != nil {
 		return nil, err
 	}
-	p.egKey, err = arith.GenExpReveal(pid, "h", p.network, p.nProc, p.group)
+	h, err := arith.GenThreshold("h", server, commitment.NewElGamalFactory(auxKey.PublicKey()), pid, nProc, t, all)
 	if err != nil {
 		return nil, err
 	}
-	p.egf = commitment.NewElGamalFactory(p.key.PublicKey())
+	if p.egKey, err = h.Exp(); err != nil {
+		return nil, err
+	}
+	p.egf = commitment.NewElGamalFactory(p.egKey.PublicKey())
 
-	return p, nil
-}
+	if p.mta, err = backend(pid, nProc, server, p.group); err != nil {
+		return nil, err
+	}
 
-// Presign generates a new presignature
-func (p *Protocol) Presign(t uint16) error {
-	var err error
-	var k, rho, eta, tau *arith.ADSecret
-	if k, err = arith.Gen("k", p.network, p.egf, p.pid, p.nProc); err != nil {
-		return err
+	// the private key has to be committed to, as it takes part in multiplications during presigning
+	if p.x, err = arith.GenThreshold("x", server, p.egf, pid, nProc, t, all); err != nil {
+		return nil, err
 	}
-	if rho, err = arith.Gen("rho", p.network, p.egf, p.pid, p.nProc); err != nil {
-		return err
+	if p.key, err = p.x.Exp(); err != nil {
+		return nil, err
 	}
-	if eta, err = arith.Gen("eta", p.network, p.egf, p.pid, p.nProc); err != nil {
-		return err
+
+	return p, nil
+}
+
+// PublicKey returns the public key under which the signatures are verified
+func (p *Protocol) PublicKey() curve.Point {
+	return p.key.PublicKey()
+}
+
+// Presign generates a new presignature with the parties in the quorum, at least t of them.
+// The parties outside the quorum do not take part. The rounds are run in the session with id sid,
+// so presignatures with different nonzero sids may be generated concurrently. The session 0 is used by Init.
+func (p *Protocol) Presign(sid uint64, quorum []uint16) error {
+	return p.PresignContext(context.Background(), sid, quorum)
+}
+
+// PresignContext runs Presign, which fails with a sync.TimeoutError naming the unresponsive parties as soon as ctx is done.
+// The session is closed after a failure and may not be used again, as the parties may disagree on the rounds it has run.
+func (p *Protocol) PresignContext(ctx context.Context, sid uint64, quorum []uint16) (err error) {
+	if sid == 0 {
+		return fmt.Errorf("the session 0 is reserved for initialization")
 	}
-	if tau, err = arith.Gen("tau", p.network, p.egf, p.pid, p.nProc); err != nil {
-		return err
+	p.mx.Lock()
+	_, ok := p.presigs[sid]
+	p.mx.Unlock()
+	if ok {
+		return fmt.Errorf("there already is a presignature for the session %v", sid)
 	}
 
-	psgn := &presig{t: t}
-	if psgn.k, err = k.Reshare(t); err != nil {
-		return err
-	}
-	if psgn.rho, err = rho.Reshare(t); err != nil {
+	psgn := &presig{}
+	network := p.network.Session(sid).WithContext(ctx)
+	defer func() {
+		if err != nil {
+			network.Stop()
+		}
+	}()
+	if psgn.k, err = arith.GenThreshold("k", network, p.egf, p.pid, p.nProc, p.t, quorum); err != nil {
 		return err
 	}
-	if psgn.eta, err = eta.Reshare(t); err != nil {
+	if psgn.kInv, err = psgn.k.Inverse("kInv", p.egKey, p.mta, quorum); err != nil {
 		return err
 	}
-	if psgn.tau, err = tau.Reshare(t); err != nil {
+	if psgn.eta, err = arith.TMult(psgn.kInv, p.x, "eta", p.egKey, p.mta, quorum); err != nil {
 		return err
 	}
 
-	p.presig = append(p.presig, psgn)
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	p.presigs[sid] = psgn
 	return nil
 }
 
-// Sign generates a signature using a presignature prepared before
-func (p *Protocol) Sign(message *big.Int) (*Signature, error) {
-	// TODO: if the amount of presignatures falls below some threshold, use p.Presign to generate new ones
-	if len(p.presig) == 0 {
-		return nil, fmt.Errorf("There are no more presignatures to sign the message %v", message)
+// SignMessage generates a signature of the digest of the message computed with the given hash function
+func (p *Protocol) SignMessage(sid uint64, message []byte, hash Hash) (*Signature, error) {
+	return p.SignDigest(sid, hash(message))
+}
+
+// SignMessageContext runs SignMessage, which fails with a sync.TimeoutError naming the unresponsive parties as soon as ctx is done
+func (p *Protocol) SignMessageContext(ctx context.Context, sid uint64, message []byte, hash Hash) (*Signature, error) {
+	return p.SignDigestContext(ctx, sid, hash(message))
+}
+
+// SignDigest generates a signature of the digest using the presignature generated in the session with id sid.
+// The rounds are run in the same session, after the ones of presigning, and the presignature is used up.
+// As in SEC1, only the leftmost bits of the digest up to the bit length of the group order are used.
+func (p *Protocol) SignDigest(sid uint64, digest []byte) (*Signature, error) {
+	return p.SignDigestContext(context.Background(), sid, digest)
+}
+
+// SignDigestContext runs SignDigest, which fails with a sync.TimeoutError naming the unresponsive parties as soon as ctx is done.
+// The presignature is used up and its session closed even if signing fails.
+func (p *Protocol) SignDigestContext(ctx context.Context, sid uint64, digest []byte) (*Signature, error) {
+	p.mx.Lock()
+	ps, ok := p.presigs[sid]
+	delete(p.presigs, sid)
+	p.mx.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("There is no presignature for the session %v to sign the digest %x", sid, digest)
 	}
+	defer p.network.Session(sid).Stop()
 
-	ps := p.presig[0]
-	p.presig = p.presig[1:]
+	order := p.group.Order()
+	message := hashToInt(digest, order)
+	message.Mod(message, order)
 
-	kKey, err := ps.k.Exp()
+	kKey, err := ps.k.WithContext(ctx).Exp()
 	if err != nil {
 		return nil, err
 	}
 
-	w := &bytes.Buffer{}
-	if err := p.group.Encode(kKey.PublicKey(), w); err != nil {
-		return nil, err
+	rx, ry := p.group.Coordinates(kKey.PublicKey())
+	if rx == nil {
+		return nil, fmt.Errorf("The presignature yields a neutral element")
+	}
+	r := new(big.Int).Mod(rx, order)
+	if r.Sign() == 0 {
+		return nil, fmt.Errorf("The presignature yields r equal to 0")
+	}
+	v := byte(ry.Bit(0))
+	if rx.Cmp(order) >= 0 {
+		v |= 2
 	}
-	r := crypto.HashToBigInt(w.Bytes())
-	tau, err := ps.tau.Reveal()
+
+	// eta = x/k, hence s = m/k + r*eta = (m + r*x)/k
+	sTDSecret, err := arith.Lin([]*big.Int{message, r}, []*arith.TDSecret{ps.kInv.WithContext(ctx), ps.eta}, "s")
 	if err != nil {
 		return nil, err
 	}
 
-	alpha, beta := new(big.Int).Div(message, tau), r.Div(r, tau)
-	sTDSecret := arith.Lin(alpha, beta, ps.rho, ps.eta, "s")
-
 	s, err := sTDSecret.Reveal()
 	if err != nil {
 		return nil, err
 	}
+	if s.Sign() == 0 {
+		return nil, fmt.Errorf("The presignature yields s equal to 0")
+	}
+
+	// (r, s) and (r, -s) are both valid, we pick the one with s in the lower half as required by Bitcoin and Ethereum.
+	// Negating s corresponds to negating R, which flips the parity of y(R).
+	if s.Cmp(new(big.Int).Rsh(order, 1)) > 0 {
+		s.Sub(order, s)
+		v ^= 1
+	}
 
-	return &Signature{r, s}, nil
+	return &Signature{r, s, v}, nil
 }
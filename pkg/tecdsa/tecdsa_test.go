@@ -1,14 +1,23 @@
 package tecdsa_test
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha512"
 	"math/big"
 	"math/rand"
 	stdsync "sync"
 	"time"
 
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/arith"
+	"gitlab.com/alephledger/threshold-ecdsa/pkg/curve"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/sync"
 	"gitlab.com/alephledger/threshold-ecdsa/pkg/tecdsa"
 
+	"github.com/binance-chain/tss-lib/crypto/paillier"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/secp256k1"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -19,23 +28,41 @@ import (
 var _ = Describe("TECDSA Test", func() {
 
 	var (
-		nProc     uint16
-		protos    []*tecdsa.Protocol
-		netservs  []network.Server
-		syncservs []sync.Server
-		roundTime time.Duration
-		start     time.Time
-		wg        stdsync.WaitGroup
-		errors    []error
+		nProc        uint16
+		t            uint16
+		protos       []*tecdsa.Protocol
+		netservs     []network.Server
+		syncservs    []sync.Server
+		roundTimeout time.Duration
+		wg           stdsync.WaitGroup
+		errors       []error
+		privs        []*paillier.PrivateKey
+		pubs         []*paillier.PublicKey
 	)
 
 	JustBeforeEach(func() {
 		wg = stdsync.WaitGroup{}
+		errors = make([]error, nProc)
+		privs = make([]*paillier.PrivateKey, nProc)
+		pubs = make([]*paillier.PublicKey, nProc)
+		bitLen := arith.PaillierMinBits
+		timeout := 30 * time.Second
+		wg.Add(int(nProc))
+		for i := uint16(0); i < nProc; i++ {
+			go func(i uint16) {
+				defer wg.Done()
+				privs[i], pubs[i], errors[i] = paillier.GenerateKeyPair(bitLen, timeout)
+			}(i)
+		}
+		wg.Wait()
+		for i := uint16(0); i < nProc; i++ {
+			Expect(errors[i]).NotTo(HaveOccurred())
+		}
+
 		netservs = tests.NewNetwork(int(nProc), time.Millisecond*100)
 		syncservs = make([]sync.Server, nProc)
-		start = time.Now().Add(50 * time.Millisecond)
 		for i := uint16(0); i < nProc; i++ {
-			syncservs[i] = sync.NewServer(i, nProc, start, roundTime, netservs[i])
+			syncservs[i] = sync.NewServer(i, nProc, roundTimeout, netservs[i])
 			syncservs[i].Start()
 		}
 		protos = make([]*tecdsa.Protocol, nProc)
@@ -43,7 +70,7 @@ var _ = Describe("TECDSA Test", func() {
 	})
 
 	BeforeEach(func() {
-		roundTime = 50 * time.Millisecond
+		roundTimeout = 2 * time.Second
 		rand.Seed(1729)
 	})
 
@@ -54,12 +81,12 @@ var _ = Describe("TECDSA Test", func() {
 		tests.CloseNetwork(netservs)
 	})
 
-	init := func() {
+	initWith := func(backend func(uint16) tecdsa.Backend) {
 		wg.Add(int(nProc))
 		for i := uint16(0); i < nProc; i++ {
 			go func(i uint16) {
 				defer wg.Done()
-				protos[i], errors[i] = tecdsa.Init(i, nProc, syncservs[i])
+				protos[i], errors[i] = tecdsa.Init(i, nProc, t, syncservs[i], backend(i))
 			}(i)
 		}
 
@@ -71,12 +98,21 @@ var _ = Describe("TECDSA Test", func() {
 		}
 	}
 
+	init := func() {
+		initWith(func(i uint16) tecdsa.Backend { return tecdsa.PaillierBackend(privs[i], pubs) })
+	}
+
+	initOT := func() {
+		initWith(func(uint16) tecdsa.Backend { return tecdsa.OTBackend })
+	}
+
 	Describe("Initialization", func() {
 
 		Context("Two parties", func() {
 
 			BeforeEach(func() {
 				nProc = 2
+				t = 2
 			})
 
 			Context("Alice and Bob are honest and alive", func() {
@@ -84,57 +120,128 @@ var _ = Describe("TECDSA Test", func() {
 				It("Should init the protocol successfully", func() {
 					init()
 				})
+
+				It("Should init the protocol with the OT backend successfully", func() {
+					initOT()
+				})
 			})
 		})
 	})
 
 	Describe("Signing", func() {
 		var (
-			t     uint16
-			msg   *big.Int
+			msg   []byte
+			hash  tecdsa.Hash
 			signs []*tecdsa.Signature
+			sid   uint64
 		)
 
-		presig := func() {
-			wg.Add(int(nProc))
-			for i := uint16(0); i < nProc; i++ {
+		BeforeEach(func() {
+			sid = 0
+		})
+
+		newMsg := func() []byte {
+			msg := make([]byte, 32)
+			rand.Read(msg)
+			return msg
+		}
+
+		all := func() []uint16 {
+			quorum := make([]uint16, nProc)
+			for i := range quorum {
+				quorum[i] = uint16(i)
+			}
+			return quorum
+		}
+
+		presigWith := func(quorum []uint16) {
+			sid++
+			wg.Add(len(quorum))
+			for _, i := range quorum {
 				go func(i uint16) {
 					defer wg.Done()
-					errors[i] = protos[i].Presign(t)
+					errors[i] = protos[i].Presign(sid, quorum)
 				}(i)
 			}
 
 			wg.Wait()
 
-			for i := uint16(0); i < nProc; i++ {
+			for _, i := range quorum {
 				Expect(errors[i]).NotTo(HaveOccurred())
 			}
 		}
 
-		sign := func() {
-			wg.Add(int(nProc))
-			for i := uint16(0); i < nProc; i++ {
+		presig := func() {
+			presigWith(all())
+		}
+
+		signWith := func(quorum []uint16) {
+			wg.Add(len(quorum))
+			for _, i := range quorum {
 				go func(i uint16) {
 					defer wg.Done()
-					signs[i], errors[i] = protos[i].Sign(msg)
+					signs[i], errors[i] = protos[i].SignMessage(sid, msg, hash)
 				}(i)
 			}
 			wg.Wait()
 
-			for i := uint16(0); i < nProc; i++ {
+			for _, i := range quorum {
 				Expect(errors[i]).NotTo(HaveOccurred())
 				Expect(signs[i]).NotTo(BeNil())
 			}
 
 		}
 
+		sign := func() {
+			signWith(all())
+		}
+
+		verifyWith := func(quorum []uint16) {
+			group := curve.NewSecp256k1Group()
+			digest := hash(msg)
+			for _, i := range quorum {
+				x, y := group.Coordinates(protos[i].PublicKey())
+				pk := &ecdsa.PublicKey{Curve: secp256k1.S256(), X: x, Y: y}
+				Expect(ecdsa.Verify(pk, digest, signs[i].R(), signs[i].S())).To(BeTrue())
+				Expect(signs[i].Verify(protos[i].PublicKey(), digest)).To(Succeed())
+			}
+		}
+
+		verify := func() {
+			verifyWith(all())
+		}
+
+		verifyEth := func() {
+			group := curve.NewSecp256k1Group()
+			halfOrder := new(big.Int).Rsh(group.Order(), 1)
+			digest := hash(msg)
+			for i := uint16(0); i < nProc; i++ {
+				Expect(signs[i].S().Cmp(halfOrder)).NotTo(Equal(1))
+
+				sig := signs[i].EncodeRecoverable()
+
+				x, y := group.Coordinates(protos[i].PublicKey())
+				pk := secp256k1.S256().Marshal(x, y)
+				Expect(secp256k1.VerifySignature(pk, digest, sig[:64])).To(BeTrue())
+
+				recovered, err := ethcrypto.Ecrecover(digest, sig)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(recovered).To(Equal(pk))
+			}
+		}
+
 		Context("Two parties", func() {
 
+			BeforeEach(func() {
+				nProc = 2
+				hash = tecdsa.SHA256
+			})
+
 			Context("Threshold equal 1", func() {
 
 				BeforeEach(func() {
 					t = 1
-					msg = big.NewInt(rand.Int63())
+					msg = newMsg()
 					signs = make([]*tecdsa.Signature, nProc)
 				})
 
@@ -149,6 +256,7 @@ var _ = Describe("TECDSA Test", func() {
 						init()
 						presig()
 						sign()
+						verify()
 					})
 				})
 			})
@@ -157,7 +265,7 @@ var _ = Describe("TECDSA Test", func() {
 
 				BeforeEach(func() {
 					t = 2
-					msg = big.NewInt(rand.Int63())
+					msg = newMsg()
 					signs = make([]*tecdsa.Signature, nProc)
 				})
 
@@ -172,9 +280,138 @@ var _ = Describe("TECDSA Test", func() {
 						init()
 						presig()
 						sign()
+						verify()
+					})
+
+					It("Should sign a message with the OT backend successfully", func() {
+						initOT()
+						presig()
+						sign()
+						verify()
+					})
+
+					It("Should sign messages in a form accepted by go-ethereum", func() {
+						init()
+						hash = tecdsa.Keccak256
+						for i := 0; i < 4; i++ {
+							msg = newMsg()
+							presig()
+							sign()
+							verifyEth()
+						}
+					})
+
+					It("Should sign messages with all supported hash functions", func() {
+						init()
+						for _, h := range []tecdsa.Hash{tecdsa.SHA256, tecdsa.Keccak256, tecdsa.DoubleSHA256} {
+							hash = h
+							presig()
+							sign()
+							verify()
+						}
+					})
+
+					It("Should presign and sign in two sessions concurrently", func() {
+						initOT()
+						msgs := [][]byte{newMsg(), newMsg()}
+						sessionSigns := make([][]*tecdsa.Signature, len(msgs))
+						sessionErrors := make([][]error, len(msgs))
+						wg.Add(len(msgs) * int(nProc))
+						for k := range msgs {
+							sessionSigns[k] = make([]*tecdsa.Signature, nProc)
+							sessionErrors[k] = make([]error, nProc)
+							for i := uint16(0); i < nProc; i++ {
+								go func(k int, i uint16) {
+									defer wg.Done()
+									sid := uint64(k + 1)
+									if sessionErrors[k][i] = protos[i].Presign(sid, all()); sessionErrors[k][i] != nil {
+										return
+									}
+									sessionSigns[k][i], sessionErrors[k][i] = protos[i].SignMessage(sid, msgs[k], hash)
+								}(k, i)
+							}
+						}
+						wg.Wait()
+
+						for k := range msgs {
+							msg, signs = msgs[k], sessionSigns[k]
+							for i := uint16(0); i < nProc; i++ {
+								Expect(sessionErrors[k][i]).NotTo(HaveOccurred())
+							}
+							verify()
+						}
+					})
+
+					It("Should refuse to sign in a session with no presignature", func() {
+						init()
+						presig()
+						_, err := protos[0].SignMessage(sid+1, msg, hash)
+						Expect(err).To(HaveOccurred())
+						Expect(protos[0].Presign(sid, all())).NotTo(Succeed())
+					})
+
+					It("Should truncate digests longer than the group order", func() {
+						init()
+						hash = func(message []byte) []byte {
+							digest := sha512.Sum512(message)
+							return digest[:]
+						}
+						presig()
+						sign()
+						verify()
 					})
 				})
 			})
 		})
+
+		Context("Three parties", func() {
+
+			BeforeEach(func() {
+				nProc = 3
+				t = 2
+				hash = tecdsa.SHA256
+				msg = newMsg()
+				signs = make([]*tecdsa.Signature, nProc)
+			})
+
+			Context("The third party is offline after initialization", func() {
+
+				It("Should presign and sign a message with the quorum of the others", func() {
+					quorum := []uint16{0, 1}
+					initOT()
+					presigWith(quorum)
+					signWith(quorum)
+					verifyWith(quorum)
+				})
+
+				It("Should stop presigning with all parties when the context is done and name the third party", func() {
+					initOT()
+					ctx, cancel := context.WithTimeout(context.Background(), roundTimeout/4)
+					defer cancel()
+					sid++
+					begin := time.Now()
+					wg.Add(2)
+					for i := uint16(0); i < 2; i++ {
+						go func(i uint16) {
+							defer wg.Done()
+							errors[i] = protos[i].PresignContext(ctx, sid, all())
+						}(i)
+					}
+					wg.Wait()
+
+					Expect(time.Since(begin)).To(BeNumerically("<", roundTimeout))
+					for i := uint16(0); i < 2; i++ {
+						tErr, ok := errors[i].(*sync.TimeoutError)
+						Expect(ok).To(BeTrue())
+						Expect(tErr.Unresponsive()).To(Equal([]uint16{2}))
+					}
+
+					quorum := []uint16{0, 1}
+					presigWith(quorum)
+					signWith(quorum)
+					verifyWith(quorum)
+				})
+			})
+		})
 	})
 })
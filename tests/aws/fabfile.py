@@ -88,7 +88,7 @@ def send_repo(conn):
 #======================================================================================
 
 @task
-def run_protocol(conn, pid, startTime):
+def run_protocol(conn, pid):
     ''' Runs the protocol.'''
 
     repo_path = '/home/ubuntu/go/src/gitlab.com/alephledger/threshold-ecdsa'
@@ -97,10 +97,9 @@ def run_protocol(conn, pid, startTime):
         conn.run(f'PATH="$PATH:/snap/bin" && go build {repo_path}/cmd/tecdsa')
         cmd = f'./tecdsa --pk {pid}.pk\
                     --keys_addrs keys_addrs\
-                    --roundDuration 100ms\
+                    --roundTimeout 10s\
                     --sigNumber 1\
-                    --threshold 1\
-                    --startTime "{startTime}"'
+                    --threshold 1'
         x = f'dtach -n `mktemp -u /tmp/dtach.XXXX` {cmd}'
         conn.run(f'echo {x} > x')
         conn.run(f'dtach -n `mktemp -u /tmp/dtach.XXXX` {cmd}')
@@ -115,8 +114,7 @@ def run_protocol_profiler(conn, pid, delay='0'):
         cmd = f'go run cmd/tecdsa/main.go \
                     --pk {pid}.pk\
                     --keys_addrs keys_addrs\
-                    --roundDuration 100ms\
-                    --startTime {startTime}'
+                    --roundTimeout 10s'
         if int(pid) % 16 == 0 :
             cmd += ' --cpuprof cpuprof --memprof memprof --mf 5 --bf 0'
         conn.run(f'dtach -n `mktemp -u /tmp/dtach.XXXX` {cmd}')
@@ -456,12 +456,10 @@ def run_protocol(n_processes, regions=use_regions(), instance_type='t2.micro', p
 
     color_print(f'establishing the environment took {round(time()-start, 2)}s')
     # run the experiment
-    startTime = datetime.utcnow() + timedelta(seconds=delay)
-    startTime = startTime.strftime('%a-%b-%d-%H:%M:%S-UTC-%Y')
     if profiler:
-        run_task('run-protocol-profiler', regions, parallel, False, pids, startTime)
+        run_task('run-protocol-profiler', regions, parallel, False, pids)
     else:
-        run_task('run-protocol', regions, parallel, False, pids, startTime)
+        run_task('run-protocol', regions, parallel, False, pids)
 
     return pids, ip2pid
 